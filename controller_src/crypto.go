@@ -2,318 +2,483 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"math/big"
 
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
 )
 
-func modifyVault(endpointName string) (err error) {
-	// Ensure vault file exists, if not create it
-	vaultFileMeta, err := os.Stat(config.VaultFilePath)
-	if os.IsNotExist(err) {
-		var vaultFile *os.File
-		vaultFile, err = os.Create(config.VaultFilePath)
-		if err != nil {
-			return
-		}
-		vaultFileMeta, _ = vaultFile.Stat()
-		vaultFile.Close()
-	} else if err != nil {
-		return
-	}
+// Takes a string input, and returns a SHA256 hexadecimal hash string
+func SHA256Sum(input string) (hash string) {
+	// Convert input string to byte array
+	inputBytes := []byte(input)
 
-	// Get unlock pass from user
-	vaultPassword, err := promptUserForSecret("Enter password for vault: ")
-	if err != nil {
-		return
-	}
+	// Create new hashing function
+	hasher := sha256.New()
 
-	// Check if vault file already has data (size is larger than the header)
-	vaultFileSize := vaultFileMeta.Size()
-	if vaultFileSize > 28 {
-		// Read in encrypted vault file
-		var lockedVaultFile []byte
-		lockedVaultFile, err = os.ReadFile(config.VaultFilePath)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve vault file: %v", err)
-			return
-		}
+	// Write input bytes into hasher
+	hasher.Write(inputBytes)
 
-		// Decrypt Vault
-		var unlockedVault string
-		unlockedVault, err = decrypt(lockedVaultFile, vaultPassword)
-		if err != nil {
-			return
-		}
+	// Retrieve the raw hash
+	rawHash := hasher.Sum(nil)
 
-		// Unmarshal vault JSON into global struct
-		err = json.Unmarshal([]byte(unlockedVault), &config.Vault)
-		if err != nil {
-			return
-		}
-	}
+	// Format raw hash into hex
+	hash = hex.EncodeToString(rawHash)
 
-	// Get password from user for host
-	loginUserName := config.HostInfo[endpointName].EndpointUser
-	hostPassword, err := promptUserForSecret("Enter '%s' password for host '%s' (leave empty to delete entry): ", loginUserName, endpointName)
-	if err != nil {
-		return
-	}
+	return
+}
 
-	// Remove password if user supplied empty password
-	if hostPassword == "" {
-		// Just return if host is not in vault
-		_, hostExistsinVault := config.Vault[endpointName]
-		if !hostExistsinVault {
-			return
-		}
+// Overwrites sensitive data in memory
+func wipeBytes(sensitiveData []byte) {
+	for index := range sensitiveData {
+		sensitiveData[index] = 0
+	}
+}
 
-		// Confirm with user before deleting vault entry
-		var userResponse string
-		if config.AllowDeletions {
-			userResponse = "y"
-		} else {
-			userResponse, err = promptUser("Please type 'y' to delete vault host '%s': ", endpointName)
-			if err != nil {
-				return
-			}
-		}
+// Derive a secure key from a password string using argon2
+func deriveKey(password string, salt []byte, kdfParams KDFParams) (derivedKey []byte) {
+	// Derive the key from the password
+	derivedKey = argon2.IDKey([]byte(password), salt, kdfParams.Time, kdfParams.Memory, kdfParams.Threads, kdfParams.KeyLength)
+	return
+}
 
-		// Check if the user typed 'y' (always lower-case)
-		if userResponse == "y" {
-			// Remove vault entry for host
-			delete(config.Vault, endpointName)
-			return
-		} else {
-			fmt.Printf("Did not receive confirmation, exiting.\n")
-			return
-		}
+// Checks if stored KDF parameters are weaker than the current defaults
+func kdfParamsOutdated(kdfParams KDFParams) (outdated bool) {
+	if kdfParams.Time < defaultKDFParams.Time || kdfParams.Memory < defaultKDFParams.Memory || kdfParams.Threads < defaultKDFParams.Threads || kdfParams.KeyLength < defaultKDFParams.KeyLength {
+		outdated = true
 	}
+	return
+}
 
-	// Ask again to confirm
-	hostPasswordConfirm, err := promptUserForSecret("Enter '%s' password for host '%s' again: ", loginUserName, endpointName)
+// Encrypts data with chacha20poly1305 under the given key using a random nonce
+func sealData(key []byte, plainTextBytes []byte) (nonce []byte, cipherText []byte, err error) {
+	aead, err := chacha20poly1305.New(key)
 	if err != nil {
 		return
 	}
 
-	// Error if entered passwords are not identical
-	if hostPassword != hostPasswordConfirm {
-		err = fmt.Errorf("passwords do not match")
+	// Generate a nonce (12 bytes for ChaCha20-Poly1305)
+	nonce = make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
 		return
 	}
 
-	// Modify/Add host password
-	var credential Credential
-	credential.LoginUserPassword = hostPassword
-	config.Vault[endpointName] = credential
-
-	// Encrypt and write changes to vault file - return with or without error
-	err = lockVault(vaultPassword)
+	cipherText = aead.Seal(nil, nonce, plainTextBytes, nil)
 	return
 }
 
-// Encrypts and writes current vault data back to vault file
-func lockVault(vaultPassword string) (err error) {
-	// Marshal vault into json
-	unlockedVault, err := json.Marshal(config.Vault)
-	if err != nil {
+// Decrypts data with chacha20poly1305 under the given key
+func openData(key []byte, nonce []byte, cipherText []byte) (plainTextBytes []byte, err error) {
+	if len(nonce) != chacha20poly1305.NonceSize {
+		err = fmt.Errorf("invalid nonce length %d", len(nonce))
 		return
 	}
 
-	// Encrypt Vault
-	lockedVault, err := encrypt(unlockedVault, vaultPassword)
+	aead, err := chacha20poly1305.New(key)
 	if err != nil {
 		return
 	}
 
-	// Write encrypted vault back to disk - return with or without error
-	err = os.WriteFile(config.VaultFilePath, lockedVault, 0600)
+	plainTextBytes, err = aead.Open(nil, nonce, cipherText, nil)
 	return
 }
 
-// Opens vault and retrieves password for remote host
-func unlockVault(endpointName string) (hostPassword string, err error) {
-	printMessage(VerbosityFullData, "      Host requires password, unlocking vault\n")
+// Creates a new random vault data key
+func newDataKey() (dataKey []byte, err error) {
+	dataKey = make([]byte, chacha20poly1305.KeySize)
+	_, err = io.ReadFull(rand.Reader, dataKey)
+	return
+}
 
-	// Open vault if not already open - should only happen once since vault is global
-	if len(config.Vault) == 0 {
-		printMessage(VerbosityFullData, "      Reading vault file\n")
+// Encrypts vault contents with the data key and wraps the data key for the password and every recipient
+// Returns the versioned vault file contents
+func encrypt(plainTextBytes []byte, vaultKey VaultKey) (lockedVault []byte, err error) {
+	printMessage(VerbosityDebug, "  PlainText: %v\n", string(plainTextBytes))
 
-		// Read in encrypted vault file
-		var lockedVaultFile []byte
-		lockedVaultFile, err = os.ReadFile(config.VaultFilePath)
-		if err != nil {
-			err = fmt.Errorf("failed to retrieve vault file: %v", err)
-			return
-		}
+	if vaultKey.Password == "" && vaultKey.PasswordSlot == nil && len(vaultKey.Recipients) == 0 {
+		err = fmt.Errorf("vault must be unlockable by a password or at least one recipient")
+		return
+	}
 
-		// Get unlock pass from user
-		var vaultPassword string
-		vaultPassword, err = promptUserForSecret("Enter password for vault: ")
-		if err != nil {
+	vaultFile := VaultFile{Version: vaultFormatVersion}
+
+	// Wrap data key with the password
+	if vaultKey.Password != "" {
+		// Generate a salt
+		salt := make([]byte, 16) // 16 bytes salt
+		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
 			return
 		}
 
-		printMessage(VerbosityFullData, "      Decrypting vault\n")
+		// Derive the password key using Argon2
+		kdfParams := defaultKDFParams
+		passwordKey := deriveKey(vaultKey.Password, salt, kdfParams)
 
-		// Decrypt Vault
-		var unlockedVault string
-		unlockedVault, err = decrypt(lockedVaultFile, vaultPassword)
+		var nonce, wrappedKey []byte
+		nonce, wrappedKey, err = sealData(passwordKey, vaultKey.DataKey)
 		if err != nil {
 			return
 		}
 
-		// Unmarshal vault JSON using global struct
-		err = json.Unmarshal([]byte(unlockedVault), &config.Vault)
+		kdfParams.Salt = base64.StdEncoding.EncodeToString(salt)
+		vaultFile.Password = &VaultPasswordSlot{
+			KDF:        kdfParams,
+			Nonce:      base64.StdEncoding.EncodeToString(nonce),
+			WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+		}
+	} else if vaultKey.PasswordSlot != nil {
+		// Password not known (unlocked by identity), slot still wraps the same data key
+		vaultFile.Password = vaultKey.PasswordSlot
+	}
+
+	// Wrap data key for each recipient
+	for _, recipient := range vaultKey.Recipients {
+		var wrappedRecipient VaultRecipient
+		wrappedRecipient, err = wrapKeyForRecipient(vaultKey.DataKey, recipient)
 		if err != nil {
+			err = fmt.Errorf("failed to wrap vault key for recipient '%s': %v", recipient.PublicKey, err)
 			return
 		}
+		vaultFile.Recipients = append(vaultFile.Recipients, wrappedRecipient)
 	}
 
-	printMessage(VerbosityFullData, "      Retrieving password from vault\n")
+	// Encrypt the plaintext
+	nonce, cipherText, err := sealData(vaultKey.DataKey, plainTextBytes)
+	if err != nil {
+		return
+	}
+	vaultFile.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	vaultFile.CipherText = base64.StdEncoding.EncodeToString(cipherText)
 
-	// Double check host is in vault
-	_, hostHasVaultEntry := config.Vault[endpointName]
-	if !hostHasVaultEntry {
-		err = fmt.Errorf("host does not have an entry in the vault")
+	lockedVault, err = json.MarshalIndent(vaultFile, "", "  ")
+	if err != nil {
 		return
 	}
 
-	// Retrieve password for this host
-	hostPassword = config.Vault[endpointName].LoginUserPassword
+	printMessage(VerbosityDebug, "    Vault File: %s\n", string(lockedVault))
 	return
 }
 
-// Takes a string input, and returns a SHA256 hexadecimal hash string
-func SHA256Sum(input string) (hash string) {
-	// Convert input string to byte array
-	inputBytes := []byte(input)
-
-	// Create new hashing function
-	hasher := sha256.New()
+// Parses vault file contents of any format version
+// Legacy (base64 salt+nonce+ciphertext) files are returned as a version 1 vault file
+func parseVaultFile(lockedVault []byte) (vaultFile VaultFile, err error) {
+	trimmedVault := bytes.TrimSpace(lockedVault)
+	if !bytes.HasPrefix(trimmedVault, []byte("{")) {
+		// Legacy vault file - decode base64 to raw byte array
+		var cipherTextSaltNonce []byte
+		cipherTextSaltNonce, err = base64.StdEncoding.DecodeString(string(trimmedVault))
+		if err != nil {
+			err = fmt.Errorf("failed to decode cipher text from base64: %v", err)
+			return
+		}
 
-	// Write input bytes into hasher
-	hasher.Write(inputBytes)
+		if len(cipherTextSaltNonce) < 28 {
+			err = fmt.Errorf("vault file is too short to contain salt and nonce")
+			return
+		}
 
-	// Retrieve the raw hash
-	rawHash := hasher.Sum(nil)
+		// Extract the salt (16 bytes) and nonce (12 bytes) from the ciphertext
+		kdfParams := legacyKDFParams
+		kdfParams.Salt = base64.StdEncoding.EncodeToString(cipherTextSaltNonce[:16])
+		vaultFile = VaultFile{
+			Version:    1,
+			KDF:        &kdfParams,
+			Nonce:      base64.StdEncoding.EncodeToString(cipherTextSaltNonce[16:28]),
+			CipherText: base64.StdEncoding.EncodeToString(cipherTextSaltNonce[28:]),
+		}
+		return
+	}
 
-	// Format raw hash into hex
-	hash = hex.EncodeToString(rawHash)
+	// Versioned vault file
+	err = json.Unmarshal(trimmedVault, &vaultFile)
+	if err != nil {
+		err = fmt.Errorf("failed to parse vault file header: %v", err)
+		return
+	}
 
+	if vaultFile.Version < 2 || vaultFile.Version > vaultFormatVersion {
+		err = fmt.Errorf("unsupported vault format version %d", vaultFile.Version)
+		return
+	}
+	if vaultFile.Version == 2 && vaultFile.KDF == nil {
+		err = fmt.Errorf("vault file is missing key derivation parameters")
+		return
+	}
+	if vaultFile.Version >= 3 && vaultFile.Password == nil && len(vaultFile.Recipients) == 0 {
+		err = fmt.Errorf("vault file has no password or recipients to unlock it")
+		return
+	}
 	return
 }
 
-// Derive a secure key from a password string using argon2
-func deriveKey(password string, salt []byte) (derivedKey []byte) {
-	// Argon2 parameters
-	const time = 1
-	const memory = 64 * 1024
-	const threads = 4
-	const keyLength = 32
+// Checks KDF parameters are usable
+func validateKDFParams(kdfParams KDFParams) (err error) {
+	if kdfParams.Algorithm != defaultKDFParams.Algorithm {
+		err = fmt.Errorf("unsupported vault key derivation algorithm '%s'", kdfParams.Algorithm)
+		return
+	}
+	if kdfParams.Time == 0 || kdfParams.Memory == 0 || kdfParams.Threads == 0 || kdfParams.KeyLength != chacha20poly1305.KeySize {
+		err = fmt.Errorf("invalid vault key derivation parameters")
+		return
+	}
+	return
+}
 
-	// Derive the key from the password
-	derivedKey = argon2.IDKey([]byte(password), salt, time, memory, threads, keyLength)
+// Checks if the vault file should be written again with the current format and KDF parameters
+func vaultFileOutdated(vaultFile VaultFile) (outdated bool) {
+	if vaultFile.Version < vaultFormatVersion {
+		outdated = true
+	} else if vaultFile.Password != nil && kdfParamsOutdated(vaultFile.Password.KDF) {
+		outdated = true
+	}
 	return
 }
 
-// Encrypt a string using a password with chacha20poly1305 and return a byte array of cipher text with required salt and nonce
-func encrypt(plainTextBytes []byte, decryptPassword string) (cipherTextSaltNonce []byte, err error) {
-	printMessage(VerbosityDebug, "  Password to Encrypt: %s\n", decryptPassword)
-	printMessage(VerbosityDebug, "  PlainText: %v\n", string(plainTextBytes))
+// Recovers the key that encrypts the vault contents using the vault password
+// For version 1/2 vaults this is the password derived key itself
+func unwrapKeyWithPassword(vaultFile VaultFile, password string) (dataKey []byte, err error) {
+	var kdfParams KDFParams
+	if vaultFile.Version < 3 {
+		kdfParams = *vaultFile.KDF
+	} else if vaultFile.Password != nil {
+		kdfParams = vaultFile.Password.KDF
+	} else {
+		err = fmt.Errorf("vault cannot be unlocked with a password (only recipients)")
+		return
+	}
 
-	// Generate a salt
-	salt := make([]byte, 16) // 16 bytes salt
-	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+	err = validateKDFParams(kdfParams)
+	if err != nil {
 		return
 	}
 
-	// Derive the encryption key using Argon2
-	key := deriveKey(decryptPassword, salt)
+	salt, err := base64.StdEncoding.DecodeString(kdfParams.Salt)
+	if err != nil {
+		err = fmt.Errorf("failed to decode salt from base64: %v", err)
+		return
+	}
 
-	// Create a new ChaCha20-Poly1305 instance
-	aead, err := chacha20poly1305.New(key)
+	// Derive the password key using Argon2
+	passwordKey := deriveKey(password, salt, kdfParams)
+
+	if vaultFile.Version < 3 {
+		dataKey = passwordKey
+		return
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(vaultFile.Password.Nonce)
 	if err != nil {
+		err = fmt.Errorf("failed to decode nonce from base64: %v", err)
+		return
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(vaultFile.Password.WrappedKey)
+	if err != nil {
+		err = fmt.Errorf("failed to decode wrapped key from base64: %v", err)
 		return
 	}
 
-	// Generate a nonce (12 bytes for ChaCha20-Poly1305)
-	nonce := make([]byte, aead.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	dataKey, err = openData(passwordKey, nonce, wrappedKey)
+	if err != nil {
+		err = fmt.Errorf("incorrect vault password: %v", err)
 		return
 	}
+	return
+}
 
-	printMessage(VerbosityDebug, "    Salt: %v\n", salt)
+// Decrypt vault contents using the data key and return a string of plain text
+func decrypt(vaultFile VaultFile, dataKey []byte) (plainText []byte, err error) {
+	nonce, err := base64.StdEncoding.DecodeString(vaultFile.Nonce)
+	if err != nil {
+		err = fmt.Errorf("failed to decode nonce from base64: %v", err)
+		return
+	}
+	cipherTextBytes, err := base64.StdEncoding.DecodeString(vaultFile.CipherText)
+	if err != nil {
+		err = fmt.Errorf("failed to decode cipher text from base64: %v", err)
+		return
+	}
+
+	printMessage(VerbosityDebug, "    CipherText: %v\n", cipherTextBytes)
 	printMessage(VerbosityDebug, "    Nonce: %v\n", nonce)
-	printMessage(VerbosityDebug, "    Key: %v\n", key)
 
-	// Encrypt the plaintext
-	ciphertext := aead.Seal(plainTextBytes[:0], nonce, plainTextBytes, nil)
+	// Decrypt the ciphertext
+	plainText, err = openData(dataKey, nonce, cipherTextBytes)
+	if err != nil {
+		return
+	}
 
-	printMessage(VerbosityDebug, "    CipherText: %v\n", ciphertext)
+	printMessage(VerbosityDebug, "    PlainText: %s\n", plainText)
+	return
+}
 
-	// The final ciphertext will include the salt and nonce for later decryption
-	cipherTextSaltNonce = append(salt, append(nonce, ciphertext...)...)
+// Converts an Ed25519 public key to its X25519 (Montgomery) form
+// u = (1 + y) / (1 - y) mod p
+func ed25519PublicKeyToX25519(publicKey ed25519.PublicKey) (x25519Key []byte, err error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		err = fmt.Errorf("invalid ed25519 public key length %d", len(publicKey))
+		return
+	}
 
-	printMessage(VerbosityDebug, "    CipherText with Salt and Nonce: %v\n", cipherTextSaltNonce)
+	// Key is little endian y coordinate with the sign of x in the top bit
+	yBytes := make([]byte, len(publicKey))
+	for index := range publicKey {
+		yBytes[len(publicKey)-1-index] = publicKey[index]
+	}
+	yBytes[0] &= 0x7f
+	y := new(big.Int).SetBytes(yBytes)
 
-	// Encode byte array to base64
-	encodedCipherText := base64.StdEncoding.EncodeToString(cipherTextSaltNonce)
-	cipherTextSaltNonce = []byte(encodedCipherText)
+	curveP := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	if y.Cmp(curveP) >= 0 {
+		err = fmt.Errorf("invalid ed25519 public key")
+		return
+	}
 
-	printMessage(VerbosityDebug, "    Encoded CipherText: %v\n", cipherTextSaltNonce)
+	one := big.NewInt(1)
+	numerator := new(big.Int).Add(one, y)
+	denominator := new(big.Int).Sub(one, y)
+	denominator.Mod(denominator, curveP)
+	if denominator.Sign() == 0 {
+		err = fmt.Errorf("invalid ed25519 public key")
+		return
+	}
+	denominator.ModInverse(denominator, curveP)
+	u := numerator.Mul(numerator, denominator)
+	u.Mod(u, curveP)
+
+	// Back to little endian
+	uBytes := u.FillBytes(make([]byte, curve25519.PointSize))
+	x25519Key = make([]byte, curve25519.PointSize)
+	for index := range uBytes {
+		x25519Key[len(uBytes)-1-index] = uBytes[index]
+	}
+	return
+}
 
+// Converts an Ed25519 private key to its X25519 private scalar
+func ed25519PrivateKeyToX25519(privateKey ed25519.PrivateKey) (x25519Key []byte) {
+	hash := sha512.Sum512(privateKey.Seed())
+	x25519Key = hash[:curve25519.ScalarSize]
+	x25519Key[0] &= 248
+	x25519Key[31] &= 127
+	x25519Key[31] |= 64
 	return
 }
 
-// Decrypt a byte array using a password with chacha20poly1305 and return a string of plain text
-func decrypt(cipherTextSaltNonce []byte, encryptPassword string) (plainText string, err error) {
-	printMessage(VerbosityDebug, "  Password to Decrypt: %s\n", encryptPassword)
-	printMessage(VerbosityDebug, "  Encoded CipherText: %v\n", cipherTextSaltNonce)
+// Derives the key that wraps the vault data key for a single recipient
+// Bound to the ephemeral key, the recipient key, and the recipient public key string
+func deriveRecipientWrapKey(sharedSecret []byte, ephemeralPublic []byte, recipientPublic []byte, recipientID string) (wrapKey []byte, err error) {
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+	keyReader := hkdf.New(sha256.New, sharedSecret, salt, []byte("scmp-vault-recipient "+recipientID))
 
-	// Decode base64 to raw byte array
-	cipherTextSaltNonce, err = base64.StdEncoding.DecodeString(string(cipherTextSaltNonce))
+	wrapKey = make([]byte, chacha20poly1305.KeySize)
+	_, err = io.ReadFull(keyReader, wrapKey)
+	return
+}
+
+// Wraps the vault data key for a recipient using an ephemeral X25519 key exchange
+// Returns the recipient with the ephemeral public key and wrapped key filled in
+func wrapKeyForRecipient(dataKey []byte, recipient VaultRecipient) (wrappedRecipient VaultRecipient, err error) {
+	recipientPublic, err := recipientX25519PublicKey(recipient)
 	if err != nil {
-		err = fmt.Errorf("failed to decode cipher text from base64: %v", err)
 		return
 	}
 
-	printMessage(VerbosityDebug, "    CipherText with Salt and Nonce: %x\n", cipherTextSaltNonce)
+	ephemeralPrivate := make([]byte, curve25519.ScalarSize)
+	if _, err = io.ReadFull(rand.Reader, ephemeralPrivate); err != nil {
+		return
+	}
+	ephemeralPublic, err := curve25519.X25519(ephemeralPrivate, curve25519.Basepoint)
+	if err != nil {
+		return
+	}
+
+	sharedSecret, err := curve25519.X25519(ephemeralPrivate, recipientPublic)
+	if err != nil {
+		return
+	}
 
-	// Extract the salt (16 bytes) and nonce (12 bytes) from the ciphertext
-	salt := cipherTextSaltNonce[:16]
-	nonce := cipherTextSaltNonce[16:28]
-	cipherTextBytes := cipherTextSaltNonce[28:]
+	wrapKey, err := deriveRecipientWrapKey(sharedSecret, ephemeralPublic, recipientPublic, recipient.PublicKey)
+	if err != nil {
+		return
+	}
 
-	// Derive the decryption key using Argon2
-	key := deriveKey(encryptPassword, salt)
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return
+	}
 
-	printMessage(VerbosityDebug, "    CipherText: %v\n", cipherTextBytes)
-	printMessage(VerbosityDebug, "    Key: %v\n", key)
-	printMessage(VerbosityDebug, "    Nonce: %v\n", nonce)
-	printMessage(VerbosityDebug, "    Salt: %v\n", salt)
+	// Wrap key is unique to this ephemeral key, so a zero nonce is safe
+	nonce := make([]byte, aead.NonceSize())
+	wrappedKey := aead.Seal(nil, nonce, dataKey, nil)
 
-	// Create a new ChaCha20-Poly1305 instance
-	aead, err := chacha20poly1305.New(key)
+	wrappedRecipient = recipient
+	wrappedRecipient.EphemeralKey = base64.StdEncoding.EncodeToString(ephemeralPublic)
+	wrappedRecipient.WrappedKey = base64.StdEncoding.EncodeToString(wrappedKey)
+	return
+}
+
+// Recovers the vault data key from the recipient entry matching the identity
+func unwrapKeyWithIdentity(vaultFile VaultFile, identity VaultIdentity) (dataKey []byte, err error) {
+	var recipient VaultRecipient
+	var recipientFound bool
+	for _, vaultRecipient := range vaultFile.Recipients {
+		if vaultRecipient.PublicKey == identity.Recipient.PublicKey {
+			recipient = vaultRecipient
+			recipientFound = true
+			break
+		}
+	}
+	if !recipientFound {
+		err = fmt.Errorf("identity '%s' is not a recipient of the vault", identity.Recipient.PublicKey)
+		return
+	}
+
+	ephemeralPublic, err := base64.StdEncoding.DecodeString(recipient.EphemeralKey)
 	if err != nil {
+		err = fmt.Errorf("failed to decode ephemeral key from base64: %v", err)
+		return
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(recipient.WrappedKey)
+	if err != nil {
+		err = fmt.Errorf("failed to decode wrapped key from base64: %v", err)
 		return
 	}
 
-	// Decrypt the ciphertext
-	plainTextBytes, err := aead.Open(nil, nonce, cipherTextBytes, nil)
+	recipientPublic, err := curve25519.X25519(identity.PrivateKey, curve25519.Basepoint)
+	if err != nil {
+		return
+	}
+	sharedSecret, err := curve25519.X25519(identity.PrivateKey, ephemeralPublic)
 	if err != nil {
 		return
 	}
 
-	plainText = string(plainTextBytes)
-	printMessage(VerbosityDebug, "    PlainText: %s\n", plainText)
+	wrapKey, err := deriveRecipientWrapKey(sharedSecret, ephemeralPublic, recipientPublic, recipient.PublicKey)
+	if err != nil {
+		return
+	}
+
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	dataKey, err = aead.Open(nil, nonce, wrappedKey, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to unwrap vault key with identity: %v", err)
+		return
+	}
 	return
 }
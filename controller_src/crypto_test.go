@@ -2,7 +2,15 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestSHA256Sum(t *testing.T) {
@@ -26,3 +34,209 @@ func TestSHA256Sum(t *testing.T) {
 		})
 	}
 }
+
+func TestEncryptDecrypt(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	plainText := `{"login/Web01":{"value":"pass"}}`
+
+	dataKey, err := newDataKey()
+	if err != nil {
+		t.Fatalf("failed to create data key: %v", err)
+	}
+
+	lockedVault, err := encrypt([]byte(plainText), VaultKey{DataKey: dataKey, Password: "vaultpass"})
+	if err != nil {
+		t.Fatalf("expected no error encrypting but got: %v", err)
+	}
+
+	vaultFile, err := parseVaultFile(lockedVault)
+	if err != nil {
+		t.Fatalf("expected no error parsing vault but got: %v", err)
+	}
+	if vaultFileOutdated(vaultFile) {
+		t.Errorf("expected no upgrade required for current format")
+	}
+
+	unwrappedKey, err := unwrapKeyWithPassword(vaultFile, "vaultpass")
+	if err != nil {
+		t.Fatalf("expected no error unwrapping data key but got: %v", err)
+	}
+	decrypted, err := decrypt(vaultFile, unwrappedKey)
+	if err != nil {
+		t.Fatalf("expected no error decrypting but got: %v", err)
+	}
+	if string(decrypted) != plainText {
+		t.Errorf("expected decrypted text '%s' but got '%s'", plainText, decrypted)
+	}
+
+	_, err = unwrapKeyWithPassword(vaultFile, "wrongpass")
+	if err == nil {
+		t.Errorf("expected error unwrapping with wrong password but got none")
+	}
+
+	_, err = encrypt([]byte(plainText), VaultKey{DataKey: dataKey})
+	if err == nil {
+		t.Errorf("expected error encrypting without password or recipients but got none")
+	}
+}
+
+func TestEncryptDecryptRecipients(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	plainText := `{"secret/token":{"value":"abc"}}`
+
+	// Native X25519 identity
+	x25519Private := bytes.Repeat([]byte{7}, curve25519.ScalarSize)
+	x25519Public, err := curve25519.X25519(x25519Private, curve25519.Basepoint)
+	if err != nil {
+		t.Fatalf("failed to create x25519 key: %v", err)
+	}
+	x25519Identity := VaultIdentity{
+		Recipient:  VaultRecipient{Type: vaultRecipientX25519, PublicKey: vaultX25519PublicPrefix + " " + base64.StdEncoding.EncodeToString(x25519Public)},
+		PrivateKey: x25519Private,
+	}
+
+	// SSH ed25519 identity
+	ed25519Private := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize))
+	sshPublicKey, err := ssh.NewPublicKey(ed25519Private.Public())
+	if err != nil {
+		t.Fatalf("failed to create ssh public key: %v", err)
+	}
+	sshIdentity := VaultIdentity{
+		Recipient:  VaultRecipient{Type: vaultRecipientSSHEd25519, PublicKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey)))},
+		PrivateKey: ed25519PrivateKeyToX25519(ed25519Private),
+	}
+
+	dataKey, err := newDataKey()
+	if err != nil {
+		t.Fatalf("failed to create data key: %v", err)
+	}
+	vaultKey := VaultKey{
+		DataKey:    dataKey,
+		Recipients: []VaultRecipient{x25519Identity.Recipient, sshIdentity.Recipient},
+	}
+
+	lockedVault, err := encrypt([]byte(plainText), vaultKey)
+	if err != nil {
+		t.Fatalf("expected no error encrypting but got: %v", err)
+	}
+	vaultFile, err := parseVaultFile(lockedVault)
+	if err != nil {
+		t.Fatalf("expected no error parsing vault but got: %v", err)
+	}
+
+	for _, identity := range []VaultIdentity{x25519Identity, sshIdentity} {
+		t.Run(identity.Recipient.Type, func(t *testing.T) {
+			unwrappedKey, err := unwrapKeyWithIdentity(vaultFile, identity)
+			if err != nil {
+				t.Fatalf("expected no error unwrapping data key but got: %v", err)
+			}
+			decrypted, err := decrypt(vaultFile, unwrappedKey)
+			if err != nil {
+				t.Fatalf("expected no error decrypting but got: %v", err)
+			}
+			if string(decrypted) != plainText {
+				t.Errorf("expected decrypted text '%s' but got '%s'", plainText, decrypted)
+			}
+		})
+	}
+
+	// Password cannot unlock a recipient-only vault
+	_, err = unwrapKeyWithPassword(vaultFile, "vaultpass")
+	if err == nil {
+		t.Errorf("expected error unwrapping recipient-only vault with password but got none")
+	}
+
+	// Identity that is not a recipient
+	otherIdentity := x25519Identity
+	otherIdentity.Recipient.PublicKey = vaultX25519PublicPrefix + " " + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, curve25519.PointSize))
+	_, err = unwrapKeyWithIdentity(vaultFile, otherIdentity)
+	if err == nil {
+		t.Errorf("expected error unwrapping with non-recipient identity but got none")
+	}
+}
+
+func TestEd25519ToX25519(t *testing.T) {
+	for seed := byte(0); seed < 8; seed++ {
+		privateKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+
+		convertedPublic, err := ed25519PublicKeyToX25519(privateKey.Public().(ed25519.PublicKey))
+		if err != nil {
+			t.Fatalf("expected no error converting public key but got: %v", err)
+		}
+
+		derivedPublic, err := curve25519.X25519(ed25519PrivateKeyToX25519(privateKey), curve25519.Basepoint)
+		if err != nil {
+			t.Fatalf("expected no error deriving public key but got: %v", err)
+		}
+
+		if !bytes.Equal(convertedPublic, derivedPublic) {
+			t.Errorf("seed %d: converted public key %x does not match derived public key %x", seed, convertedPublic, derivedPublic)
+		}
+	}
+}
+
+func TestDecryptLegacyFormat(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	plainText := "legacy vault"
+	salt := bytes.Repeat([]byte{1}, 16)
+	nonce := bytes.Repeat([]byte{2}, chacha20poly1305.NonceSize)
+
+	aead, err := chacha20poly1305.New(deriveKey("vaultpass", salt, legacyKDFParams))
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+	cipherText := aead.Seal(nil, nonce, []byte(plainText), nil)
+
+	legacyVault := append(append(append([]byte{}, salt...), nonce...), cipherText...)
+	lockedVault := []byte(base64.StdEncoding.EncodeToString(legacyVault))
+
+	vaultFile, err := parseVaultFile(lockedVault)
+	if err != nil {
+		t.Fatalf("expected no error parsing legacy vault but got: %v", err)
+	}
+	if !vaultFileOutdated(vaultFile) {
+		t.Errorf("expected upgrade required for legacy format")
+	}
+
+	dataKey, err := unwrapKeyWithPassword(vaultFile, "vaultpass")
+	if err != nil {
+		t.Fatalf("expected no error deriving legacy key but got: %v", err)
+	}
+	decrypted, err := decrypt(vaultFile, dataKey)
+	if err != nil {
+		t.Fatalf("expected no error decrypting legacy vault but got: %v", err)
+	}
+	if string(decrypted) != plainText {
+		t.Errorf("expected decrypted text '%s' but got '%s'", plainText, decrypted)
+	}
+
+	_, err = parseVaultFile([]byte("c2hvcnQ="))
+	if err == nil {
+		t.Errorf("expected error for truncated legacy vault but got none")
+	}
+}
+
+func TestKDFParamsOutdated(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   KDFParams
+		expected bool
+	}{
+		{"defaults", defaultKDFParams, false},
+		{"legacy", legacyKDFParams, true},
+		{"stronger", KDFParams{Algorithm: "argon2id", Time: 4, Memory: 128 * 1024, Threads: 4, KeyLength: 32}, false},
+		{"low memory", KDFParams{Algorithm: "argon2id", Time: 3, Memory: 1024, Threads: 4, KeyLength: 32}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outdated := kdfParamsOutdated(test.params)
+			if outdated != test.expected {
+				t.Errorf("kdfParamsOutdated(%s) = %t, want %t", test.name, outdated, test.expected)
+			}
+		})
+	}
+}
@@ -24,14 +24,17 @@ func logError(errorDescription string, errorMessage error, CleanupNeeded bool) {
 	if errorMessage == nil {
 		return
 	}
+	// Mask any secrets that made it into the error
+	fullErrorMessage := redactSecrets(fmt.Sprintf("%s: %v", errorDescription, errorMessage))
+
 	// Attempt to put error in journald
-	err := CreateJournaldLog(fmt.Sprintf("%s: %v", errorDescription, errorMessage), "err")
+	err := CreateJournaldLog(fullErrorMessage, "err")
 	if err != nil {
 		fmt.Printf("Failed to create journald entry: %v\n", err)
 	}
 
 	// Print the error
-	fmt.Printf("\n%s: %v\n", errorDescription, errorMessage)
+	fmt.Printf("\n%s\n", fullErrorMessage)
 
 	// Only roll back commit if the program was started by a hook and if the commit rollback is requested
 	// Reset commit because the current commit should reflect what is deployed in the network
@@ -106,7 +109,7 @@ func CreateJournaldLog(errorMessage string, requestedPriority string) (err error
 	}
 
 	// Send entry to journald
-	err = journal.Send(errorMessage, msgPriority, nil)
+	err = journal.Send(redactSecrets(errorMessage), msgPriority, nil)
 	if err != nil {
 		// Don't send error back if journald is unavailable
 		if strings.Contains(err.Error(), "could not initialize socket") {
@@ -122,7 +125,7 @@ func CreateJournaldLog(errorMessage string, requestedPriority string) (err error
 // Always returns
 func recordDeploymentFailure(endpointName string, allFileArray []string, index int, errorMessage error) {
 	// Ensure multiline error messages dont make their way into json
-	Message := errorMessage.Error()
+	Message := redactSecrets(errorMessage.Error())
 	Message = strings.ReplaceAll(Message, "\n", " ")
 	Message = strings.ReplaceAll(Message, "\r", " ")
 
@@ -46,16 +46,20 @@ func runCmd(command string, hosts string) {
 		// Run the command
 		executeCommand(hostInfo, command)
 	}
+
+	// Passwords are no longer needed
+	wipeHostSecrets()
+	wipeVault()
 }
 
 func executeCommand(hostInfo EndpointInfo, command string) {
 	// Connect to the SSH server
-	client, err := connectToSSH(hostInfo.Endpoint, hostInfo.EndpointUser, hostInfo.Password, hostInfo.PrivateKey, hostInfo.KeyAlgo)
+	client, err := connectToSSH(hostInfo)
 	logError("Failed to connect to host", err, false)
 	defer client.Close()
 
 	// Execute user command
-	commandOutput, err := RunSSHCommand(client, command, "", config.DisableSudo, hostInfo.Password, 900)
+	commandOutput, err := RunSSHCommand(client, command, "", hostPrivilegeEscalation(hostInfo), 900)
 	logError("Command Failed", err, false)
 
 	// Show command output
@@ -159,6 +163,10 @@ func runScript(scriptFile string, hosts string, remoteFilePath string) {
 		printMessage(VerbosityStandard, "Errors:\n  %v\n", executionErrors)
 	}
 
+	// Passwords are no longer needed
+	wipeHostSecrets()
+	wipeVault()
+
 }
 
 // Connect to a host, upload a script, execute script and print output
@@ -171,7 +179,7 @@ func executeScriptOnHost(wg *sync.WaitGroup, semaphore chan struct{}, hostInfo E
 	defer func() { <-semaphore }() // Release the token when the goroutine finishes
 
 	// Connect to the SSH server
-	client, err := connectToSSH(hostInfo.Endpoint, hostInfo.EndpointUser, hostInfo.Password, hostInfo.PrivateKey, hostInfo.KeyAlgo)
+	client, err := connectToSSH(hostInfo)
 	if err != nil {
 		executionErrorsMutex.Lock()
 		executionErrors += fmt.Sprintf("  Host '%s': %v\n", hostInfo.EndpointName, err)
@@ -179,8 +187,18 @@ func executeScriptOnHost(wg *sync.WaitGroup, semaphore chan struct{}, hostInfo E
 	}
 	defer client.Close()
 
+	// Pick command variants for this hosts userland
+	escalation := hostPrivilegeEscalation(hostInfo)
+	capabilities, err := detectRemoteCapabilities(client, hostInfo.EndpointName, escalation)
+	if err != nil {
+		executionErrorsMutex.Lock()
+		executionErrors += fmt.Sprintf("  Host '%s': %v\n", hostInfo.EndpointName, err)
+		executionErrorsMutex.Unlock()
+		return
+	}
+
 	// Run the script remotely
-	scriptOutput, err := executeScript(client, hostInfo.Password, hostInfo.RemoteTransferBuffer, scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash)
+	scriptOutput, err := executeScript(client, escalation, capabilities, hostInfo.RemoteTransferBuffer, scriptInterpreter, remoteFilePath, scriptFileBytes, scriptHash)
 	if err != nil {
 		executionErrorsMutex.Lock()
 		executionErrors += fmt.Sprintf("  Host '%s': %v\n", hostInfo.EndpointName, err)
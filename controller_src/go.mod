@@ -8,6 +8,7 @@ require (
 	github.com/go-git/go-git/v5 v5.13.2
 	github.com/kevinburke/ssh_config v1.2.0
 	golang.org/x/crypto v0.33.0
+	golang.org/x/sys v0.30.0
 	golang.org/x/term v0.29.0
 )
 
@@ -27,6 +28,5 @@ require (
 	github.com/skeema/knownhosts v1.3.1 // indirect
 	github.com/xanzy/ssh-agent v0.3.3 // indirect
 	golang.org/x/net v0.34.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
 )
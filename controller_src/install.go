@@ -153,7 +153,7 @@ func createNewRepository(newRepoInfo string) {
 
 		// Populate metadata JSON with examples
 		metadataHeader.TargetFileOwnerGroup = "root:root"
-		metadataHeader.TargetFilePermissions = 640
+		metadataHeader.TargetFilePermissions = "0640"
 
 		// Add reloads/checks or dont depending on example file name
 		if !strings.Contains(exampleFile, "noreload") {
@@ -190,23 +190,31 @@ func createNewRepository(newRepoInfo string) {
 	})
 	logError("Failed to create first commit", err, false)
 
-	printMessage(VerbosityProgress, "Adding a (disabled) git post-commit hook to call controller on commits\n")
+	printMessage(VerbosityProgress, "Adding (disabled) git hooks to deploy on commits and validate before commits and pushes\n")
 
-	// Post commit path and contents
-	// TTY exec required to connect keyboard input to program prompts when called by git
-	postCommitFilePath := absoluteRepoPath + "/.git/hooks/post-commit.disabled"
-	postCommit := fmt.Sprintf(`#!/bin/bash
+	for _, hookName := range []string{"post-commit", "pre-commit", "pre-push"} {
+		err = writeGitHook(absoluteRepoPath+"/.git/hooks/"+hookName+".disabled", hookName)
+		logError(fmt.Sprintf("Error writing %s hook file", hookName), err, false)
+	}
+}
+
+// Writes the git hook script that calls the controller
+// post-commit deploys the commit, pre-commit and pre-push only validate (and block on problems)
+func writeGitHook(hookFilePath string, hookName string) (err error) {
+	var hookScript string
+	if hookName == "post-commit" {
+		// TTY exec required to connect keyboard input to program prompts when called by git
+		hookScript = fmt.Sprintf(`#!/bin/bash
 	exec < /dev/tty
 	%s --git-hook-mode --deploy-changes --config %s`, os.Args[0], config.FilePath)
+	} else {
+		// No TTY, pre-push receives the pushed refs on stdin
+		hookScript = fmt.Sprintf(`#!/bin/bash
+	exec %s --validate-hook %s --config %s`, os.Args[0], hookName, config.FilePath)
+	}
 
-	// Open post-commit file path
-	file, err := os.OpenFile(postCommitFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0750)
-	logError("Error opening post-commit file", err, false)
-	defer file.Close()
-
-	// Write the post-commit to the hook file
-	_, err = file.WriteString(postCommit)
-	logError("Error writing to post-commit file", err, false)
+	err = os.WriteFile(hookFilePath, []byte(hookScript), 0750)
+	return
 }
 
 func installDefaultSSHConfig() {
@@ -216,9 +224,14 @@ func installDefaultSSHConfig() {
 # Global Config Settings #
 ##########################
 #  Ignore SCMP Host Configuration Options
-IgnoreUnknown           PasswordVault,PasswordRequired,DeploymentState,IgnoreTemplates,RemoteBackupDir,RemoteTransferBuffer,UniversalDirectory,GroupDirs,GroupTags,IgnoreDirectories
+IgnoreUnknown           PasswordVault,VaultIdentityFile,VaultPasswordCommand,VaultPasswordFile,PasswordRequired,PrivilegeEscalation,DeploymentState,IgnoreTemplates,RemoteBackupDir,RemoteTransferBuffer,UniversalDirectory,GroupDirs,GroupTags,IgnoreDirectories
 #  Store any login/sudo passwords in an encrypted file here
 PasswordVault           ~/.ssh/scmpc.vault
+#  Unlock the vault with your own key instead of the vault password (after being added with --vault-add-recipient)
+#VaultIdentityFile      ~/.ssh/id_ed25519
+#  Retrieve the vault password without prompting (command stdout or file contents)
+#VaultPasswordCommand   pass show scmp/vault
+#VaultPasswordFile      ~/.ssh/scmpc.vault.pass
 #  Directory Name that contains files relevant to all hosts
 UniversalDirectory      "UniversalConfs"
 #  Group Directory Names for Universal Configs to be deployed to all hosts tagged with that group
@@ -228,18 +241,23 @@ IgnoreDirectories       Templates,Extras
 #
 ################# EXAMPLE HOSTS CONFIGURATION
 #
+#  Hosts can also be kept in separate files
+#Include                inventory.d/*.conf
+#
 #Host Web01
 #        Hostname       192.168.10.2
 #       GroupTags       UniversalConfs_NGINX,UniversalConfs_MONAGENT
 #       DeploymentState offline
 #Host Proxy01
 #       Hostname        192.168.10.3
+#       PrivilegeEscalation doas
 #       GroupTags       UniversalConfs_MONAGENT
 #Host DNS01
 #        Hostname       ns1.domain.com
 #Host PBX
 #        Hostname       192.168.10.4
 #       User            root
+#       PrivilegeEscalation none
 #       DeploymentState offline
 #Host WWW
 #        Hostname       192.168.20.15
@@ -248,6 +266,7 @@ IgnoreDirectories       Templates,Extras
 #Host Mail
 #        Hostname       mx01.domain.com
 #       IdentityFile    ~/.ssh/appservers.key
+#       CertificateFile ~/.ssh/appservers.key-cert.pub
 #Host Squid
 #        Hostname       192.168.20.22
 #       RemoteBackupDir         /var/tmp/.scmpbackups
@@ -256,6 +275,7 @@ IgnoreDirectories       Templates,Extras
 #        Hostname       psql01.domain.com
 #       Port            2202
 #       StrictHostKeyChecking no
+#       ProxyJump       Squid
 #       DeploymentState offline
 #Host SSO
 #        Hostname       sso.domain.com
@@ -287,10 +307,10 @@ Host *
 
 	// Check if config already exists
 	_, err := os.Stat(configPath)
-	if !os.IsNotExist(err) {
+	if err == nil {
 		printMessage(VerbosityProgress, "SSH Config file already exists, not overwritting it. Please configure manually.\n")
 		return
-	} else {
+	} else if !os.IsNotExist(err) {
 		printMessage(VerbosityProgress, "Unable to check if SSH config file already exists: %v\n", err)
 		return
 	}
@@ -358,7 +378,7 @@ profile SCMController @{exelocation} flags=(enforce) {
 	if os.IsNotExist(err) {
 		printMessage(VerbosityProgress, "AppArmor not supported by this system\n")
 		return
-	} else {
+	} else if err != nil {
 		printMessage(VerbosityProgress, "Unable to check if AppArmor is supported by this system: %v\n", err)
 		return
 	}
@@ -0,0 +1,715 @@
+// controller
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ###########################################
+//      KNOWN HOSTS HANDLING
+// ###########################################
+
+// Parses the known_hosts file into the global host key callback
+// Must be called again after any change to the known_hosts file
+func loadKnownHosts() (err error) {
+	callback, err := knownhosts.New(config.KnownHostsFilePath)
+	if err != nil {
+		err = fmt.Errorf("unable to parse known_hosts file: %v", err)
+		return
+	}
+
+	KnownHostMutex.Lock()
+	knownHostsCallback = callback
+	KnownHostMutex.Unlock()
+	return
+}
+
+// Returns the HostKeyCallback for a hosts StrictHostKeyChecking option
+func hostKeyCallback(strictHostKeyChecking string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, PubKey ssh.PublicKey) error {
+		return checkHostKey(strictHostKeyChecking, hostname, remote, PubKey)
+	}
+}
+
+// Validates remote public key against known pub keys
+// If unknown, will ask user if it should trust the remote host (StrictHostKeyChecking ask)
+// Unknown keys are refused with StrictHostKeyChecking yes and added without asking with accept-new or no
+// If the host has a different key on record, the connection is refused unless the user explicitly replaces the key
+func checkHostKey(strictHostKeyChecking string, hostname string, remote net.Addr, PubKey ssh.PublicKey) (err error) {
+	KnownHostMutex.Lock()
+	checkKnownHost := knownHostsCallback
+	KnownHostMutex.Unlock()
+
+	// Plain, hashed, wildcard, [host]:port, @cert-authority and @revoked lines
+	err = checkKnownHost(hostname, remote, PubKey)
+	if err == nil {
+		return
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		// Revoked keys and parsing failures
+		err = fmt.Errorf("error with ssh server key check: %v", err)
+		return
+	}
+	if len(keyErr.Want) > 0 {
+		err = handleChangedHostKey(hostname, keyErr.Want, PubKey)
+		return
+	}
+
+	// Entries written by older versions only contain the bare address (no port or brackets)
+	legacyHost, err := legacyKnownHostsAddress(hostname)
+	if err != nil {
+		err = fmt.Errorf("error with ssh server key check: unable to determine hostname in address: %v", err)
+		return
+	}
+	knownHostEntries, err := readKnownHostsFile()
+	if err != nil {
+		return
+	}
+	var legacyKeys []knownhosts.KnownKey
+	for _, knownHostEntry := range knownHostEntries {
+		if knownHostEntry.Marker != "" || !knownHostsLineMatches(knownHostEntry.Hosts, legacyHost) {
+			continue
+		}
+		if string(knownHostEntry.Key.Marshal()) == string(PubKey.Marshal()) {
+			return
+		}
+		legacyKeys = append(legacyKeys, knownhosts.KnownKey{Key: knownHostEntry.Key, Filename: config.KnownHostsFilePath, Line: knownHostEntry.LineNumber})
+	}
+	if len(legacyKeys) > 0 {
+		err = handleChangedHostKey(hostname, legacyKeys, PubKey)
+		return
+	}
+
+	switch strictHostKeyChecking {
+	case "yes":
+		err = fmt.Errorf("host %s is not in known_hosts and StrictHostKeyChecking is enabled (add it with '--known-hosts scan')", hostname)
+		return
+	case "accept-new", "no":
+		printMessage(VerbosityStandard, "Host %s not in known_hosts, adding key %s %s (StrictHostKeyChecking %s)\n", knownhosts.Normalize(hostname), PubKey.Type(), ssh.FingerprintSHA256(PubKey), strictHostKeyChecking)
+		err = writeKnownHosts(map[string][]ssh.PublicKey{hostname: {PubKey}})
+		return
+	}
+
+	// If global was set, dont ask user to add unknown key
+	if addAllUnknownHosts {
+		err = writeKnownHosts(map[string][]ssh.PublicKey{hostname: {PubKey}})
+		return
+	}
+
+	// If env var is set, use as prompt answer
+	envaddToKnownHosts := os.Getenv(environmentUnknownSSHHostKey)
+
+	// Key was not found in known_hosts - Prompt user
+	fmt.Printf("Host %s not in known_hosts. Key: %s %s\n", knownhosts.Normalize(hostname), PubKey.Type(), ssh.FingerprintSHA256(PubKey))
+	var addToKnownHosts string
+	if envaddToKnownHosts != "" {
+		// Put environment answer into answer var - also show answered prompt
+		addToKnownHosts = envaddToKnownHosts
+		printMessage(VerbosityStandard, "Do you want to add this key to known_hosts? [y/N/all/skip]: %s\n", addToKnownHosts)
+	} else {
+		addToKnownHosts, err = promptUser("Do you want to add this key to known_hosts? [y/N/all/skip]: ")
+		if err != nil {
+			return
+		}
+	}
+	addToKnownHosts = strings.TrimSpace(addToKnownHosts)
+	addToKnownHosts = strings.ToLower(addToKnownHosts)
+
+	// Parse user response
+	if addToKnownHosts == "all" {
+		// User wants to trust all future pub key prompts 'all' implies 'yes' to this first host key
+		// For the duration of this program run, all unknown remote host keys will be added to known_hosts
+		addAllUnknownHosts = true
+	} else if addToKnownHosts == "skip" {
+		// Continue connection, but don't write host key
+		return
+	} else if addToKnownHosts != "y" {
+		// User did not say yes, abort connection
+		err = fmt.Errorf("not continuing with connection to %s", hostname)
+		return
+	}
+
+	// Add remote pubkey to known_hosts file
+	err = writeKnownHosts(map[string][]ssh.PublicKey{hostname: {PubKey}})
+	return
+}
+
+// Handles a host presenting a different key than the one(s) on record
+// Refuses unless the user explicitly answers 'replace' - never answered by the environment variable or a previous 'all'
+func handleChangedHostKey(hostname string, knownKeys []knownhosts.KnownKey, PubKey ssh.PublicKey) (err error) {
+	fmt.Printf("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\n")
+	fmt.Printf("@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\n")
+	fmt.Printf("@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\n")
+	fmt.Printf("Host %s presented a different key than the one in known_hosts.\n", knownhosts.Normalize(hostname))
+	fmt.Printf("Someone could be eavesdropping on you right now (man-in-the-middle attack), or the host key was changed.\n")
+	for _, knownKey := range knownKeys {
+		fmt.Printf("  Known key:     %s %s (%s:%d)\n", knownKey.Key.Type(), ssh.FingerprintSHA256(knownKey.Key), knownKey.Filename, knownKey.Line)
+	}
+	fmt.Printf("  Presented key: %s %s\n", PubKey.Type(), ssh.FingerprintSHA256(PubKey))
+
+	journalErr := CreateJournaldLog(fmt.Sprintf("Host key for %s changed: presented %s %s", knownhosts.Normalize(hostname), PubKey.Type(), ssh.FingerprintSHA256(PubKey)), "err")
+	if journalErr != nil {
+		printMessage(VerbosityStandard, "Failed to create journald entry: %v\n", journalErr)
+	}
+
+	refusedErr := fmt.Errorf("host key for %s has changed, refusing to connect (use '--known-hosts rotate' after verifying the new key)", hostname)
+
+	// Only an interactive answer can replace a key
+	replaceKey, promptErr := promptUser("Replace the known key(s) and continue? Only do this if the key change is expected [replace/N]: ")
+	if promptErr != nil || strings.TrimSpace(replaceKey) != "replace" {
+		err = refusedErr
+		return
+	}
+
+	_, err = removeKnownHostsAddresses(knownHostsAddresses(hostname))
+	if err != nil {
+		return
+	}
+	err = writeKnownHosts(map[string][]ssh.PublicKey{hostname: {PubKey}})
+	if err != nil {
+		return
+	}
+
+	// Keys from wildcard entries are not removed automatically
+	KnownHostMutex.Lock()
+	checkKnownHost := knownHostsCallback
+	KnownHostMutex.Unlock()
+	err = checkKnownHost(hostname, &net.TCPAddr{}, PubKey)
+	if err != nil {
+		err = fmt.Errorf("new key for %s still conflicts with known_hosts, edit the file manually: %v", hostname, err)
+		return
+	}
+	return
+}
+
+// Returns the address format used by known_hosts entries written before port and bracket support
+func legacyKnownHostsAddress(address string) (legacyHost string, err error) {
+	legacyHost, _, err = net.SplitHostPort(address)
+	return
+}
+
+// Appends hashed entries for new host keys to the known_hosts file and reloads known hosts
+func writeKnownHosts(newHostKeys map[string][]ssh.PublicKey) (err error) {
+	// Show progress to user
+	printMessage(VerbosityStandard, "Writing new host entry in known_hosts... ")
+
+	var newKnownHosts string
+	for address, hostKeys := range newHostKeys {
+		for _, hostKey := range hostKeys {
+			newKnownHosts += knownhosts.Line([]string{knownhosts.HashHostname(knownhosts.Normalize(address))}, hostKey) + "\n"
+		}
+	}
+
+	// Lock file for writing
+	KnownHostMutex.Lock()
+
+	knownHostsfile, err := os.OpenFile(config.KnownHostsFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		KnownHostMutex.Unlock()
+		err = fmt.Errorf("failed to open known_hosts file: %v", err)
+		return
+	}
+
+	_, err = knownHostsfile.WriteString(newKnownHosts)
+	knownHostsfile.Close()
+	KnownHostMutex.Unlock()
+	if err != nil {
+		err = fmt.Errorf("failed to write new known host to known_hosts file: %v", err)
+		return
+	}
+
+	err = loadKnownHosts()
+	if err != nil {
+		return
+	}
+
+	// Show progress to user
+	printMessage(VerbosityStandard, "Success\n")
+	return
+}
+
+// Reads all entries of the known_hosts file along with their line numbers
+func readKnownHostsFile() (knownHostEntries []KnownHostEntry, err error) {
+	knownHostsFile, err := os.ReadFile(config.KnownHostsFilePath)
+	if err != nil {
+		err = fmt.Errorf("unable to read known_hosts file: %v", err)
+		return
+	}
+
+	knownHostEntries, err = parseKnownHostsLines(strings.Split(string(knownHostsFile), "\n"))
+	return
+}
+
+// Parses known_hosts lines, skipping comments and blank lines
+func parseKnownHostsLines(knownHostsLines []string) (knownHostEntries []KnownHostEntry, err error) {
+	for index, knownHostsLine := range knownHostsLines {
+		knownHostsLine = strings.TrimSpace(knownHostsLine)
+		if knownHostsLine == "" || strings.HasPrefix(knownHostsLine, "#") {
+			continue
+		}
+
+		var knownHostEntry KnownHostEntry
+		knownHostEntry.LineNumber = index + 1
+		knownHostEntry.Marker, knownHostEntry.Hosts, knownHostEntry.Key, _, _, err = ssh.ParseKnownHosts([]byte(knownHostsLine))
+		if err != nil {
+			err = fmt.Errorf("known_hosts line %d: %v", knownHostEntry.LineNumber, err)
+			return
+		}
+
+		knownHostEntries = append(knownHostEntries, knownHostEntry)
+	}
+	return
+}
+
+// Checks a single known_hosts host pattern (hashed, literal, or wildcard) against a host
+func knownHostsPatternMatches(pattern string, host string) (matches bool) {
+	if strings.HasPrefix(pattern, "|1|") {
+		hashFields := strings.Split(strings.TrimPrefix(pattern, "|1|"), "|")
+		if len(hashFields) != 2 {
+			return
+		}
+		salt, err := base64.StdEncoding.DecodeString(hashFields[0])
+		if err != nil {
+			return
+		}
+		knownHash, err := base64.StdEncoding.DecodeString(hashFields[1])
+		if err != nil {
+			return
+		}
+
+		hmacAlgo := hmac.New(sha1.New, salt)
+		hmacAlgo.Write([]byte(host))
+		matches = hmac.Equal(hmacAlgo.Sum(nil), knownHash)
+		return
+	}
+
+	// OpenSSH wildcards are only '*' and '?', escape everything path.Match would treat specially
+	pattern = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`).Replace(strings.ToLower(pattern))
+	matches, _ = path.Match(pattern, strings.ToLower(host))
+	return
+}
+
+// Checks a known_hosts host list against a host, negated patterns ('!pattern') exclude the host
+func knownHostsLineMatches(hostPatterns []string, host string) (matches bool) {
+	for _, hostPattern := range hostPatterns {
+		negated := strings.HasPrefix(hostPattern, "!")
+		if !knownHostsPatternMatches(strings.TrimPrefix(hostPattern, "!"), host) {
+			continue
+		}
+		if negated {
+			matches = false
+			return
+		}
+		matches = true
+	}
+	return
+}
+
+// Removes host keys for the given hosts from known_hosts lines
+// Hosts are only removed from host lists, other hosts on the same line are kept
+// Wildcard patterns, @cert-authority and @revoked lines are never changed
+func removeKnownHostsEntries(knownHostsLines []string, hosts []string) (updatedLines []string, removedEntries int) {
+	for _, knownHostsLine := range knownHostsLines {
+		lineFields := strings.Fields(knownHostsLine)
+		if len(lineFields) < 3 || strings.HasPrefix(lineFields[0], "#") || strings.HasPrefix(lineFields[0], "@") {
+			updatedLines = append(updatedLines, knownHostsLine)
+			continue
+		}
+
+		var remainingPatterns []string
+		for _, hostPattern := range strings.Split(lineFields[0], ",") {
+			removePattern := false
+			if !strings.HasPrefix(hostPattern, "!") && !strings.ContainsAny(hostPattern, "*?") {
+				for _, host := range hosts {
+					if knownHostsPatternMatches(hostPattern, host) {
+						removePattern = true
+						break
+					}
+				}
+			}
+
+			if removePattern {
+				removedEntries++
+				continue
+			}
+			remainingPatterns = append(remainingPatterns, hostPattern)
+		}
+
+		if len(remainingPatterns) == 0 {
+			continue
+		}
+
+		// Keep original spacing, key and comment
+		hostsFieldStart := strings.Index(knownHostsLine, lineFields[0])
+		updatedLines = append(updatedLines, knownHostsLine[:hostsFieldStart]+strings.Join(remainingPatterns, ",")+knownHostsLine[hostsFieldStart+len(lineFields[0]):])
+	}
+	return
+}
+
+// Returns the addresses a host could be stored under in known_hosts
+func knownHostsAddresses(endpoint string) (addresses []string) {
+	addresses = append(addresses, knownhosts.Normalize(endpoint))
+
+	legacyHost, err := legacyKnownHostsAddress(endpoint)
+	if err == nil && legacyHost != addresses[0] {
+		addresses = append(addresses, legacyHost)
+	}
+	return
+}
+
+// Retrieves the names of configured hosts selected by the host override (all hosts if no override)
+func selectKnownHostsTargets(hostOverride string) (endpointNames []string) {
+	for endpointName, hostInfo := range config.HostInfo {
+		if hostInfo.Endpoint == "" {
+			continue
+		}
+
+		skipHost := checkForOverride(hostOverride, endpointName)
+		if skipHost {
+			continue
+		}
+
+		endpointNames = append(endpointNames, endpointName)
+	}
+	sort.Strings(endpointNames)
+	return
+}
+
+// Entry point for known_hosts management actions
+func manageKnownHosts(action string, hostOverride string) (err error) {
+	endpointNames := selectKnownHostsTargets(hostOverride)
+	if hostOverride != "" && len(endpointNames) == 0 {
+		err = fmt.Errorf("no configured hosts match '%s'", hostOverride)
+		return
+	}
+
+	switch action {
+	case "list":
+		err = listKnownHosts(endpointNames, hostOverride != "")
+	case "remove":
+		if hostOverride == "" {
+			err = fmt.Errorf("remote-hosts is required to remove known_hosts entries")
+			return
+		}
+		err = removeKnownHosts(endpointNames)
+	case "scan":
+		err = scanKnownHosts(endpointNames)
+	case "rotate":
+		if hostOverride == "" {
+			err = fmt.Errorf("remote-hosts is required to rotate known_hosts entries")
+			return
+		}
+		err = rotateKnownHosts(endpointNames)
+	default:
+		err = fmt.Errorf("unknown known_hosts action '%s' (valid: list, remove, rotate, scan)", action)
+	}
+	return
+}
+
+// Prints known_hosts entries with the configured hosts they belong to
+// Hashed entries that do not match a configured host cannot be named
+func listKnownHosts(endpointNames []string, onlySelected bool) (err error) {
+	knownHostEntries, err := readKnownHostsFile()
+	if err != nil {
+		return
+	}
+
+	for _, knownHostEntry := range knownHostEntries {
+		var entryHostNames []string
+		for _, endpointName := range endpointNames {
+			for _, address := range knownHostsAddresses(config.HostInfo[endpointName].Endpoint) {
+				if knownHostsLineMatches(knownHostEntry.Hosts, address) {
+					entryHostNames = append(entryHostNames, endpointName)
+					break
+				}
+			}
+		}
+
+		if len(entryHostNames) == 0 {
+			if onlySelected {
+				continue
+			}
+			for _, hostPattern := range knownHostEntry.Hosts {
+				if strings.HasPrefix(hostPattern, "|1|") {
+					hostPattern = "(hashed)"
+				}
+				entryHostNames = append(entryHostNames, hostPattern)
+			}
+		}
+
+		marker := ""
+		if knownHostEntry.Marker != "" {
+			marker = "@" + knownHostEntry.Marker + " "
+		}
+
+		fmt.Printf("%-30s %s%s %s (line %d)\n", strings.Join(entryHostNames, ","), marker, knownHostEntry.Key.Type(), ssh.FingerprintSHA256(knownHostEntry.Key), knownHostEntry.LineNumber)
+	}
+	return
+}
+
+// Removes all host key entries for the given hosts from the known_hosts file
+func removeKnownHosts(endpointNames []string) (err error) {
+	var addresses []string
+	for _, endpointName := range endpointNames {
+		addresses = append(addresses, knownHostsAddresses(config.HostInfo[endpointName].Endpoint)...)
+	}
+
+	removedEntries, err := removeKnownHostsAddresses(addresses)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Removed %d known_hosts entries for %s\n", removedEntries, strings.Join(endpointNames, ", "))
+	return
+}
+
+// Removes all host key entries for the given known_hosts addresses and reloads known hosts
+func removeKnownHostsAddresses(addresses []string) (removedEntries int, err error) {
+	KnownHostMutex.Lock()
+	knownHostsFile, err := os.ReadFile(config.KnownHostsFilePath)
+	if err != nil {
+		KnownHostMutex.Unlock()
+		return
+	}
+
+	updatedLines, removedEntries := removeKnownHostsEntries(strings.Split(string(knownHostsFile), "\n"), addresses)
+	if removedEntries > 0 {
+		err = writeFileAtomic(config.KnownHostsFilePath, []byte(strings.Join(updatedLines, "\n")), 0644)
+	}
+	KnownHostMutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	err = loadKnownHosts()
+	return
+}
+
+// Retrieves all host keys offered by a remote host, one handshake per key type
+func fetchHostKeys(endpoint string) (hostKeys []ssh.PublicKey, err error) {
+	errKeyRetrieved := errors.New("host key retrieved")
+
+	for _, hostKeyAlgorithm := range knownHostsScanAlgorithms {
+		var offeredKey ssh.PublicKey
+		SSHconfig := &ssh.ClientConfig{
+			User:              "scmpc-keyscan",
+			ClientVersion:     "SSH-2.0-OpenSSH_9.8p1",
+			HostKeyAlgorithms: []string{hostKeyAlgorithm},
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				offeredKey = key
+				return errKeyRetrieved
+			},
+		}
+
+		var conn net.Conn
+		conn, err = dialEndpoint("tcp", endpoint, 10*time.Second)
+		if err != nil {
+			return
+		}
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		ssh.NewClientConn(conn, endpoint, SSHconfig)
+		conn.Close()
+
+		// Host does not have a key of this type
+		if offeredKey == nil {
+			continue
+		}
+
+		duplicateKey := false
+		for _, hostKey := range hostKeys {
+			if string(hostKey.Marshal()) == string(offeredKey.Marshal()) {
+				duplicateKey = true
+				break
+			}
+		}
+		if !duplicateKey {
+			hostKeys = append(hostKeys, offeredKey)
+		}
+	}
+
+	if len(hostKeys) == 0 {
+		err = fmt.Errorf("host did not offer any supported host keys")
+	}
+	return
+}
+
+// Checks if any @cert-authority entry in known_hosts covers the address
+func knownHostsTrustsCertAuthority(address string) (trusted bool) {
+	knownHostEntries, err := readKnownHostsFile()
+	if err != nil {
+		return
+	}
+
+	for _, knownHostEntry := range knownHostEntries {
+		if knownHostEntry.Marker == "cert-authority" && knownHostsLineMatches(knownHostEntry.Hosts, knownhosts.Normalize(address)) {
+			trusted = true
+			return
+		}
+	}
+	return
+}
+
+// Retrieves the types of the keys known for a host (in current or legacy entry format)
+func knownHostKeyTypes(endpoint string) (keyTypes []string) {
+	knownHostEntries, err := readKnownHostsFile()
+	if err != nil {
+		return
+	}
+
+	for _, knownHostEntry := range knownHostEntries {
+		if knownHostEntry.Marker != "" || slices.Contains(keyTypes, knownHostEntry.Key.Type()) {
+			continue
+		}
+		for _, address := range knownHostsAddresses(endpoint) {
+			if knownHostsLineMatches(knownHostEntry.Hosts, address) {
+				keyTypes = append(keyTypes, knownHostEntry.Key.Type())
+				break
+			}
+		}
+	}
+	return
+}
+
+// Checks if a host has any known key (in current or legacy entry format)
+func hostHasKnownKeys(knownHostEntries []KnownHostEntry, endpoint string) (known bool) {
+	for _, knownHostEntry := range knownHostEntries {
+		if knownHostEntry.Marker != "" {
+			continue
+		}
+		for _, address := range knownHostsAddresses(endpoint) {
+			if knownHostsLineMatches(knownHostEntry.Hosts, address) {
+				known = true
+				return
+			}
+		}
+	}
+	return
+}
+
+// Retrieves host keys for hosts that are not in known_hosts yet and adds them after confirmation
+// Hosts that already have known keys are left alone (use rotate to replace them)
+func scanKnownHosts(endpointNames []string) (err error) {
+	knownHostEntries, err := readKnownHostsFile()
+	if err != nil {
+		return
+	}
+
+	newHostKeys := make(map[string][]ssh.PublicKey)
+	var newKeyCount int
+	for _, endpointName := range endpointNames {
+		endpoint := config.HostInfo[endpointName].Endpoint
+
+		if hostHasKnownKeys(knownHostEntries, endpoint) {
+			printMessage(VerbosityProgress, "Host %s: already in known_hosts, skipping\n", endpointName)
+			continue
+		}
+
+		hostKeys, fetchErr := fetchHostKeys(endpoint)
+		if fetchErr != nil {
+			printMessage(VerbosityStandard, "Host %s: failed to retrieve host keys: %v\n", endpointName, fetchErr)
+			continue
+		}
+
+		for _, hostKey := range hostKeys {
+			fmt.Printf("Host %s (%s): %s %s\n", endpointName, knownhosts.Normalize(endpoint), hostKey.Type(), ssh.FingerprintSHA256(hostKey))
+		}
+		newHostKeys[endpoint] = hostKeys
+		newKeyCount += len(hostKeys)
+	}
+
+	if newKeyCount == 0 {
+		printMessage(VerbosityStandard, "No new host keys to add\n")
+		return
+	}
+
+	// If env var is set, use as prompt answer
+	addToKnownHosts := os.Getenv(environmentUnknownSSHHostKey)
+	if addToKnownHosts != "" {
+		printMessage(VerbosityStandard, "Add %d host keys to known_hosts? [y/N]: %s\n", newKeyCount, addToKnownHosts)
+	} else {
+		addToKnownHosts, err = promptUser("Add %d host keys to known_hosts? [y/N]: ", newKeyCount)
+		if err != nil {
+			return
+		}
+	}
+	addToKnownHosts = strings.ToLower(strings.TrimSpace(addToKnownHosts))
+	if addToKnownHosts != "y" && addToKnownHosts != "all" {
+		printMessage(VerbosityStandard, "No host keys added\n")
+		return
+	}
+
+	err = writeKnownHosts(newHostKeys)
+	return
+}
+
+// Replaces known keys of hosts with their currently offered keys after confirmation
+func rotateKnownHosts(endpointNames []string) (err error) {
+	for _, endpointName := range endpointNames {
+		endpoint := config.HostInfo[endpointName].Endpoint
+
+		hostKeys, fetchErr := fetchHostKeys(endpoint)
+		if fetchErr != nil {
+			printMessage(VerbosityStandard, "Host %s: failed to retrieve host keys: %v\n", endpointName, fetchErr)
+			continue
+		}
+
+		// Re-read each time, previous hosts may have changed the file
+		var knownHostEntries []KnownHostEntry
+		knownHostEntries, err = readKnownHostsFile()
+		if err != nil {
+			return
+		}
+
+		for _, knownHostEntry := range knownHostEntries {
+			if knownHostEntry.Marker != "" {
+				continue
+			}
+			for _, address := range knownHostsAddresses(endpoint) {
+				if knownHostsLineMatches(knownHostEntry.Hosts, address) {
+					fmt.Printf("Host %s: old %s %s (line %d)\n", endpointName, knownHostEntry.Key.Type(), ssh.FingerprintSHA256(knownHostEntry.Key), knownHostEntry.LineNumber)
+					break
+				}
+			}
+		}
+		for _, hostKey := range hostKeys {
+			fmt.Printf("Host %s: new %s %s\n", endpointName, hostKey.Type(), ssh.FingerprintSHA256(hostKey))
+		}
+
+		// Replacing keys always requires an answer from the user
+		var replaceKeys string
+		replaceKeys, err = promptUser("Replace known_hosts keys for %s? [y/N]: ", endpointName)
+		if err != nil {
+			return
+		}
+		if strings.ToLower(strings.TrimSpace(replaceKeys)) != "y" {
+			printMessage(VerbosityStandard, "Host %s: keys not replaced\n", endpointName)
+			continue
+		}
+
+		err = removeKnownHosts([]string{endpointName})
+		if err != nil {
+			return
+		}
+		err = writeKnownHosts(map[string][]ssh.PublicKey{endpoint: hostKeys})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
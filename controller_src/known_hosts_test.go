@@ -0,0 +1,179 @@
+// controller
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestKnownHostsLineMatches(t *testing.T) {
+	hashedHost := knownhosts.HashHostname("[10.0.0.5]:2222")
+
+	tests := []struct {
+		name         string
+		hostPatterns []string
+		host         string
+		expected     bool
+	}{
+		{"Plain host", []string{"10.0.0.1"}, "10.0.0.1", true},
+		{"Plain host case", []string{"Server.Example.com"}, "server.example.com", true},
+		{"Plain host mismatch", []string{"10.0.0.1"}, "10.0.0.2", false},
+		{"Second pattern", []string{"web01", "10.0.0.1"}, "10.0.0.1", true},
+		{"Bracketed port", []string{"[10.0.0.1]:2222"}, "[10.0.0.1]:2222", true},
+		{"Bracketed port mismatch", []string{"[10.0.0.1]:2222"}, "10.0.0.1", false},
+		{"Wildcard", []string{"10.0.0.*"}, "10.0.0.1", true},
+		{"Single character wildcard", []string{"web0?"}, "web01", true},
+		{"Negated wildcard", []string{"10.0.0.*", "!10.0.0.9"}, "10.0.0.9", false},
+		{"Negated first", []string{"!10.0.0.9", "10.0.0.*"}, "10.0.0.9", false},
+		{"Hashed", []string{hashedHost}, "[10.0.0.5]:2222", true},
+		{"Hashed mismatch", []string{hashedHost}, "10.0.0.5", false},
+		{"Invalid hash", []string{"|1|notbase64|"}, "10.0.0.5", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := knownHostsLineMatches(test.hostPatterns, test.host)
+			if result != test.expected {
+				t.Errorf("knownHostsLineMatches(%v, %s) = %v, expected %v", test.hostPatterns, test.host, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestRemoveKnownHostsEntries(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHm8LqgxWFMmVvB3y5JzHCaaBqD1kJ0V3dQZMiEMTTnS"
+	hashedHost := knownhosts.HashHostname("10.0.0.1")
+
+	tests := []struct {
+		name            string
+		lines           []string
+		hosts           []string
+		expectedLines   []string
+		expectedRemoved int
+	}{
+		{
+			name:            "Hashed line",
+			lines:           []string{hashedHost + " " + key, "10.0.0.2 " + key},
+			hosts:           []string{"10.0.0.1"},
+			expectedLines:   []string{"10.0.0.2 " + key},
+			expectedRemoved: 1,
+		},
+		{
+			name:            "Shared line keeps other hosts",
+			lines:           []string{"web01,10.0.0.1 " + key + " comment"},
+			hosts:           []string{"10.0.0.1"},
+			expectedLines:   []string{"web01 " + key + " comment"},
+			expectedRemoved: 1,
+		},
+		{
+			name:            "Bracketed port",
+			lines:           []string{"[10.0.0.1]:2222 " + key, "10.0.0.1 " + key},
+			hosts:           []string{"[10.0.0.1]:2222"},
+			expectedLines:   []string{"10.0.0.1 " + key},
+			expectedRemoved: 1,
+		},
+		{
+			name:            "Wildcards and markers untouched",
+			lines:           []string{"10.0.0.* " + key, "@cert-authority 10.0.0.1 " + key, "@revoked 10.0.0.1 " + key, "# 10.0.0.1"},
+			hosts:           []string{"10.0.0.1"},
+			expectedLines:   []string{"10.0.0.* " + key, "@cert-authority 10.0.0.1 " + key, "@revoked 10.0.0.1 " + key, "# 10.0.0.1"},
+			expectedRemoved: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updatedLines, removed := removeKnownHostsEntries(test.lines, test.hosts)
+			if removed != test.expectedRemoved {
+				t.Errorf("removed %d entries, expected %d", removed, test.expectedRemoved)
+			}
+			if !reflect.DeepEqual(updatedLines, test.expectedLines) {
+				t.Errorf("got lines:\n%s\nexpected:\n%s", strings.Join(updatedLines, "\n"), strings.Join(test.expectedLines, "\n"))
+			}
+		})
+	}
+}
+
+func TestKnownHostsAddresses(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected []string
+	}{
+		{"10.0.0.1:22", []string{"10.0.0.1"}},
+		{"10.0.0.1:2222", []string{"[10.0.0.1]:2222", "10.0.0.1"}},
+		{"[fd00::1]:22", []string{"[fd00::1]", "fd00::1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			result := knownHostsAddresses(test.endpoint)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("knownHostsAddresses(%s) = %v, expected %v", test.endpoint, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestHostKeyCallbackChangedKey(t *testing.T) {
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	config.KnownHostsFilePath = knownHostsPath
+
+	_, oldPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldSigner, _ := ssh.NewSignerFromKey(oldPrivateKey)
+	_, newPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+	newSigner, _ := ssh.NewSignerFromKey(newPrivateKey)
+
+	knownHostsContents := knownhosts.Line([]string{"10.0.0.1:2222"}, oldSigner.PublicKey()) + "\n" +
+		knownhosts.HashHostname("10.0.0.2") + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(oldSigner.PublicKey()))) + "\n"
+	err := os.WriteFile(knownHostsPath, []byte(knownHostsContents), 0644)
+	if err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+	err = loadKnownHosts()
+	if err != nil {
+		t.Fatalf("failed to load known_hosts: %v", err)
+	}
+
+	// Neither a previous 'all' answer nor the environment answer may accept a changed key
+	addAllUnknownHosts = true
+	t.Setenv(environmentUnknownSSHHostKey, "all")
+	defer func() { addAllUnknownHosts = false }()
+
+	tests := []struct {
+		name        string
+		address     string
+		key         ssh.PublicKey
+		expectError bool
+	}{
+		{"Known key", "10.0.0.1:2222", oldSigner.PublicKey(), false},
+		{"Changed key", "10.0.0.1:2222", newSigner.PublicKey(), true},
+		{"Legacy entry known key", "10.0.0.2:2222", oldSigner.PublicKey(), false},
+		{"Legacy entry changed key", "10.0.0.2:2222", newSigner.PublicKey(), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkHostKey("ask", test.address, &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}, test.key)
+			if (err != nil) != test.expectError {
+				t.Errorf("hostKeyCallback(%s) error = %v, expected error: %v", test.address, err, test.expectError)
+			}
+		})
+	}
+
+	knownHostsAfter, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		t.Fatalf("failed to read known_hosts: %v", err)
+	}
+	if string(knownHostsAfter) != knownHostsContents {
+		t.Errorf("known_hosts was modified by a changed key:\n%s", knownHostsAfter)
+	}
+}
@@ -0,0 +1,371 @@
+// controller
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Checks every file of a commit and prints all problems as JSON lines
+// Exits with an error status if any finding is an error
+func lintRepository(commitID string) {
+	var err error
+
+	// Check working dir for git repo
+	err = retrieveGitRepoPath()
+	logError("Repository Error", err, false)
+
+	// Open repo and get details - using HEAD commit if commitID is empty
+	tree, _, err := getCommit(&commitID)
+	logError("Error retrieving commit details", err, false)
+
+	findings, err := lintRepositoryTree(tree)
+	logError("Error linting repository", err, false)
+
+	var errorCount, warningCount int
+	for _, finding := range findings {
+		var findingJSON []byte
+		findingJSON, err = json.Marshal(finding)
+		logError("Error formatting lint finding", err, false)
+		fmt.Println(redactSecrets(string(findingJSON)))
+
+		if finding.Severity == lintSeverityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+
+	printMessage(VerbosityProgress, "Lint found %d error(s) and %d warning(s) in commit %s\n", errorCount, warningCount, commitID)
+
+	if errorCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// Runs all lint checks against a repository tree
+// Returned findings are deduplicated and sorted by file
+func lintRepositoryTree(tree *object.Tree) (findings []LintFinding, err error) {
+	printMessage(VerbosityProgress, "Linting repository files\n")
+
+	// Gather map of files per host and per universal directory
+	allHostsFiles, universalFiles, err := parseAllRepoFiles(tree)
+	if err != nil {
+		return
+	}
+	deniedUniversalFiles := mapDeniedUniversalFiles(allHostsFiles, universalFiles)
+
+	// Patched universal files are still used, so shadowing is checked before patches are mapped
+	findings = append(findings, lintShadowedUniversalFiles(universalFiles, deniedUniversalFiles)...)
+
+	directoryDefaults := make(map[string]*MetaHeader)
+
+	patchFiles, errLocal := mapPatchFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if errLocal != nil {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "patch", Message: errLocal.Error()})
+	}
+	patchFilePaths := make(map[string]struct{})
+	for _, patchOverlay := range patchFiles {
+		patchFilePaths[patchOverlay.PatchFilePath] = struct{}{}
+
+		var content []byte
+		content, err = loadPatchedFile(patchOverlay, tree)
+		if err != nil {
+			findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "patch", File: patchOverlay.PatchFilePath, Message: err.Error()})
+			err = nil
+			continue
+		}
+
+		var headerFindings []LintFinding
+		headerFindings, err = lintFileHeader(patchOverlay.PatchFilePath, patchOverlay.BaseFilePath, string(content), tree, directoryDefaults)
+		if err != nil {
+			return
+		}
+		findings = append(findings, headerFindings...)
+	}
+
+	fragmentFiles, errLocal := mapFragmentFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if errLocal != nil {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "fragment", Message: errLocal.Error()})
+	}
+	for _, fragmentPaths := range fragmentFiles {
+		var content []byte
+		content, err = assembleFragments(fragmentPaths, tree)
+		if err != nil {
+			findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "fragment", File: fragmentPaths[0], Message: err.Error()})
+			err = nil
+			continue
+		}
+
+		var headerFindings []LintFinding
+		headerFindings, err = lintFileHeader(fragmentPaths[0], fragmentPaths[0], string(content), tree, directoryDefaults)
+		if err != nil {
+			return
+		}
+		findings = append(findings, headerFindings...)
+	}
+
+	// Check each file on its own
+	topLevelDirs := make(map[string]struct{})
+	err = tree.Files().ForEach(func(repoFile *object.File) (err error) {
+		topLevelDir, tgtFilePath, found := strings.Cut(repoFile.Name, "/")
+		if !found {
+			// Files in root of repository are never deployed
+			return
+		}
+		if slices.Contains(config.IgnoreDirectories, topLevelDir) {
+			return
+		}
+		topLevelDirs[topLevelDir] = struct{}{}
+		if repoFileIsValid(repoFile.Name) {
+			// Reported once per directory below
+			return
+		}
+
+		fileType := determineFileType(fmt.Sprintf("%v", repoFile.Mode))
+		if fileType == "symlink" {
+			var linkText string
+			linkText, err = repoFile.Contents()
+			if err != nil {
+				err = fmt.Errorf("failed reading symbolic link '%s': %v", repoFile.Name, err)
+				return
+			}
+
+			var targetPath string
+			targetPath, err = resolveRepoLinkTarget(repoFile.Name, linkText)
+			if err != nil {
+				findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "symlink", File: repoFile.Name, Message: err.Error()})
+				err = nil
+				return
+			}
+			_, errFile := tree.File(targetPath)
+			_, errDir := tree.Tree(targetPath)
+			if errFile != nil && errDir != nil {
+				findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "symlink", File: repoFile.Name, Message: fmt.Sprintf("link target '%s' does not exist in repository", targetPath)})
+			}
+			return
+		} else if fileType != "regular" {
+			findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "file-type", File: repoFile.Name, Message: fmt.Sprintf("unsupported file mode %v, file is never deployed", repoFile.Mode)})
+			return
+		}
+
+		var content string
+		content, err = repoFile.Contents()
+		if err != nil {
+			err = fmt.Errorf("failed reading file '%s': %v", repoFile.Name, err)
+			return
+		}
+		findings = append(findings, lintFileContent(repoFile.Name, content)...)
+
+		if strings.HasSuffix(repoFile.Name, directoryMetadataFileName) {
+			findings = append(findings, lintDirectoryMetadata(repoFile.Name, content)...)
+			return
+		}
+
+		// Patches and fragments are checked as the file they produce
+		_, fileIsPatch := patchFilePaths[repoFile.Name]
+		_, _, fileIsFragment := splitFragmentPath(tgtFilePath)
+		if fileIsPatch || fileIsFragment {
+			return
+		}
+
+		var headerFindings []LintFinding
+		headerFindings, err = lintFileHeader(repoFile.Name, repoFile.Name, content, tree, directoryDefaults)
+		findings = append(findings, headerFindings...)
+		return
+	})
+	if err != nil {
+		err = fmt.Errorf("failed linting repository files: %v", err)
+		return
+	}
+
+	// Directories that are never deployed
+	for topLevelDir := range topLevelDirs {
+		if repoFileIsValid(topLevelDir + "/" + directoryMetadataFileName) {
+			findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "unknown-directory", File: topLevelDir, Message: "directory does not match any host, the universal directory, or a group directory"})
+		}
+	}
+	for groupName := range config.AllUniversalGroups {
+		_, groupDirExists := topLevelDirs[groupName]
+		if !groupDirExists {
+			findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "missing-group-directory", File: groupName, Message: "group in GroupDirs has no directory in repository"})
+		}
+	}
+
+	// Same finding can come from several hosts (like shared fragments)
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		if findings[i].Check != findings[j].Check {
+			return findings[i].Check < findings[j].Check
+		}
+		return findings[i].Message < findings[j].Message
+	})
+	findings = slices.Compact(findings)
+	return
+}
+
+// Checks file content encoding and line endings
+func lintFileContent(repoFilePath string, content string) (findings []LintFinding) {
+	if !utf8.ValidString(content) {
+		findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "encoding", File: repoFilePath, Message: "content is not valid UTF-8"})
+	}
+	if strings.Contains(content, "\r\n") {
+		findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "line-endings", File: repoFilePath, Message: "content has CRLF line endings"})
+	}
+	return
+}
+
+// Checks directory metadata JSON and its file defaults
+func lintDirectoryMetadata(repoFilePath string, content string) (findings []LintFinding) {
+	var dirMetadata MetaHeader
+	err := json.Unmarshal([]byte(content), &dirMetadata)
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "metadata", File: repoFilePath, Message: fmt.Sprintf("invalid directory JSON metadata: %v", err)})
+		return
+	}
+
+	// Defaults-only metadata does not manage the directory itself
+	if dirMetadata.TargetFileOwnerGroup == "" && dirMetadata.TargetFilePermissions == nil && dirMetadata.FileDefaults != nil {
+		return
+	}
+	findings = append(findings, lintMetaHeader(repoFilePath, dirMetadata)...)
+	if len(findings) > 0 {
+		return
+	}
+	if dirMetadata.ManagedBlock != nil && *dirMetadata.ManagedBlock {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "metadata", File: repoFilePath, Message: "managed blocks are only supported in files"})
+	}
+	return
+}
+
+// Checks the metadata header of a file (or the directory file defaults it uses instead)
+// Defaults are looked up from the directories above headerFilePath (the file holding the header)
+func lintFileHeader(repoFilePath string, headerFilePath string, content string, tree *object.Tree, directoryDefaults map[string]*MetaHeader) (findings []LintFinding, err error) {
+	fileDefaults, defaultsFound, err := loadDirectoryDefaults(headerFilePath, tree, directoryDefaults)
+	if err != nil {
+		// Broken directory metadata is reported by itself
+		err = nil
+	}
+
+	jsonMetadata := fileDefaults
+	if strings.Contains(content, Delimiter) {
+		metadata, _, errLocal := extractMetadata(content)
+		if errLocal != nil {
+			findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "metadata", File: repoFilePath, Message: errLocal.Error()})
+			return
+		}
+
+		var header MetaHeader
+		errLocal = json.Unmarshal([]byte(metadata), &header)
+		if errLocal != nil {
+			findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "metadata", File: repoFilePath, Message: fmt.Sprintf("invalid JSON metadata header: %v", errLocal)})
+			return
+		}
+
+		// Empty lists only matter when removing inherited commands
+		if header.ReloadCommands != nil && len(header.ReloadCommands) == 0 && len(fileDefaults.ReloadCommands) == 0 {
+			findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "reload", File: repoFilePath, Message: "empty Reload array, remove it or add reload commands"})
+		}
+
+		jsonMetadata = mergeMetaHeaders(fileDefaults, header)
+	} else if !defaultsFound {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "metadata", File: repoFilePath, Message: "json start delimiter missing (no metadata header and no directory file defaults)"})
+		return
+	}
+
+	findings = append(findings, lintMetaHeader(repoFilePath, jsonMetadata)...)
+	return
+}
+
+// Validates metadata fields, reporting owner/group and permissions separately from the rest
+func lintMetaHeader(repoFilePath string, metadataHeader MetaHeader) (findings []LintFinding) {
+	err := validateOwnerGroup(metadataHeader.TargetFileOwnerGroup)
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "owner-group", File: repoFilePath, Message: err.Error()})
+	}
+	_, err = parseFilePermissions(metadataHeader.TargetFilePermissions)
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "permissions", File: repoFilePath, Message: err.Error()})
+	}
+	if len(findings) > 0 {
+		return
+	}
+
+	_, err = parseMetaHeader(metadataHeader)
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: lintSeverityError, Check: "metadata", File: repoFilePath, Message: err.Error()})
+	}
+	return
+}
+
+// Resolves a symbolic link target inside the repository (tree paths, not the working directory)
+// Links have to stay inside their own top-level directory
+func resolveRepoLinkTarget(linkPath string, linkText string) (targetPath string, err error) {
+	if path.IsAbs(linkText) {
+		err = fmt.Errorf("link target '%s' is absolute, links have to be relative inside the host directory", linkText)
+		return
+	}
+
+	targetPath = path.Join(path.Dir(linkPath), linkText)
+	linkTopLevelDir, _, _ := strings.Cut(linkPath, "/")
+	targetTopLevelDir, _, _ := strings.Cut(targetPath, "/")
+	if targetTopLevelDir != linkTopLevelDir || targetPath == linkTopLevelDir {
+		err = fmt.Errorf("cannot have symbolic link between host directories (target '%s')", targetPath)
+		return
+	}
+	return
+}
+
+// Finds universal files that every host using the directory overrides (never deployed)
+func lintShadowedUniversalFiles(universalFiles map[string]map[string]struct{}, deniedUniversalFiles map[string]map[string]struct{}) (findings []LintFinding) {
+	for groupName, groupFiles := range universalFiles {
+		var groupHosts []string
+		for endpointName, hostInfo := range config.HostInfo {
+			if groupName == config.UniversalDirectory {
+				if hostInfo.IgnoreUniversal {
+					continue
+				}
+			} else {
+				_, hostIsInGroup := hostInfo.UniversalGroups[groupName]
+				if !hostIsInGroup {
+					continue
+				}
+			}
+			groupHosts = append(groupHosts, endpointName)
+		}
+		if len(groupHosts) == 0 {
+			continue
+		}
+
+		for groupFile := range groupFiles {
+			// Directories are expected to be shared
+			if strings.HasSuffix(groupFile, directoryMetadataFileName) {
+				continue
+			}
+
+			universalFilePath := filepath.Join(groupName, groupFile)
+			var shadowingHosts int
+			for _, endpointName := range groupHosts {
+				_, fileIsDenied := deniedUniversalFiles[endpointName][universalFilePath]
+				if fileIsDenied {
+					shadowingHosts++
+				}
+			}
+			if shadowingHosts == len(groupHosts) {
+				findings = append(findings, LintFinding{Severity: lintSeverityWarning, Check: "shadowed-universal-file", File: universalFilePath, Message: fmt.Sprintf("all %d host(s) using '%s' override this file, it is never deployed", len(groupHosts), groupName)})
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,142 @@
+// controller
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveRepoLinkTarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		linkPath    string
+		linkText    string
+		expected    string
+		expectError bool
+	}{
+		{"Same directory", "web01/etc/nginx/sites-enabled/default", "../sites-available/default", "web01/etc/nginx/sites-available/default", false},
+		{"Sibling file", "web01/etc/localtime", "timezone", "web01/etc/timezone", false},
+		{"Absolute", "web01/etc/localtime", "/usr/share/zoneinfo/UTC", "", true},
+		{"Other host", "web01/etc/hosts", "../../db01/etc/hosts", "", true},
+		{"Repository root", "web01/etc", "..", "", true},
+		{"Above repository", "web01/hosts", "../../hosts", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath, err := resolveRepoLinkTarget(test.linkPath, test.linkText)
+			if (err != nil) != test.expectError {
+				t.Fatalf("resolveRepoLinkTarget() error = %v, expected error %v", err, test.expectError)
+			}
+			if !test.expectError && targetPath != test.expected {
+				t.Errorf("resolveRepoLinkTarget() = %q, expected %q", targetPath, test.expected)
+			}
+		})
+	}
+}
+
+func TestLintFileContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{"Clean", "key=value\n", nil},
+		{"CRLF", "key=value\r\n", []string{"line-endings"}},
+		{"Latin-1", "caf\xe9\n", []string{"encoding"}},
+		{"Both", "caf\xe9\r\n", []string{"encoding", "line-endings"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var checks []string
+			for _, finding := range lintFileContent("web01/etc/file", test.content) {
+				checks = append(checks, finding.Check)
+			}
+			if !reflect.DeepEqual(checks, test.expected) {
+				t.Errorf("lintFileContent() checks = %v, expected %v", checks, test.expected)
+			}
+		})
+	}
+}
+
+func TestLintMetaHeader(t *testing.T) {
+	badMarker := "# {mark}"
+	tests := []struct {
+		name     string
+		header   MetaHeader
+		expected []string
+	}{
+		{"Valid", MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644)}, nil},
+		{"Bad owner", MetaHeader{TargetFileOwnerGroup: "root", TargetFilePermissions: float64(644)}, []string{"owner-group"}},
+		{"Impossible mode", MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(698)}, []string{"permissions"}},
+		{"Bad owner and mode", MetaHeader{TargetFilePermissions: "99999"}, []string{"owner-group", "permissions"}},
+		{"Bad marker", MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), BlockMarker: &badMarker}, []string{"metadata"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var checks []string
+			for _, finding := range lintMetaHeader("web01/etc/file", test.header) {
+				checks = append(checks, finding.Check)
+			}
+			if !reflect.DeepEqual(checks, test.expected) {
+				t.Errorf("lintMetaHeader() checks = %v, expected %v", checks, test.expected)
+			}
+		})
+	}
+}
+
+func TestLintShadowedUniversalFiles(t *testing.T) {
+	// Mock Global
+	config = Config{
+		OSPathSeparator: "/",
+		HostInfo: map[string]EndpointInfo{
+			"web01":      {UniversalGroups: map[string]struct{}{"Web": {}}},
+			"web02":      {UniversalGroups: map[string]struct{}{"Web": {}}},
+			"isolated01": {IgnoreUniversal: true},
+		},
+		UniversalDirectory: "UniversalConfs",
+	}
+
+	universalFiles := map[string]map[string]struct{}{
+		"UniversalConfs": {
+			"etc/hosts":                              {},
+			"etc/motd":                               {},
+			"etc/issue":                              {},
+			"etc/nginx/" + directoryMetadataFileName: {},
+		},
+		"Web": {
+			"etc/nginx/nginx.conf": {},
+		},
+		"Unused": {
+			"etc/unused.conf": {},
+		},
+	}
+	deniedUniversalFiles := map[string]map[string]struct{}{
+		"web01": {
+			"UniversalConfs/etc/hosts":                              {},
+			"UniversalConfs/etc/motd":                               {},
+			"UniversalConfs/etc/nginx/" + directoryMetadataFileName: {},
+			"Web/etc/nginx/nginx.conf":                              {},
+		},
+		"web02": {
+			"UniversalConfs/etc/hosts":                              {},
+			"UniversalConfs/etc/nginx/" + directoryMetadataFileName: {},
+			"Web/etc/nginx/nginx.conf":                              {},
+		},
+		"isolated01": {},
+	}
+
+	shadowedFiles := make(map[string]struct{})
+	for _, finding := range lintShadowedUniversalFiles(universalFiles, deniedUniversalFiles) {
+		shadowedFiles[finding.File] = struct{}{}
+	}
+	expected := map[string]struct{}{
+		"UniversalConfs/etc/hosts": {},
+		"Web/etc/nginx/nginx.conf": {},
+	}
+	if !reflect.DeepEqual(shadowedFiles, expected) {
+		t.Errorf("lintShadowedUniversalFiles() = %v, expected %v", shadowedFiles, expected)
+	}
+}
@@ -2,13 +2,16 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -22,24 +25,28 @@ var config Config
 
 // Struct for global config
 type Config struct {
-	FilePath              string                  // Path to main config - ~/.ssh/config
-	FailTrackerFilePath   string                  // Path to failtracker file (within same directory as main config)
-	OSPathSeparator       string                  // Path separator for compiled OS filesystem
-	HostInfo              map[string]EndpointInfo // Hold some basic information about all the hosts
-	KnownHostsFilePath    string                  // Path to known server public keys - ~/.ssh/known_hosts
-	KnownHosts            []string                // Content of known server public keys - ~/.ssh/known_hosts
-	RepositoryPath        string                  // Absolute path to git repository (based on current working dir)
-	UniversalDirectory    string                  // Universal config directory inside git repo
-	AllUniversalGroups    map[string]struct{}     // Universal group config directory names
-	IgnoreDirectories     []string                // Directories to ignore inside the git repository
-	MaxSSHConcurrency     int                     // Maximum threads for ssh sessions
-	DisableSudo           bool                    // Disable using sudo for remote commands
-	AutoCommit            bool                    // When running with deploy-changes automatically commit any unstaged changes
-	AllowDeletions        bool                    // Allow deletions in local repo to delete files on remote hosts or vault entries
-	IgnoreDeploymentState bool                    // Ignore any deployment state for a host in the config
-	UserHomeDirectory     string                  // Absolute path to users home directory (to expand '~/' in paths)
-	VaultFilePath         string                  // Path to password vault file
-	Vault                 map[string]Credential   // Password vault
+	FilePath                  string                  // Path to main config - ~/.ssh/config
+	FailTrackerFilePath       string                  // Path to failtracker file (within same directory as main config)
+	OSPathSeparator           string                  // Path separator for compiled OS filesystem
+	HostInfo                  map[string]EndpointInfo // Hold some basic information about all the hosts
+	KnownHostsFilePath        string                  // Path to known server public keys - ~/.ssh/known_hosts
+	RepositoryPath            string                  // Absolute path to git repository (based on current working dir)
+	UniversalDirectory        string                  // Universal config directory inside git repo
+	AllUniversalGroups        map[string]struct{}     // Universal group config directory names
+	IgnoreDirectories         []string                // Directories to ignore inside the git repository
+	MaxSSHConcurrency         int                     // Maximum threads for ssh sessions
+	DisableSudo               bool                    // Disable using sudo for remote commands
+	AutoCommit                bool                    // When running with deploy-changes automatically commit any unstaged changes
+	AllowDeletions            bool                    // Allow deletions in local repo to delete files on remote hosts or vault entries
+	IgnoreDeploymentState     bool                    // Ignore any deployment state for a host in the config
+	UserHomeDirectory         string                  // Absolute path to users home directory (to expand '~/' in paths)
+	VaultFilePath             string                  // Path to password vault file
+	VaultIdentityFile         string                  // Path to private key used to unlock the vault as a recipient (instead of the vault password)
+	VaultPasswordCommand      string                  // Command whose stdout is the vault password
+	VaultPasswordFile         string                  // Path to file containing the vault password
+	VaultPasswordFileOverride string                  // Path to file containing the vault password (from arguments, takes precedence over config)
+	VaultPasswordFD           int                     // File descriptor to read the vault password from (from arguments, -1 when unset)
+	Vault                     map[string]Credential   // Password vault
 }
 
 // Struct for host-specific Information
@@ -53,41 +60,246 @@ type EndpointInfo struct {
 	Endpoint             string              // Address:port of the host
 	EndpointUser         string              // Login user name of the host
 	IdentityFile         string              // Key identity file path (private or public)
+	CertificateFile      string              // User certificate file path (optional, defaults to '<IdentityFile>-cert.pub' if present)
+	ProxyJump            []string            // Jump hosts to connect through, in order (configured host names or [user@]host[:port])
+	JumpHosts            []EndpointInfo      // Resolved jump hosts with their keys and passwords (filled with host secrets)
+	Options              SSHClientOptions    // Standard ssh_config client options
 	PrivateKey           ssh.Signer          // Actual private key contents
 	KeyAlgo              string              // Algorithm of the private key
-	Password             string              // Password for the EndpointUser
+	Password             []byte              // Password for the EndpointUser (wiped after use)
+	SudoPassword         []byte              // Password for sudo (same as login password unless vault has a separate sudo entry, wiped after use)
+	PrivilegeEscalation  string              // Method to run remote commands as root (config option "PrivilegeEscalation")
 	RemoteTransferBuffer string              // Temporary Buffer file that will be used to transfer local config to remote host prior to moving into place
 	RemoteBackupDir      string              // Temporary directory to store backups of existing remote configs while reloads are performed
 }
 
-// Struct for vault passwords
+// Struct for running remote commands with elevated privileges
+type PrivilegeEscalation struct {
+	Method   string // One of privilegeEscalationMethods
+	Password []byte // Password for the method (sudo password of the host, for su the target users password)
+}
+
+// Struct for standard ssh_config client options of a host
+type SSHClientOptions struct {
+	StrictHostKeyChecking    string        // yes, accept-new, no, or ask
+	ConnectTimeout           time.Duration // Timeout for connecting and handshake
+	ServerAliveInterval      time.Duration // Interval between keepalive requests (0 disables)
+	ServerAliveCountMax      int           // Unanswered keepalive requests before disconnecting
+	HostKeyAlgorithms        string        // Host key algorithm list (ssh_config syntax, applied to defaults when connecting)
+	Ciphers                  []string      // Empty uses defaults
+	KexAlgorithms            []string      // Empty uses defaults
+	MACs                     []string      // Empty uses defaults
+	PreferredAuthentications []string      // Authentication methods in order
+	OfferAgentKeys           bool          // Also offer all SSH agent keys (IdentitiesOnly no)
+	AddressFamily            string        // Network for dialing - tcp, tcp4, or tcp6
+}
+
+// Struct for a parsed known_hosts line
+type KnownHostEntry struct {
+	LineNumber int           // Line number in the known_hosts file
+	Marker     string        // Empty, 'cert-authority' or 'revoked'
+	Hosts      []string      // Host patterns (plain, wildcard, [host]:port, or hashed)
+	Key        ssh.PublicKey // Host or CA public key
+}
+
+// Struct for metadata of a remote path (from stat)
+type RemoteFileInfo struct {
+	Name        string    // Base name of the path
+	Exists      bool      // Path (or dangling symbolic link) is present
+	Type        string    // file, directory, symlink, fifo, socket, block, or character
+	Mode        uint32    // Raw st_mode including type and special bits
+	Permissions uint32    // Permission and special bits (Mode & 07777)
+	UID         int       // Numeric owner
+	GID         int       // Numeric group
+	Owner       string    // Owner name ('UNKNOWN' when the uid has no name)
+	Group       string    // Group name ('UNKNOWN' when the gid has no name)
+	Size        int64     // Size in bytes
+	ModTime     time.Time // Last modification time
+	LinkTarget  string    // Target of a symbolic link
+}
+
+// Struct for commands available on a remote host (detected once per host)
+type RemoteCapabilities struct {
+	BusyBox  bool                // Remote userland is BusyBox
+	SELinux  bool                // SELinux is enabled
+	Tools    map[string]string   // Resolved paths of tools found in the remote PATH
+	Commands map[string][]string // Invocation of each tool (like 'busybox stat' when only the applet exists)
+}
+
+// Struct for vault entries
+// Entries are keyed by '<type>/<name>' in the vault map
+// Values are kept as bytes so they can be wiped (stored as JSON strings 'value' and 'loginUserPassword' by encodeVaultEntries)
 type Credential struct {
-	LoginUserPassword string `json:"loginUserPassword"`
+	Value             []byte // Secret value for this entry
+	LoginUserPassword []byte // Legacy host login password (only read for migration)
+}
+
+// Vault entry types
+const (
+	vaultTypeLogin      string = "login"      // Login password for a host (name is the host)
+	vaultTypeSudo       string = "sudo"       // Sudo password for a host (name is the host)
+	vaultTypePassphrase string = "passphrase" // Passphrase for an encrypted SSH key (name is the IdentityFile path)
+	vaultTypeSecret     string = "secret"     // Arbitrary named secret
+	vaultTypeNote       string = "note"       // Free-form note
+)
+
+var vaultEntryTypes = []string{vaultTypeLogin, vaultTypeSudo, vaultTypePassphrase, vaultTypeSecret, vaultTypeNote}
+
+// Struct for on-disk vault file format
+// Version 1 (legacy) had no header and was only base64(salt+nonce+ciphertext)
+// Version 2 encrypted the contents directly with the password derived key
+// Version 3 encrypts the contents with a random data key that is wrapped for the password and/or each recipient
+type VaultFile struct {
+	Version    int                `json:"version"`
+	KDF        *KDFParams         `json:"kdf,omitempty"`      // Version 1/2 only
+	Password   *VaultPasswordSlot `json:"password,omitempty"` // Data key wrapped by the vault password (optional)
+	Recipients []VaultRecipient   `json:"recipients,omitempty"`
+	Nonce      string             `json:"nonce"`
+	CipherText string             `json:"cipherText"`
+}
+
+// Struct for the vault data key wrapped by the vault password
+type VaultPasswordSlot struct {
+	KDF        KDFParams `json:"kdf"`
+	Nonce      string    `json:"nonce"`
+	WrappedKey string    `json:"wrappedKey"`
+}
+
+// Struct for the vault data key wrapped for a public key recipient
+type VaultRecipient struct {
+	Type         string `json:"type"`      // Recipient key type (x25519 or ssh-ed25519)
+	PublicKey    string `json:"publicKey"` // Recipient public key in authorized key format (without comment)
+	Comment      string `json:"comment,omitempty"`
+	EphemeralKey string `json:"ephemeralKey,omitempty"` // X25519 public key used for this wrapping
+	WrappedKey   string `json:"wrappedKey,omitempty"`
+}
+
+// Struct for key material of an unlocked vault - kept while the vault is open so it can be locked again
+type VaultKey struct {
+	DataKey      []byte             // Random key that encrypts vault contents
+	Password     string             // Vault password (empty when unlocked by identity)
+	PasswordSlot *VaultPasswordSlot // Existing password slot, kept as-is when the password is not known
+	Recipients   []VaultRecipient   // Public keys that can unlock the vault
+}
+
+// Struct for a private key that can unlock the vault as a recipient
+type VaultIdentity struct {
+	Recipient  VaultRecipient // Matching recipient (public key) for this identity
+	PrivateKey []byte         // X25519 private scalar
+}
+
+// Struct for requests to the vault agent
+type VaultAgentRequest struct {
+	Action string `json:"action"` // get, status, or lock
+}
+
+// Struct for responses from the vault agent
+type VaultAgentResponse struct {
+	Error         string          `json:"error,omitempty"`
+	VaultFilePath string          `json:"vaultFilePath,omitempty"` // Vault file the agent holds
+	VaultHash     string          `json:"vaultHash,omitempty"`     // SHA256 of the vault file when the agent unlocked it
+	Vault         json.RawMessage `json:"vault,omitempty"`
+	Remaining     int             `json:"remaining,omitempty"` // Seconds until the agent locks from inactivity
+}
+
+// Vault agent actions
+const (
+	vaultAgentGet    string = "get"
+	vaultAgentStatus string = "status"
+	vaultAgentLock   string = "lock"
+)
+
+// Vault recipient types
+const (
+	vaultRecipientX25519     string = "x25519"
+	vaultRecipientSSHEd25519 string = "ssh-ed25519"
+)
+
+// Vault recipient key file prefixes for native X25519 keys
+const vaultX25519PublicPrefix string = "scmp-x25519"
+const vaultX25519SecretPrefix string = "SCMP-X25519-SECRET-KEY"
+
+// Struct for vault key derivation parameters
+type KDFParams struct {
+	Algorithm string `json:"algorithm"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"` // KiB
+	Threads   uint8  `json:"threads"`
+	KeyLength uint32 `json:"keyLength"`
+	Salt      string `json:"salt,omitempty"`
 }
 
+const vaultFormatVersion int = 3
+
+// KDF parameters for newly written vaults - raising these will upgrade existing vaults on next unlock
+var defaultKDFParams = KDFParams{Algorithm: "argon2id", Time: 3, Memory: 64 * 1024, Threads: 4, KeyLength: 32}
+
+// KDF parameters used by the legacy (version 1) vault format
+var legacyKDFParams = KDFParams{Algorithm: "argon2id", Time: 1, Memory: 64 * 1024, Threads: 4, KeyLength: 32}
+
 // Struct for metadata json in config files
 type MetaHeader struct {
-	TargetFileOwnerGroup  string   `json:"FileOwnerGroup"`
-	TargetFilePermissions int      `json:"FilePermissions"`
-	CheckCommands         []string `json:"Checks,omitempty"`
-	ReloadCommands        []string `json:"Reload,omitempty"`
+	TargetFileOwnerGroup  string      `json:"FileOwnerGroup"`
+	TargetFilePermissions any         `json:"FilePermissions"`          // Octal mode as number (640) or string ("0640", "2755")
+	TargetSELinuxContext  *string     `json:"SELinuxContext,omitempty"` // Applied with chcon (restorecon when unset, "" overrides directory defaults)
+	TargetACL             []string    `json:"ACL,omitempty"`            // Named/default POSIX ACL entries (unmanaged when absent)
+	TargetAttributes      *string     `json:"Attributes,omitempty"`     // chattr attributes like "i" (unmanaged when absent)
+	ManagedBlock          *bool       `json:"ManagedBlock,omitempty"`   // Content is a block inside the remote file instead of the whole file (false overrides directory defaults)
+	BlockMarker           *string     `json:"BlockMarker,omitempty"`    // Comment line around the block ({mark} becomes BEGIN/END, "" is the default marker)
+	CheckCommands         []string    `json:"Checks,omitempty"`
+	ReloadCommands        []string    `json:"Reload,omitempty"`
+	LocalCheckCommands    []string    `json:"LocalCheck,omitempty"`   // Run on the controller against the file content ('%s' is the file path)
+	FileDefaults          *MetaHeader `json:"FileDefaults,omitempty"` // Directory metadata only: inherited by files beneath the directory
 }
 
 const Delimiter string = "#|^^^|#"
 
+// Directory name suffix for fragments that are assembled into one file (like etc/sudoers.frag.d/10-base)
+const fragmentDirSuffix string = ".frag.d"
+
+// File name suffix for host patch overlays on universal files (like etc/ntp.conf.patch)
+const patchFileSuffix string = ".patch"
+
+// Marker lines around managed blocks when metadata does not set one
+const defaultBlockMarker string = "# {mark} SCMP MANAGED BLOCK"
+
+// Maximum run time of each metadata LocalCheck command
+const localCheckTimeout time.Duration = 60 * time.Second
+
 // Struct for all deployment info for a file
 type CommitFileInfo struct {
 	Data            string
 	Hash            string
 	Action          string
 	FileOwnerGroup  string
-	FilePermissions int
+	FilePermissions uint32   // Octal mode including special bits
+	SELinuxContext  string   // Empty means default context (restorecon)
+	ACL             []string // Normalized entries (nil when unmanaged)
+	Attributes      *string  // Normalized chattr attributes (nil when unmanaged)
+	BlockMarker     string   // Data is a block between these markers (empty when whole file is managed)
 	ChecksRequired  bool
 	Checks          []string
 	ReloadRequired  bool
 	Reload          []string
 }
 
+// Host patch overlay and the universal file it applies to
+type PatchOverlay struct {
+	BaseFilePath  string // Universal or group repository file
+	PatchFilePath string // Host repository unified diff
+}
+
+// Repository lint finding (printed as one JSON line)
+type LintFinding struct {
+	Severity string `json:"severity"` // error or warning
+	Check    string `json:"check"`
+	File     string `json:"file,omitempty"`
+	Message  string `json:"message"`
+}
+
+const lintSeverityError string = "error"
+const lintSeverityWarning string = "warning"
+
 // Fail tracker json line format
 type ErrorInfo struct {
 	EndpointName string   `json:"endpointName"`
@@ -102,6 +314,11 @@ var SHA256RegEx *regexp.Regexp // for validating hashes received from remote hos
 var SHA1RegEx *regexp.Regexp   // for validating user supplied commit hashes
 var dryRunRequested bool       // for printing relevant information and bailing out before outbound remote connections are made
 
+// Vault password resolved once per run (fd and environment sources can only be read once)
+var cachedVaultPassword string
+var cachedVaultPasswordSource string
+var cachedVaultPasswordOverridden bool
+
 // Integer for printing increasingly detailed information as program progresses
 //
 //	0 - None: quiet (prints nothing but errors)
@@ -128,12 +345,70 @@ const directoryMetadataFileName string = ".directory_metadata_information.json"
 const autoCommitUserName string = "SCMPController"
 const autoCommitUserEmail string = "scmpc@localhost"
 const environmentUnknownSSHHostKey string = "UnknownSSHHostKeyAction"
+const environmentVaultPassword string = "SCMPVaultPassword"
+const vaultAgentSocketName string = "scmpc-vault-agent.sock"
 
 // #### Written to in other functions - use mutex
 
 // Global for checking remote hosts keys
 var addAllUnknownHosts bool
 var KnownHostMutex sync.Mutex
+var knownHostsCallback ssh.HostKeyCallback // Parsed known_hosts file (reloaded after writes)
+
+// Host certificate algorithm for each host key algorithm
+var hostCertificateAlgorithms = map[string]string{
+	ssh.KeyAlgoED25519:  ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256: ssh.CertAlgoECDSA256v01,
+	ssh.KeyAlgoECDSA384: ssh.CertAlgoECDSA384v01,
+	ssh.KeyAlgoECDSA521: ssh.CertAlgoECDSA521v01,
+	ssh.KeyAlgoRSA:      ssh.CertAlgoRSASHA512v01,
+}
+
+// Authentication methods in default order
+var defaultAuthenticationMethods = []string{"publickey", "keyboard-interactive", "password"}
+
+// Supported privilege escalation methods (first is the default)
+var privilegeEscalationMethods = []string{"sudo", "doas", "su", "run0", "pkexec", "none"}
+
+// Shell words that never need quoting
+var shellSafeWordRegEx = regexp.MustCompile(`^[A-Za-z0-9_@%+:,./-]+$`)
+
+// Password prompts of privilege escalation methods that only read passwords from a terminal
+var passwordPromptRegEx = regexp.MustCompile(`(?i)(password|passphrase)[^\n]*:[ \t]*$`)
+
+// Serializes prompts on the terminal between concurrent host connections
+var TerminalPromptMutex sync.Mutex
+
+// Resolved addresses of host names (key is network and host name)
+var resolvedAddresses = make(map[string][]net.IP)
+var ResolvedAddressesMutex sync.Mutex
+
+// Remote stat output format (raw hex mode, uid, gid, size, mtime, owner name, group name)
+// Fields are separated by tabs, owner and group names can contain spaces (e.g. 'domain users') but never tabs
+// Directory listings append the path (it can contain tabs, so it is last)
+const remoteStatFormat string = "%f\t%u\t%g\t%s\t%Y\t%U\t%G"
+
+// Tools looked up on remote hosts during capability detection
+var remoteCapabilityTools = []string{"sh", "stat", "find", "readlink", "od", "sha256sum", "sha256", "openssl", "busybox", "sudo", "doas", "su", "run0", "pkexec", "getfacl", "setfacl", "lsattr", "chattr", "chcon", "restorecon"}
+
+// File attributes that can be set with chattr (others like 'e' are managed by the filesystem)
+const managedFileAttributes string = "aAcCdDijmPsStTux"
+
+// Detected remote capabilities (key is host name)
+var remoteCapabilities = make(map[string]RemoteCapabilities)
+var RemoteCapabilitiesMutex sync.Mutex
+
+// Maximum nesting of config Include directives
+const maxConfigIncludeDepth int = 5
+
+// Host key types retrieved when scanning hosts for known_hosts
+var knownHostsScanAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+}
 
 // Used for metrics - counting post deployment
 var postDeployedConfigs int
@@ -146,6 +421,13 @@ const FailTrackerFile string = ".scmp-failtracker.json"
 var FailTracker string
 var FailTrackerMutex sync.Mutex
 
+// Known secret values that are masked in all output (printed, journald, failtracker)
+var redactionSecrets [][]byte
+var RedactionMutex sync.RWMutex
+
+const redactedPlaceholder string = "[REDACTED]"
+const minimumRedactionLength int = 4 // Shorter secrets would mask unrelated output
+
 // Program Meta Info
 const progCLIHeader string = "==== Secure Configuration Management Program ===="
 const progVersion string = "v3.6.3"
@@ -178,6 +460,29 @@ Options:
                                                  [default: 10] (1 disables concurrency)
   -p, --modify-vault-password <host>             Create/Change/Delete a hosts password in the
                                                  vault (will create the vault if it doesn't exist)
+      --vault-list                               List all entries in the vault
+      --vault-get <type/name>                    Show a vault entry (value is masked)
+      --vault-reveal                             Show the unmasked value with '--vault-get'
+      --vault-set <type/name>                    Create/Change a vault entry
+                                                 Types: login, sudo, passphrase, secret, note
+      --vault-rename <type/old>,<type/new>       Rename a vault entry
+      --vault-delete <type/name>                 Delete a vault entry
+      --rekey-vault                              Change the vault master password
+                                                 (previous vault is kept as '<vault>.rekey-<time>.bak')
+      --vault-list-recipients                    List public keys that can unlock the vault
+      --vault-add-recipient <pubkey|file>        Allow a public key to unlock the vault
+                                                 Types: ssh-ed25519, scmp-x25519
+      --vault-remove-recipient <pubkey|comment>  Remove a public key from the vault (rotates the
+                                                 data key), use 'password' to remove the password
+      --vault-keygen </path/to/identity>         Generate a new X25519 vault identity key pair
+      --vault-password-file </path/to/file>      Read the vault password from a file
+      --vault-password-fd <number>               Read the vault password from an open file descriptor
+      --vault-agent-start <idle-timeout>         Unlock the vault and keep it in a background agent
+                                                 until idle for the given time (like '15m')
+      --vault-agent-status                       Show the vault agent remaining lifetime
+      --vault-agent-lock                         Lock the vault agent immediately
+      --known-hosts <list|remove|rotate|scan>    Manage known_hosts entries of hosts selected by
+                                                 '--remote-hosts' (list and scan default to all hosts)
   -n, --new-repo </path/to/repo>:<branch>        Create a new repository at the given path
                                                  with the given initial branch name
   -s, --seed-repo                                Retrieve existing files from remote hosts to
@@ -185,8 +490,8 @@ Options:
       --commit-changes                           Automatically commit any unstaged changes to the repository
                                                  Only applies to '--deploy-changes' argument (dry-run will not work)
       --allow-deletions                          Allows deletions (remote files or vault entires)
-                                                 Only applies to '--deploy-changes' or '--modify-vault-password'
-      --disable-privilege-escalation             Disables use of sudo when executing commands remotely
+                                                 Only applies to '--deploy-changes' or vault modifications
+      --disable-privilege-escalation             Disables sudo/doas/su (PrivilegeEscalation) when executing commands remotely
                                                  All commands will be run as the login user
       --ignore-deployment-state                  Ignores the current deployment state in the configuration file
                                                  For example, will deploy to a host marked as offline
@@ -194,8 +499,14 @@ Options:
                                                  post-commit hook for the current repository
   -G, --enable-git-hook                          Enables the automatic deployment git
                                                  post-commit hook for the current repository
+      --disable-validation-hooks                 Disables the git pre-commit and pre-push hooks
+                                                 for the current repository
+      --enable-validation-hooks                  Enables git pre-commit and pre-push hooks that reject
+                                                 commits and pushes with invalid files (no rollback)
   -t, --test-config                              Test controller configuration syntax
                                                  and configuration option validity
+      --lint [commit]                            Check all repository files and report every problem
+                                                 as JSON lines [commit default: head]
   -v, --verbose <0...5>                          Increase details and frequency of progress messages
                                                  (Higher is more verbose) [default: 1]
   -h, --help                                     Show this help menu
@@ -222,11 +533,31 @@ func main() {
 	var remoteFileOverride string
 	var localFileOverride string
 	var modifyVaultHost string
+	var vaultListRequested bool
+	var vaultGetEntry string
+	var vaultRevealRequested bool
+	var vaultSetEntry string
+	var vaultRenameEntry string
+	var vaultDeleteEntry string
+	var rekeyVaultRequested bool
+	var vaultListRecipientsRequested bool
+	var vaultAddRecipient string
+	var vaultRemoveRecipient string
+	var vaultKeygenPath string
+	var vaultAgentStartTimeout string
+	var vaultAgentStatusRequested bool
+	var vaultAgentLockRequested bool
+	var vaultAgentDaemonTimeout string
+	var knownHostsAction string
 	var testConfig bool
+	var lintRequested bool
 	var createNewRepo string
 	var seedRepoFiles bool
 	var disableGitHook bool
 	var enableGitHook bool
+	var disableValidationHooks bool
+	var enableValidationHooks bool
+	var validateHookName string
 	var installAAProf bool
 	var installDefaultConfig bool
 	var versionInfoRequested bool
@@ -253,12 +584,30 @@ func main() {
 	flag.StringVar(&localFileOverride, "local-files", "", "")
 	flag.BoolVar(&testConfig, "t", false, "")
 	flag.BoolVar(&testConfig, "test-config", false, "")
+	flag.BoolVar(&lintRequested, "lint", false, "")
 	flag.BoolVar(&dryRunRequested, "T", false, "")
 	flag.BoolVar(&dryRunRequested, "dry-run", false, "")
 	flag.IntVar(&config.MaxSSHConcurrency, "m", 10, "")
 	flag.IntVar(&config.MaxSSHConcurrency, "max-conns", 10, "")
 	flag.StringVar(&modifyVaultHost, "p", "", "")
 	flag.StringVar(&modifyVaultHost, "modify-vault-password", "", "")
+	flag.BoolVar(&vaultListRequested, "vault-list", false, "")
+	flag.StringVar(&vaultGetEntry, "vault-get", "", "")
+	flag.BoolVar(&vaultRevealRequested, "vault-reveal", false, "")
+	flag.StringVar(&vaultSetEntry, "vault-set", "", "")
+	flag.StringVar(&vaultRenameEntry, "vault-rename", "", "")
+	flag.StringVar(&vaultDeleteEntry, "vault-delete", "", "")
+	flag.BoolVar(&rekeyVaultRequested, "rekey-vault", false, "")
+	flag.BoolVar(&vaultListRecipientsRequested, "vault-list-recipients", false, "")
+	flag.StringVar(&vaultAddRecipient, "vault-add-recipient", "", "")
+	flag.StringVar(&vaultRemoveRecipient, "vault-remove-recipient", "", "")
+	flag.StringVar(&vaultKeygenPath, "vault-keygen", "", "")
+	flag.StringVar(&config.VaultPasswordFileOverride, "vault-password-file", "", "")
+	flag.IntVar(&config.VaultPasswordFD, "vault-password-fd", -1, "")
+	flag.StringVar(&vaultAgentStartTimeout, "vault-agent-start", "", "")
+	flag.BoolVar(&vaultAgentStatusRequested, "vault-agent-status", false, "")
+	flag.BoolVar(&vaultAgentLockRequested, "vault-agent-lock", false, "")
+	flag.StringVar(&knownHostsAction, "known-hosts", "", "")
 	flag.StringVar(&createNewRepo, "n", "", "")
 	flag.StringVar(&createNewRepo, "new-repo", "", "")
 	flag.BoolVar(&seedRepoFiles, "s", false, "")
@@ -271,6 +620,8 @@ func main() {
 	flag.BoolVar(&disableGitHook, "disable-git-hook", false, "")
 	flag.BoolVar(&enableGitHook, "G", false, "")
 	flag.BoolVar(&enableGitHook, "enable-git-hook", false, "")
+	flag.BoolVar(&disableValidationHooks, "disable-validation-hooks", false, "")
+	flag.BoolVar(&enableValidationHooks, "enable-validation-hooks", false, "")
 	flag.BoolVar(&versionInfoRequested, "V", false, "")
 	flag.BoolVar(&versionInfoRequested, "version", false, "")
 	flag.BoolVar(&versionRequested, "versionid", false, "")
@@ -279,8 +630,10 @@ func main() {
 
 	// Undocumented internal use only
 	flag.BoolVar(&CalledByGitHook, "git-hook-mode", false, "")               // Differentiate between user using deploy-changes and the git hook using deploy-changes
+	flag.StringVar(&validateHookName, "validate-hook", "", "")               // Validate staged files (pre-commit) or pushed commits (pre-push) when called by the git hook
 	flag.BoolVar(&installDefaultConfig, "install-default-config", false, "") // Install the sample config file if it doesn't exist
 	flag.BoolVar(&installAAProf, "install-apparmor-profile", false, "")      // Install the profile if system supports it
+	flag.StringVar(&vaultAgentDaemonTimeout, "vault-agent-daemon", "", "")   // Run as the background vault agent (started by --vault-agent-start)
 
 	// Custom help menu
 	flag.Usage = func() { fmt.Printf("Usage: %s [OPTIONS]...\n%s", os.Args[0], usage) }
@@ -318,6 +671,9 @@ func main() {
 	err := parseConfig()
 	logError("Error in controller configuration", err, true)
 
+	// Vault values are wiped when the run finishes normally
+	defer wipeVault()
+
 	// Retrieve any files specified by URI by override arguments
 	hostOverride, err = retrieveURIFile(hostOverride)
 	logError("Failed to parse remove-hosts URI", err, true)
@@ -334,10 +690,68 @@ func main() {
 	} else if modifyVaultHost != "" {
 		err = modifyVault(modifyVaultHost)
 		logError("Error modifying vault", err, false)
+	} else if vaultListRequested {
+		err = listVaultEntries()
+		logError("Error listing vault entries", err, false)
+	} else if vaultGetEntry != "" {
+		err = getVaultEntry(vaultGetEntry, vaultRevealRequested)
+		logError("Error retrieving vault entry", err, false)
+	} else if vaultSetEntry != "" {
+		err = setVaultEntry(vaultSetEntry)
+		logError("Error modifying vault", err, false)
+	} else if vaultRenameEntry != "" {
+		err = renameVaultEntry(vaultRenameEntry)
+		logError("Error renaming vault entry", err, false)
+	} else if vaultDeleteEntry != "" {
+		err = deleteVaultEntry(vaultDeleteEntry)
+		logError("Error deleting vault entry", err, false)
+	} else if rekeyVaultRequested {
+		err = rekeyVault()
+		logError("Error changing vault password", err, false)
+	} else if vaultListRecipientsRequested {
+		err = listVaultRecipients()
+		logError("Error listing vault recipients", err, false)
+	} else if vaultAddRecipient != "" {
+		err = addVaultRecipient(vaultAddRecipient)
+		logError("Error adding vault recipient", err, false)
+	} else if vaultRemoveRecipient != "" {
+		err = removeVaultRecipient(vaultRemoveRecipient)
+		logError("Error removing vault recipient", err, false)
+	} else if vaultKeygenPath != "" {
+		err = generateVaultIdentity(vaultKeygenPath)
+		logError("Error generating vault identity", err, false)
+	} else if vaultAgentStartTimeout != "" {
+		err = startVaultAgent(vaultAgentStartTimeout)
+		logError("Error starting vault agent", err, false)
+	} else if vaultAgentDaemonTimeout != "" {
+		err = runVaultAgent(vaultAgentDaemonTimeout)
+		logError("Vault agent error", err, false)
+	} else if vaultAgentStatusRequested {
+		err = showVaultAgentStatus()
+		logError("Error retrieving vault agent status", err, false)
+	} else if vaultAgentLockRequested {
+		err = lockVaultAgent()
+		logError("Error locking vault agent", err, false)
+	} else if knownHostsAction != "" {
+		err = manageKnownHosts(knownHostsAction, hostOverride)
+		logError("Error managing known_hosts", err, false)
+	} else if lintRequested {
+		if commitID == "" {
+			commitID = flag.Arg(0)
+		}
+		lintRepository(commitID)
 	} else if disableGitHook {
-		toggleGitHook("disable")
+		toggleGitHook("disable", "post-commit")
 	} else if enableGitHook {
-		toggleGitHook("enable")
+		toggleGitHook("enable", "post-commit")
+	} else if disableValidationHooks {
+		toggleGitHook("disable", "pre-commit")
+		toggleGitHook("disable", "pre-push")
+	} else if enableValidationHooks {
+		toggleGitHook("enable", "pre-commit")
+		toggleGitHook("enable", "pre-push")
+	} else if validateHookName != "" {
+		validateGitHook(validateHookName)
 	} else if deployChangesRequested {
 		preDeployment("deployChanges", commitID, hostOverride, localFileOverride)
 	} else if deployAllRequested {
@@ -2,14 +2,20 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
 
@@ -31,7 +37,65 @@ func printMessage(requiredVerbosityLevel int, message string, vars ...interface{
 
 	// Required stdout message verbosity level is equal to or less than global verbosity level
 	if requiredVerbosityLevel <= globalVerbosityLevel {
-		fmt.Printf(message, vars...)
+		fmt.Print(redactSecrets(fmt.Sprintf(message, vars...)))
+	}
+}
+
+// Adds a secret value to the list of values masked in all output
+// Stores a copy so callers can wipe their own buffer
+// Secrets shorter than minimumRedactionLength are never masked
+func registerSecret(secret []byte) {
+	if len(secret) == 0 {
+		return
+	}
+	if len(secret) < minimumRedactionLength {
+		printMessage(VerbosityProgress, "Warning: secret shorter than %d characters will not be masked in output\n", minimumRedactionLength)
+		return
+	}
+
+	RedactionMutex.Lock()
+	defer RedactionMutex.Unlock()
+
+	for _, knownSecret := range redactionSecrets {
+		if bytes.Equal(knownSecret, secret) {
+			return
+		}
+	}
+	redactionSecrets = append(redactionSecrets, append([]byte{}, secret...))
+
+	// Longest first so a secret containing another secret is fully masked
+	sort.Slice(redactionSecrets, func(i, j int) bool {
+		return len(redactionSecrets[i]) > len(redactionSecrets[j])
+	})
+}
+
+// Replaces all known secret values in text with a placeholder
+func redactSecrets(text string) (redactedText string) {
+	RedactionMutex.RLock()
+	defer RedactionMutex.RUnlock()
+
+	if len(redactionSecrets) == 0 {
+		redactedText = text
+		return
+	}
+
+	textBytes := []byte(text)
+	for _, secret := range redactionSecrets {
+		textBytes = bytes.ReplaceAll(textBytes, secret, []byte(redactedPlaceholder))
+	}
+	redactedText = string(textBytes)
+	return
+}
+
+// Wipes retrieved passwords for all hosts once connections are finished
+// Copies kept for redaction stay for the whole run so later errors and summaries are still masked
+func wipeHostSecrets() {
+	for endpointName, hostInfo := range config.HostInfo {
+		wipeBytes(hostInfo.Password)
+		wipeBytes(hostInfo.SudoPassword)
+		hostInfo.Password = nil
+		hostInfo.SudoPassword = nil
+		config.HostInfo[endpointName] = hostInfo
 	}
 }
 
@@ -56,6 +120,13 @@ func parseConfig() (err error) {
 	}
 	sshConfigContents := string(sshConfigFile)
 
+	// Insert contents of included config files
+	sshConfigContents, err = expandConfigIncludes(sshConfigContents, filepath.Dir(configAbsolutePath), 0)
+	if err != nil {
+		err = fmt.Errorf("failed processing config includes: %v", err)
+		return
+	}
+
 	// Retrieve SSH Config file options
 	sshConfig, err := ssh_config.Decode(strings.NewReader(sshConfigContents))
 	if err != nil {
@@ -94,16 +165,12 @@ func parseConfig() (err error) {
 		return
 	}
 
-	// Read in file
-	knownHostFile, err := os.ReadFile(config.KnownHostsFilePath)
+	// Parse all known_hosts entries
+	err = loadKnownHosts()
 	if err != nil {
-		err = fmt.Errorf("unable to read known_hosts file: %v", err)
 		return
 	}
 
-	// Store all known_hosts as array
-	config.KnownHosts = strings.Split(string(knownHostFile), "\n")
-
 	// All config dir names in repo
 	config.UniversalDirectory, _ = sshConfig.Get("", "UniversalDirectory")
 	if strings.Contains(config.UniversalDirectory, config.OSPathSeparator) {
@@ -131,6 +198,15 @@ func parseConfig() (err error) {
 	vaultRelPath, _ := sshConfig.Get("", "PasswordVault")
 	config.VaultFilePath = expandHomeDirectory(vaultRelPath)
 
+	// Private key to unlock vault as a recipient
+	vaultIdentityRelPath, _ := sshConfig.Get("", "VaultIdentityFile")
+	config.VaultIdentityFile = expandHomeDirectory(vaultIdentityRelPath)
+
+	// Non-interactive vault password sources
+	config.VaultPasswordCommand, _ = sshConfig.Get("", "VaultPasswordCommand")
+	vaultPasswordRelPath, _ := sshConfig.Get("", "VaultPasswordFile")
+	config.VaultPasswordFile = expandHomeDirectory(vaultPasswordRelPath)
+
 	// Initialize vault map
 	config.Vault = make(map[string]Credential)
 
@@ -152,20 +228,8 @@ func parseConfig() (err error) {
 
 	// Array of Hosts and their info
 	config.HostInfo = make(map[string]EndpointInfo)
-	var hostInfo EndpointInfo
-	for _, host := range sshConfig.Hosts {
-		// Skip host patterns with more than one pattern
-		if len(host.Patterns) != 1 {
-			continue
-		}
-
-		// Convert host pattern to string
-		hostPattern := host.Patterns[0].String()
-
-		// If a wildcard pattern, skip
-		if strings.Contains(hostPattern, "*") {
-			continue
-		}
+	for _, hostPattern := range configHostNames(sshConfig) {
+		var hostInfo EndpointInfo
 
 		printMessage(VerbosityData, "  Host: %s\n", hostPattern)
 
@@ -179,13 +243,17 @@ func parseConfig() (err error) {
 
 		printMessage(VerbosityData, "    Retrieving Address\n")
 
-		// First item must be present
+		// First item must be present (%h is replaced with the host name, for wildcard blocks)
 		endpointAddr, _ := sshConfig.Get(hostPattern, "Hostname")
+		endpointAddr = strings.ReplaceAll(endpointAddr, "%h", hostPattern)
 
 		printMessage(VerbosityData, "    Retrieving Port\n")
 
 		// Get port from endpoint
 		endpointPort, _ := sshConfig.Get(hostPattern, "Port")
+		if endpointPort == "" {
+			endpointPort = "22"
+		}
 
 		// Network Address Parsing - only if address
 		if endpointAddr != "" && endpointPort != "" {
@@ -203,6 +271,28 @@ func parseConfig() (err error) {
 		// Get identity file path
 		hostInfo.IdentityFile, _ = sshConfig.Get(hostPattern, "IdentityFile")
 
+		// Get user certificate file path
+		hostInfo.CertificateFile, _ = sshConfig.Get(hostPattern, "CertificateFile")
+
+		printMessage(VerbosityData, "    Retrieving SSH Client Options\n")
+
+		// Get standard ssh_config options
+		hostInfo.Options, err = parseSSHClientOptions(sshConfig, hostPattern)
+		if err != nil {
+			err = fmt.Errorf("host %s: %v", hostPattern, err)
+			return
+		}
+
+		printMessage(VerbosityData, "    Retrieving Jump Hosts\n")
+
+		// Get jump hosts chain
+		proxyJump, _ := sshConfig.Get(hostPattern, "ProxyJump")
+		hostInfo.ProxyJump, err = parseProxyJump(proxyJump)
+		if err != nil {
+			err = fmt.Errorf("host %s: invalid ProxyJump: %v", hostPattern, err)
+			return
+		}
+
 		printMessage(VerbosityData, "    Retrieving Remote Temp Dirs\n")
 
 		// Save remote transfer buffer and backup dir into host info map
@@ -236,6 +326,18 @@ func parseConfig() (err error) {
 			hostInfo.UniversalGroups[universalGroup] = struct{}{}
 		}
 
+		printMessage(VerbosityData, "    Retrieving Privilege Escalation Method\n")
+
+		// Method for running remote commands as root
+		hostInfo.PrivilegeEscalation, _ = sshConfig.Get(hostPattern, "PrivilegeEscalation")
+		hostInfo.PrivilegeEscalation = strings.ToLower(hostInfo.PrivilegeEscalation)
+		if hostInfo.PrivilegeEscalation == "" {
+			hostInfo.PrivilegeEscalation = privilegeEscalationMethods[0]
+		} else if !slices.Contains(privilegeEscalationMethods, hostInfo.PrivilegeEscalation) {
+			err = fmt.Errorf("host %s: invalid PrivilegeEscalation '%s' (valid: %s)", hostPattern, hostInfo.PrivilegeEscalation, strings.Join(privilegeEscalationMethods, ", "))
+			return
+		}
+
 		printMessage(VerbosityData, "    Retrieving if host requires vault password\n")
 
 		// Create list of hosts that would need vault access
@@ -255,6 +357,103 @@ func parseConfig() (err error) {
 	return
 }
 
+// Replaces Include directives with the contents of the matching files (globs allowed, relative to the including file)
+// Host context of the including file is restored after each include like OpenSSH does
+func expandConfigIncludes(configContents string, configDirectory string, depth int) (expandedContents string, err error) {
+	if depth > maxConfigIncludeDepth {
+		err = fmt.Errorf("include nesting deeper than %d levels (recursive Include?)", maxConfigIncludeDepth)
+		return
+	}
+
+	var expandedLines []string
+	currentHostLine := "Host *"
+	for _, line := range strings.Split(configContents, "\n") {
+		keyword, arguments := splitConfigLine(line)
+
+		if strings.EqualFold(keyword, "Host") || strings.EqualFold(keyword, "Match") {
+			currentHostLine = strings.TrimSpace(line)
+		}
+		if !strings.EqualFold(keyword, "Include") {
+			expandedLines = append(expandedLines, line)
+			continue
+		}
+
+		for _, includePattern := range strings.Fields(arguments) {
+			includePattern = expandHomeDirectory(strings.Trim(includePattern, `"`))
+			if !filepath.IsAbs(includePattern) {
+				includePattern = filepath.Join(configDirectory, includePattern)
+			}
+
+			// Like OpenSSH, patterns without matches are ignored
+			var includeFiles []string
+			includeFiles, err = filepath.Glob(includePattern)
+			if err != nil {
+				err = fmt.Errorf("invalid include pattern '%s': %v", includePattern, err)
+				return
+			}
+
+			for _, includeFile := range includeFiles {
+				printMessage(VerbosityData, "  Including config file %s\n", includeFile)
+
+				var includeContents []byte
+				includeContents, err = os.ReadFile(includeFile)
+				if err != nil {
+					err = fmt.Errorf("reading included config failed: %v", err)
+					return
+				}
+
+				var expandedInclude string
+				expandedInclude, err = expandConfigIncludes(string(includeContents), filepath.Dir(includeFile), depth+1)
+				if err != nil {
+					err = fmt.Errorf("%s: %v", includeFile, err)
+					return
+				}
+				expandedLines = append(expandedLines, expandedInclude, currentHostLine)
+			}
+		}
+	}
+
+	expandedContents = strings.Join(expandedLines, "\n")
+	return
+}
+
+// Splits a config line into its keyword and arguments ('Keyword value' or 'Keyword=value')
+func splitConfigLine(line string) (keyword string, arguments string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	keywordEnd := strings.IndexAny(line, " \t=")
+	if keywordEnd == -1 {
+		keyword = line
+		return
+	}
+	keyword = line[:keywordEnd]
+	arguments = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[keywordEnd:]), "="))
+	return
+}
+
+// Retrieves the names of all hosts in the config (every non-wildcard, non-negated Host pattern)
+// Hosts named in more than one block are only returned once, settings of all matching blocks apply
+func configHostNames(sshConfig *ssh_config.Config) (hostNames []string) {
+	for _, host := range sshConfig.Hosts {
+		for _, pattern := range host.Patterns {
+			hostName := pattern.String()
+
+			// Wildcard blocks only provide settings, and negated patterns never match their own name
+			if strings.ContainsAny(hostName, "*?") || !host.Matches(hostName) {
+				continue
+			}
+
+			if !slices.Contains(hostNames, hostName) {
+				hostNames = append(hostNames, hostName)
+			}
+		}
+	}
+	return
+}
+
 func retrieveGitRepoPath() (err error) {
 	printMessage(VerbosityProgress, "Retrieving repository file path\n")
 
@@ -279,11 +478,12 @@ func retrieveGitRepoPath() (err error) {
 	return
 }
 
-// Enables or disables git post-commit hook by moving the post-commit file
+// Enables or disables a git hook by moving the hook file
 // Takes 'enable' or 'disable' as toggle action
-func toggleGitHook(toggleAction string) {
+// Enabling installs the hook if the repository does not have it yet
+func toggleGitHook(toggleAction string, hookName string) {
 	// Path to enabled/disabled git hook files
-	enabledGitHookFile := filepath.Join(config.RepositoryPath, ".git", "hooks", "post-commit")
+	enabledGitHookFile := filepath.Join(config.RepositoryPath, ".git", "hooks", hookName)
 	disabledGitHookFile := enabledGitHookFile + ".disabled"
 
 	// Determine how to move file
@@ -304,14 +504,19 @@ func toggleGitHook(toggleAction string) {
 
 	// Move src to dst only if dst isn't present
 	if os.IsNotExist(err) {
-		err = os.Rename(srcFile, dstFile)
+		_, err = os.Stat(srcFile)
+		if os.IsNotExist(err) && toggleAction == "enable" {
+			err = writeGitHook(dstFile, hookName)
+		} else {
+			err = os.Rename(srcFile, dstFile)
+		}
 	}
 
 	// Show progress to user depending on error presence
 	if err != nil {
-		logError(fmt.Sprintf("Failed to %s git post-commit hook", toggleAction), err, false)
+		logError(fmt.Sprintf("Failed to %s git %s hook", toggleAction, hookName), err, false)
 	} else {
-		printMessage(VerbosityStandard, "Git post-commit hook %sd.\n", toggleAction)
+		printMessage(VerbosityStandard, "Git %s hook %sd.\n", hookName, toggleAction)
 	}
 }
 
@@ -345,6 +550,19 @@ func promptUser(userPrompt string, printVars ...interface{}) (userResponse strin
 	return
 }
 
+// Prompts user for a full line of text (kept as entered, unlike promptUser)
+func promptUserForLine(userPrompt string, printVars ...interface{}) (userResponse string, err error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		err = fmt.Errorf("not in a terminal, prompts do not work")
+		return
+	}
+
+	fmt.Printf(userPrompt, printVars...)
+	userResponse, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	userResponse = strings.TrimRight(userResponse, "\r\n")
+	return
+}
+
 // Prompts user for a secret value (does not echo back entered text)
 func promptUserForSecret(userPrompt string, printVars ...interface{}) (userResponse string, err error) {
 	// Create PTY if not in terminal
@@ -365,3 +583,162 @@ func promptUserForSecret(userPrompt string, printVars ...interface{}) (userRespo
 	fmt.Println()
 	return
 }
+
+// Retrieves the standard ssh_config client options of a host
+func parseSSHClientOptions(sshConfig *ssh_config.Config, hostPattern string) (options SSHClientOptions, err error) {
+	options.StrictHostKeyChecking, _ = sshConfig.Get(hostPattern, "StrictHostKeyChecking")
+	options.StrictHostKeyChecking = strings.ToLower(options.StrictHostKeyChecking)
+	switch options.StrictHostKeyChecking {
+	case "", "ask":
+		options.StrictHostKeyChecking = "ask"
+	case "yes", "accept-new":
+	case "no", "off":
+		options.StrictHostKeyChecking = "no"
+	default:
+		err = fmt.Errorf("invalid StrictHostKeyChecking '%s' (valid: yes, accept-new, no, ask)", options.StrictHostKeyChecking)
+		return
+	}
+
+	options.ConnectTimeout = 30 * time.Second
+	connectTimeout, _ := sshConfig.Get(hostPattern, "ConnectTimeout")
+	if connectTimeout != "" {
+		options.ConnectTimeout, err = parseSSHConfigSeconds(connectTimeout)
+		if err != nil || options.ConnectTimeout == 0 {
+			err = fmt.Errorf("invalid ConnectTimeout '%s'", connectTimeout)
+			return
+		}
+	}
+
+	serverAliveInterval, _ := sshConfig.Get(hostPattern, "ServerAliveInterval")
+	if serverAliveInterval != "" {
+		options.ServerAliveInterval, err = parseSSHConfigSeconds(serverAliveInterval)
+		if err != nil {
+			err = fmt.Errorf("invalid ServerAliveInterval '%s'", serverAliveInterval)
+			return
+		}
+	}
+
+	options.ServerAliveCountMax = 3
+	serverAliveCountMax, _ := sshConfig.Get(hostPattern, "ServerAliveCountMax")
+	if serverAliveCountMax != "" {
+		options.ServerAliveCountMax, err = strconv.Atoi(serverAliveCountMax)
+		if err != nil || options.ServerAliveCountMax < 1 {
+			err = fmt.Errorf("invalid ServerAliveCountMax '%s'", serverAliveCountMax)
+			return
+		}
+	}
+
+	options.HostKeyAlgorithms, _ = sshConfig.Get(hostPattern, "HostKeyAlgorithms")
+	_, err = applyAlgorithmList([]string{ssh.KeyAlgoED25519}, options.HostKeyAlgorithms)
+	if err != nil {
+		err = fmt.Errorf("invalid HostKeyAlgorithms: %v", err)
+		return
+	}
+
+	// Validated against the algorithms supported by the SSH library
+	var defaultAlgorithms ssh.Config
+	defaultAlgorithms.SetDefaults()
+
+	ciphers, _ := sshConfig.Get(hostPattern, "Ciphers")
+	options.Ciphers, err = parseSupportedAlgorithms(defaultAlgorithms.Ciphers, ciphers, func(algorithms []string) []string {
+		algorithmConfig := ssh.Config{Ciphers: algorithms}
+		algorithmConfig.SetDefaults()
+		return algorithmConfig.Ciphers
+	})
+	if err != nil {
+		err = fmt.Errorf("invalid Ciphers: %v", err)
+		return
+	}
+
+	kexAlgorithms, _ := sshConfig.Get(hostPattern, "KexAlgorithms")
+	options.KexAlgorithms, err = parseSupportedAlgorithms(defaultAlgorithms.KeyExchanges, kexAlgorithms, func(algorithms []string) []string {
+		algorithmConfig := ssh.Config{KeyExchanges: algorithms}
+		algorithmConfig.SetDefaults()
+		return algorithmConfig.KeyExchanges
+	})
+	if err != nil {
+		err = fmt.Errorf("invalid KexAlgorithms: %v", err)
+		return
+	}
+
+	MACs, _ := sshConfig.Get(hostPattern, "MACs")
+	options.MACs, err = parseSupportedAlgorithms(defaultAlgorithms.MACs, MACs, func(algorithms []string) []string {
+		algorithmConfig := ssh.Config{MACs: algorithms}
+		algorithmConfig.SetDefaults()
+		return algorithmConfig.MACs
+	})
+	if err != nil {
+		err = fmt.Errorf("invalid MACs: %v", err)
+		return
+	}
+
+	preferredAuthentications, _ := sshConfig.Get(hostPattern, "PreferredAuthentications")
+	options.PreferredAuthentications, err = parseAuthenticationMethods(preferredAuthentications)
+	if err != nil {
+		err = fmt.Errorf("invalid PreferredAuthentications: %v", err)
+		return
+	}
+
+	// Only the identity file key is used unless explicitly disabled
+	identitiesOnly, _ := sshConfig.Get(hostPattern, "IdentitiesOnly")
+	if strings.ToLower(identitiesOnly) == "no" {
+		options.OfferAgentKeys = true
+	}
+
+	addressFamily, _ := sshConfig.Get(hostPattern, "AddressFamily")
+	switch strings.ToLower(addressFamily) {
+	case "", "any":
+		options.AddressFamily = "tcp"
+	case "inet":
+		options.AddressFamily = "tcp4"
+	case "inet6":
+		options.AddressFamily = "tcp6"
+	default:
+		err = fmt.Errorf("invalid AddressFamily '%s' (valid: any, inet, inet6)", addressFamily)
+		return
+	}
+	return
+}
+
+// Parses an algorithm list option and ensures every algorithm is supported
+// Filter returns only the supported algorithms of the given list
+func parseSupportedAlgorithms(defaultAlgorithms []string, algorithmList string, filterSupported func([]string) []string) (algorithms []string, err error) {
+	if algorithmList == "" {
+		return
+	}
+
+	algorithms, err = applyAlgorithmList(defaultAlgorithms, algorithmList)
+	if err != nil {
+		return
+	}
+
+	supportedAlgorithms := filterSupported(algorithms)
+	if len(supportedAlgorithms) != len(algorithms) {
+		for _, algorithm := range algorithms {
+			if !slices.Contains(supportedAlgorithms, algorithm) {
+				err = fmt.Errorf("unsupported algorithm '%s'", algorithm)
+				return
+			}
+		}
+	}
+	return
+}
+
+// Parses ssh_config time values in seconds (plain number or with s/m/h suffix)
+func parseSSHConfigSeconds(value string) (duration time.Duration, err error) {
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			err = fmt.Errorf("negative time")
+			return
+		}
+		duration = time.Duration(seconds) * time.Second
+		return
+	}
+
+	duration, err = time.ParseDuration(strings.ToLower(value))
+	if err == nil && duration < 0 {
+		err = fmt.Errorf("negative time")
+	}
+	return
+}
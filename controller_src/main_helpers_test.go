@@ -6,8 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
 )
 
 // Unit test for printMessage
@@ -66,3 +71,214 @@ func TestPrintMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestRedactSecrets(t *testing.T) {
+	redactionSecrets = nil
+	defer func() { redactionSecrets = nil }()
+
+	registerSecret([]byte("hunter2pass"))
+	registerSecret([]byte("hunter2"))
+	registerSecret([]byte("abc"))         // too short, never masked
+	registerSecret([]byte("hunter2pass")) // duplicates are ignored
+
+	if len(redactionSecrets) != 2 {
+		t.Fatalf("expected 2 registered secrets but got %d", len(redactionSecrets))
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"no secrets here", "no secrets here"},
+		{"sudo: hunter2pass incorrect", "sudo: [REDACTED] incorrect"},
+		{"hunter2 and hunter2pass", "[REDACTED] and [REDACTED]"},
+		{"abc stays", "abc stays"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			redacted := redactSecrets(test.input)
+			if redacted != test.expected {
+				t.Errorf("redactSecrets(%s) = %s, want %s", test.input, redacted, test.expected)
+			}
+		})
+	}
+}
+
+func TestWipeHostSecrets(t *testing.T) {
+	redactionSecrets = nil
+	defer func() { redactionSecrets = nil }()
+	config.HostInfo = map[string]EndpointInfo{"web01": {Password: []byte("loginpass"), SudoPassword: []byte("sudopass")}}
+	defer func() { config.HostInfo = nil }()
+
+	registerSecret([]byte("hunter2pass"))
+
+	wipeHostSecrets()
+
+	if config.HostInfo["web01"].Password != nil || config.HostInfo["web01"].SudoPassword != nil {
+		t.Errorf("expected host passwords to be removed")
+	}
+	// Output after hosts are finished is still masked
+	if redacted := redactSecrets("error: hunter2pass"); redacted != "error: [REDACTED]" {
+		t.Errorf("redactSecrets() after wipe = %q, expected secret to stay masked", redacted)
+	}
+}
+
+func TestParseSSHClientOptions(t *testing.T) {
+	sshConfigContents := `
+Host defaults
+  Hostname 10.0.0.1
+Host tuned
+  Hostname 10.0.0.2
+  StrictHostKeyChecking accept-new
+  ConnectTimeout 5
+  ServerAliveInterval 1m
+  ServerAliveCountMax 5
+  Ciphers chacha20-poly1305@openssh.com,aes256-gcm@openssh.com
+  KexAlgorithms -ecdh-sha2-*
+  MACs ^hmac-sha2-512
+  PreferredAuthentications password,gssapi-with-mic,publickey
+  IdentitiesOnly no
+  AddressFamily inet6
+Host badcipher
+  Ciphers +3des-nonexistent
+Host badstrict
+  StrictHostKeyChecking maybe
+Host badfamily
+  AddressFamily ipx
+Host badauth
+  PreferredAuthentications smartcard
+Host *
+  IdentitiesOnly yes
+`
+	sshConfig, err := ssh_config.Decode(strings.NewReader(sshConfigContents))
+	if err != nil {
+		t.Fatalf("failed to decode test config: %v", err)
+	}
+
+	options, err := parseSSHClientOptions(sshConfig, "defaults")
+	if err != nil {
+		t.Fatalf("unexpected error for default options: %v", err)
+	}
+	expectedDefaults := SSHClientOptions{
+		StrictHostKeyChecking:    "ask",
+		ConnectTimeout:           30 * time.Second,
+		ServerAliveCountMax:      3,
+		PreferredAuthentications: defaultAuthenticationMethods,
+		AddressFamily:            "tcp",
+	}
+	if !reflect.DeepEqual(options, expectedDefaults) {
+		t.Errorf("default options = %+v, expected %+v", options, expectedDefaults)
+	}
+
+	options, err = parseSSHClientOptions(sshConfig, "tuned")
+	if err != nil {
+		t.Fatalf("unexpected error for tuned options: %v", err)
+	}
+	if options.StrictHostKeyChecking != "accept-new" || options.ConnectTimeout != 5*time.Second || options.ServerAliveInterval != time.Minute || options.ServerAliveCountMax != 5 {
+		t.Errorf("unexpected timing/strict options: %+v", options)
+	}
+	if !reflect.DeepEqual(options.Ciphers, []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com"}) {
+		t.Errorf("unexpected ciphers: %v", options.Ciphers)
+	}
+	for _, kexAlgorithm := range options.KexAlgorithms {
+		if strings.HasPrefix(kexAlgorithm, "ecdh-sha2-") {
+			t.Errorf("kex algorithm %s should have been removed", kexAlgorithm)
+		}
+	}
+	if len(options.MACs) == 0 || options.MACs[0] != "hmac-sha2-512" {
+		t.Errorf("unexpected MACs: %v", options.MACs)
+	}
+	if !reflect.DeepEqual(options.PreferredAuthentications, []string{"password", "publickey"}) {
+		t.Errorf("unexpected authentication methods: %v", options.PreferredAuthentications)
+	}
+	if !options.OfferAgentKeys || options.AddressFamily != "tcp6" {
+		t.Errorf("unexpected agent/address family options: %+v", options)
+	}
+
+	for _, invalidHost := range []string{"badcipher", "badstrict", "badfamily", "badauth"} {
+		_, err = parseSSHClientOptions(sshConfig, invalidHost)
+		if err == nil {
+			t.Errorf("expected error for host %s", invalidHost)
+		}
+	}
+}
+
+func TestExpandConfigIncludes(t *testing.T) {
+	configDirectory := t.TempDir()
+	err := os.MkdirAll(filepath.Join(configDirectory, "hosts.d"), 0700)
+	if err != nil {
+		t.Fatalf("failed to create include directory: %v", err)
+	}
+
+	includeFiles := map[string]string{
+		"hosts.d/10-web.conf": "Host web01 web02\n  Port 2222\n",
+		"hosts.d/20-db.conf":  "Include nested.conf\nHost db01\n  Hostname 10.0.0.5\n",
+		"hosts.d/nested.conf": "Host cache01\n  Hostname 10.0.0.6\n",
+		"loop.conf":           "Include loop.conf\n",
+	}
+	for includeFile, contents := range includeFiles {
+		err = os.WriteFile(filepath.Join(configDirectory, includeFile), []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("failed to write include file: %v", err)
+		}
+	}
+
+	configContents := "UniversalDirectory U\nInclude hosts.d/*.conf missing.conf\nHost web01\n  Include=hosts.d/nested.conf\n  User deployer\n"
+	expanded, err := expandConfigIncludes(configContents, configDirectory, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sshConfig, err := ssh_config.Decode(strings.NewReader(expanded))
+	if err != nil {
+		t.Fatalf("failed to decode expanded config: %v\n%s", err, expanded)
+	}
+
+	expectedValues := []struct {
+		host     string
+		key      string
+		expected string
+	}{
+		{"web02", "Port", "2222"},
+		{"db01", "Hostname", "10.0.0.5"},
+		{"cache01", "Hostname", "10.0.0.6"},
+		{"web01", "User", "deployer"}, // host context restored after the include
+		{"", "UniversalDirectory", "U"},
+	}
+	for _, expectedValue := range expectedValues {
+		value, _ := sshConfig.Get(expectedValue.host, expectedValue.key)
+		if value != expectedValue.expected {
+			t.Errorf("Get(%s, %s) = %q, expected %q", expectedValue.host, expectedValue.key, value, expectedValue.expected)
+		}
+	}
+
+	_, err = expandConfigIncludes("Include loop.conf", configDirectory, 0)
+	if err == nil {
+		t.Errorf("expected error for recursive include")
+	}
+}
+
+func TestConfigHostNames(t *testing.T) {
+	sshConfigContents := `
+Host web01 web02
+  Port 2222
+Host web* !web03
+  User deployer
+Host db01 !db02
+Host web01
+  Hostname 10.0.0.1
+Host *
+  Port 22
+`
+	sshConfig, err := ssh_config.Decode(strings.NewReader(sshConfigContents))
+	if err != nil {
+		t.Fatalf("failed to decode test config: %v", err)
+	}
+
+	hostNames := configHostNames(sshConfig)
+	expected := []string{"web01", "web02", "db01"}
+	if !reflect.DeepEqual(hostNames, expected) {
+		t.Errorf("configHostNames() = %v, expected %v", hostNames, expected)
+	}
+}
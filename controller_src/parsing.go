@@ -7,7 +7,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -39,6 +41,17 @@ func getCommitFiles(commit *object.Commit, fileOverride string) (commitFiles map
 	// Initialize maps
 	commitFiles = make(map[string]string)
 
+	// Directories with changed metadata (file defaults might have changed)
+	var changedMetadataDirs []string
+
+	// Deleted files inherit directory file defaults as they were before the commit
+	parentTree, err := parentCommit.Tree()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving parent commit tree: %v", err)
+		return
+	}
+	parentDirectoryDefaults := make(map[string]*MetaHeader)
+
 	// Determine what to do with each file in the commit
 	for _, file := range patch.FilePatches() {
 		// Get the old file and new file info
@@ -82,7 +95,8 @@ func getCommitFiles(commit *object.Commit, fileOverride string) (commitFiles map
 			printMessage(VerbosityFullData, "  File '%s' is to be deleted\n", fromPath)
 			// Deleted Files
 			//   like `rm etc/file.txt`
-			if config.AllowDeletions {
+			// Removed patches restore the universal file (filtered per host later)
+			if config.AllowDeletions || strings.HasSuffix(fromPath, patchFileSuffix) {
 				commitFiles[fromPath] = "delete"
 			} else {
 				printMessage(VerbosityProgress, "  Skipping deletion of file '%s'\n", fromPath)
@@ -148,6 +162,43 @@ func getCommitFiles(commit *object.Commit, fileOverride string) (commitFiles map
 			commitFiles[fromPath] = "unsupported"
 		}
 
+		if strings.HasSuffix(toPath, directoryMetadataFileName) {
+			changedMetadataDirs = append(changedMetadataDirs, filepath.Dir(toPath))
+		} else if to == nil && strings.HasSuffix(fromPath, directoryMetadataFileName) {
+			changedMetadataDirs = append(changedMetadataDirs, filepath.Dir(fromPath))
+		}
+
+		// Deleted managed blocks are only removed from the remote file (not the whole file)
+		// Removed patches restore the universal file and directory metadata has no header
+		if from != nil && commitFiles[fromPath] == "delete" && !strings.HasSuffix(fromPath, patchFileSuffix) && !strings.HasSuffix(fromPath, directoryMetadataFileName) {
+			var deletedFile *object.File
+			deletedFile, err = parentCommit.File(fromPath)
+			if err != nil {
+				err = fmt.Errorf("failed retrieving deleted file '%s' from parent commit: %v", fromPath, err)
+				return
+			}
+
+			var deletedFileContent string
+			deletedFileContent, err = deletedFile.Contents()
+			if err != nil {
+				err = fmt.Errorf("failed reading deleted file '%s': %v", fromPath, err)
+				return
+			}
+
+			var fileDefaults MetaHeader
+			var defaultsFound bool
+			fileDefaults, defaultsFound, err = loadDirectoryDefaults(fromPath, parentTree, parentDirectoryDefaults)
+			if err != nil {
+				return
+			}
+
+			marker := managedBlockMarker(deletedFileContent, fileDefaults, defaultsFound)
+			if marker != "" {
+				printMessage(VerbosityFullData, "  File '%s' is a managed block, only removing block from remote file\n", fromPath)
+				commitFiles[fromPath] = "blockdelete between markers " + marker
+			}
+		}
+
 		// Check for new symbolic links and add target file in actions for creation on remote hosts
 		if commitFileToType == "symlink" && commitFiles[toPath] == "create" {
 			// Get the target path of the sym link target and ensure it is valid
@@ -163,6 +214,77 @@ func getCommitFiles(commit *object.Commit, fileOverride string) (commitFiles map
 		}
 	}
 
+	// Files inheriting changed directory file defaults have to be redeployed
+	err = addFileDefaultsDependents(commitFiles, changedMetadataDirs, parentCommit, commit, fileOverride)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Marks all files beneath directories whose file defaults changed between commits for creation
+func addFileDefaultsDependents(commitFiles map[string]string, changedMetadataDirs []string, parentCommit *object.Commit, commit *object.Commit, fileOverride string) (err error) {
+	if len(changedMetadataDirs) == 0 {
+		return
+	}
+
+	parentTree, err := parentCommit.Tree()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving parent commit tree: %v", err)
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		err = fmt.Errorf("failed retrieving commit tree: %v", err)
+		return
+	}
+
+	for _, directory := range changedMetadataDirs {
+		repoDirectory := strings.ReplaceAll(directory, config.OSPathSeparator, "/")
+
+		var oldDefaults, newDefaults *MetaHeader
+		oldDefaults, err = readDirectoryDefaults(repoDirectory, parentTree)
+		if err != nil {
+			return
+		}
+		newDefaults, err = readDirectoryDefaults(repoDirectory, tree)
+		if err != nil {
+			return
+		}
+		if reflect.DeepEqual(oldDefaults, newDefaults) {
+			continue
+		}
+
+		printMessage(VerbosityFullData, "  File defaults of directory '%s' changed, redeploying files beneath it\n", directory)
+
+		err = tree.Files().ForEach(func(repoFile *object.File) (err error) {
+			if !strings.HasPrefix(repoFile.Name, repoDirectory+"/") {
+				return
+			}
+			if strings.HasSuffix(repoFile.Name, directoryMetadataFileName) {
+				return
+			}
+			if determineFileType(fmt.Sprintf("%v", repoFile.Mode)) != "regular" {
+				return
+			}
+			if repoFileIsValid(repoFile.Name) || checkForOverride(fileOverride, repoFile.Name) {
+				return
+			}
+			_, fileInCommit := commitFiles[repoFile.Name]
+			if fileInCommit {
+				return
+			}
+
+			printMessage(VerbosityFullData, "  File '%s' inherits file defaults and to be created\n", repoFile.Name)
+			commitFiles[repoFile.Name] = "create"
+			return
+		})
+		if err != nil {
+			err = fmt.Errorf("failed retrieving files beneath directory '%s': %v", directory, err)
+			return
+		}
+	}
 	return
 }
 
@@ -244,7 +366,8 @@ func getRepoFiles(tree *object.Tree, fileOverride string) (commitFiles map[strin
 
 // Uses global config and deployment files to create list of files and hosts specific to deployment
 // Also deduplicates host and universal to ensure host override files don't get clobbered
-func filterHostsAndFiles(deniedUniversalFiles map[string]map[string]struct{}, commitFiles map[string]string, hostOverride string) (allDeploymentHosts []string, allDeploymentFiles map[string]string) {
+// Fragments are replaced by the assembled file of each host, universal files and patches by the patched file of each host
+func filterHostsAndFiles(deniedUniversalFiles map[string]map[string]struct{}, universalFiles map[string]map[string]struct{}, fragmentFiles map[string][]string, patchFiles map[string]PatchOverlay, commitFiles map[string]string, hostOverride string) (allDeploymentHosts []string, allDeploymentFiles map[string]string) {
 	// Show progress to user
 	printMessage(VerbosityStandard, "Filtering deployment hosts... \n")
 
@@ -297,13 +420,61 @@ func filterHostsAndFiles(deniedUniversalFiles map[string]map[string]struct{}, co
 				continue
 			}
 
+			// Changed universal files and patches redeploy the patched file for this host
+			var fileIsOverlay bool
+			baseTgtFilePath := strings.TrimSuffix(HostAndPath[1], patchFileSuffix)
+			hostFilePath := strings.ReplaceAll(endpointName+config.OSPathSeparator+baseTgtFilePath, config.OSPathSeparator, "/")
+			patchOverlay, fileIsPatched := patchFiles[hostFilePath]
+			if fileIsPatched && (commitFile == patchOverlay.BaseFilePath || commitFile == patchOverlay.PatchFilePath) {
+				printMessage(VerbosityData, "        Selected as part of patched file %s\n", hostFilePath)
+				filePath = hostFilePath
+				commitFileAction = "create"
+				fileIsOverlay = true
+			} else if commitHost == endpointName && baseTgtFilePath != HostAndPath[1] && commitFileAction == "delete" {
+				// Removed patch restores the unpatched universal file
+				baseFilePath, _ := applicableUniversalFile(endpointName, baseTgtFilePath, universalFiles)
+				if baseFilePath == "" {
+					// Patch files are never deployed themselves
+					printMessage(VerbosityFullData, "        Patch removed and no universal file to restore\n")
+					continue
+				}
+				printMessage(VerbosityData, "        Patch removed, selected universal file %s\n", baseFilePath)
+				filePath = strings.ReplaceAll(baseFilePath, config.OSPathSeparator, "/")
+				commitFileAction = "create"
+				fileIsOverlay = true
+			}
+
 			// Skip if commitFile is a universal file that is not allowed for this host
 			_, fileIsDenied := hostsDeniedUniversalFiles[commitFile]
-			if fileIsDenied {
+			if fileIsDenied && !fileIsOverlay {
 				printMessage(VerbosityFullData, "        File is universal and host has non-universal identical file\n")
 				continue
 			}
 
+			// Changed fragments redeploy (or remove) the assembled file for this host
+			assembledFilePath, _, isFragment := splitFragmentPath(HostAndPath[1])
+			if isFragment {
+				filePath = strings.ReplaceAll(endpointName+config.OSPathSeparator+assembledFilePath, config.OSPathSeparator, "/")
+
+				_, fileIsAssembled := fragmentFiles[filePath]
+				if fileIsAssembled {
+					commitFileAction = "create"
+				} else if commitFileAction != "delete" && !strings.HasPrefix(commitFileAction, "blockdelete") {
+					printMessage(VerbosityFullData, "        Fragment is not used for this host\n")
+					continue
+				}
+
+				printMessage(VerbosityData, "        Selected as part of assembled file %s\n", filePath)
+			}
+
+			// Already selected through another fragment or overlay (managed block removal takes precedence over deletion)
+			if slices.Contains(filteredCommitFiles, filePath) {
+				if strings.HasPrefix(commitFileAction, "blockdelete") {
+					allDeploymentFiles[filePath] = commitFileAction
+				}
+				continue
+			}
+
 			printMessage(VerbosityData, "        Selected\n")
 
 			// Add file to the host-specific file list and the global deployment file map
@@ -328,47 +499,81 @@ func filterHostsAndFiles(deniedUniversalFiles map[string]map[string]struct{}, co
 }
 
 // Writes hosts secrest (key, password) into received map
+// Also retrieves secrets for the hosts jump hosts
 func retrieveHostSecrets(endpointName string) (err error) {
 	// Copy current global config for this host to local
 	hostInfo := config.HostInfo[endpointName]
 
-	printMessage(VerbosityData, "    Retrieving endpoint key\n")
+	hostInfo, err = retrieveLoginSecrets(hostInfo)
+	if err != nil {
+		return
+	}
 
-	// Get SSH Private Key from the supplied identity file
-	hostInfo.PrivateKey, hostInfo.KeyAlgo, err = SSHIdentityToKey(hostInfo.IdentityFile)
+	// Retrieve keys and passwords for the jump hosts
+	hostInfo.JumpHosts, err = resolveJumpHosts(hostInfo)
 	if err != nil {
-		err = fmt.Errorf("failed to retrieve private key: %v", err)
+		err = fmt.Errorf("failed to retrieve jump hosts: %v", err)
+		return
+	}
+
+	// Write host info back into global config
+	config.HostInfo[endpointName] = hostInfo
+	return
+}
+
+// Retrieves the private key and vault passwords used to log into a host
+// Hosts with an already loaded key or password are returned unchanged
+// Hosts without an IdentityFile (or 'none') log in with passwords or keyboard-interactive only
+func retrieveLoginSecrets(hostInfo EndpointInfo) (updatedHostInfo EndpointInfo, err error) {
+	updatedHostInfo = hostInfo
+	if updatedHostInfo.PrivateKey != nil || len(updatedHostInfo.Password) > 0 {
 		return
 	}
-	printMessage(VerbosityFullData, "      Key: %d\n", hostInfo.PrivateKey)
 
-	// Retrieve password if required
+	// Retrieve password if required (before the key, so a key passphrase in the open vault is used)
 	if hostInfo.RequiresVault {
-		hostInfo.Password, err = unlockVault(config.HostInfo[endpointName].EndpointName)
+		updatedHostInfo.Password, updatedHostInfo.SudoPassword, err = unlockVault(hostInfo.EndpointName)
 		if err != nil {
 			err = fmt.Errorf("error retrieving host password from vault: %v", err)
 			return
 		}
 
-		printMessage(VerbosityFullData, "      Password: %s\n", hostInfo.Password)
+		printMessage(VerbosityFullData, "      Retrieved host passwords from vault\n")
 	} else {
 		printMessage(VerbosityFullData, "      Host does not require password\n")
 	}
 
-	// Write host info back into global config
-	config.HostInfo[endpointName] = hostInfo
+	if hostInfo.IdentityFile == "" || strings.ToLower(hostInfo.IdentityFile) == "none" {
+		printMessage(VerbosityData, "    Host has no identity file, not using key authentication\n")
+	} else {
+		printMessage(VerbosityData, "    Retrieving endpoint key\n")
+
+		// Get SSH Private Key from the supplied identity file
+		updatedHostInfo.PrivateKey, updatedHostInfo.KeyAlgo, err = SSHIdentityToKey(hostInfo.IdentityFile, hostInfo.CertificateFile)
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve private key: %v", err)
+			return
+		}
+		printMessage(VerbosityFullData, "      Key: %d\n", updatedHostInfo.PrivateKey)
+	}
 	return
 }
 
 // Retrieves all file content for this deployment
 // Return vales provide the content keyed on local file path for the file data, metadata, hashes, and actions
-func loadFiles(allDeploymentFiles map[string]string, tree *object.Tree) (commitFileInfo map[string]CommitFileInfo, err error) {
+func loadFiles(allDeploymentFiles map[string]string, fragmentFiles map[string][]string, patchFiles map[string]PatchOverlay, tree *object.Tree) (commitFileInfo map[string]CommitFileInfo, err error) {
 	// Show progress to user
 	printMessage(VerbosityStandard, "Loading files for deployment... \n")
 
 	// Initialize map of all local file paths and their associated info (content, metadata, hashes, and actions)
 	commitFileInfo = make(map[string]CommitFileInfo)
 
+	// Cache of file defaults per repository directory
+	directoryDefaults := make(map[string]*MetaHeader)
+
+	// Content hashes (with their commands) that passed local checks
+	passedLocalChecks := make(map[string]struct{})
+
 	// Load file contents, metadata, hashes, and actions into their own maps
 	for commitFilePath, commitFileAction := range allDeploymentFiles {
 		printMessage(VerbosityData, "  Loading repository file %s\n", commitFilePath)
@@ -381,8 +586,8 @@ func loadFiles(allDeploymentFiles map[string]string, tree *object.Tree) (commitF
 
 		printMessage(VerbosityData, "    Marked as 'to be %s'\n", commitFileAction)
 
-		// Skip loading if file will be deleted
-		if commitFileAction == "delete" {
+		// Skip loading if file (or managed block) will be deleted
+		if commitFileAction == "delete" || strings.HasPrefix(commitFileAction, "blockdelete") {
 			// But, add it to the deploy target files so it can be deleted during ssh
 			commitFileInfo[filePath] = CommitFileInfo{Action: commitFileAction}
 			continue
@@ -400,31 +605,51 @@ func loadFiles(allDeploymentFiles map[string]string, tree *object.Tree) (commitF
 			continue
 		}
 
-		printMessage(VerbosityData, "    Retrieving file contents\n")
+		var content []byte
+		fragmentPaths, fileIsAssembled := fragmentFiles[filePath]
+		patchOverlay, fileIsPatched := patchFiles[filePath]
+		if fileIsPatched {
+			printMessage(VerbosityData, "    Applying patch %s to %s\n", patchOverlay.PatchFilePath, patchOverlay.BaseFilePath)
 
-		// Get file from git tree
-		var file *object.File
-		file, err = tree.File(commitFilePath)
-		if err != nil {
-			err = fmt.Errorf("failed retrieving file from git tree: %v", err)
-			return
-		}
+			content, err = loadPatchedFile(patchOverlay, tree)
+			if err != nil {
+				err = fmt.Errorf("failed patching '%s': %v", filePath, err)
+				return
+			}
+		} else if fileIsAssembled {
+			printMessage(VerbosityData, "    Assembling file contents from %d fragment(s)\n", len(fragmentPaths))
 
-		// Open reader for file contents
-		var reader io.ReadCloser
-		reader, err = file.Reader()
-		if err != nil {
-			err = fmt.Errorf("failed retrieving file reader: %v", err)
-			return
-		}
-		defer reader.Close()
+			content, err = assembleFragments(fragmentPaths, tree)
+			if err != nil {
+				err = fmt.Errorf("failed assembling '%s': %v", filePath, err)
+				return
+			}
+		} else {
+			printMessage(VerbosityData, "    Retrieving file contents\n")
 
-		// Read file contents (as bytes)
-		var content []byte
-		content, err = io.ReadAll(reader)
-		if err != nil {
-			err = fmt.Errorf("failed reading file content: %v", err)
-			return
+			// Get file from git tree
+			var file *object.File
+			file, err = tree.File(commitFilePath)
+			if err != nil {
+				err = fmt.Errorf("failed retrieving file from git tree: %v", err)
+				return
+			}
+
+			// Open reader for file contents
+			var reader io.ReadCloser
+			reader, err = file.Reader()
+			if err != nil {
+				err = fmt.Errorf("failed retrieving file reader: %v", err)
+				return
+			}
+			defer reader.Close()
+
+			// Read file contents (as bytes)
+			content, err = io.ReadAll(reader)
+			if err != nil {
+				err = fmt.Errorf("failed reading file content: %v", err)
+				return
+			}
 		}
 
 		printMessage(VerbosityData, "    Extracting file metadata\n")
@@ -444,8 +669,19 @@ func loadFiles(allDeploymentFiles map[string]string, tree *object.Tree) (commitF
 
 			// Save Directory metadata to map
 			var info CommitFileInfo
-			info.FileOwnerGroup = jsonDirMetadata.TargetFileOwnerGroup
-			info.FilePermissions = jsonDirMetadata.TargetFilePermissions
+			if jsonDirMetadata.TargetFileOwnerGroup == "" && jsonDirMetadata.TargetFilePermissions == nil && jsonDirMetadata.FileDefaults != nil {
+				printMessage(VerbosityData, "    Directory metadata only contains file defaults, not managing directory\n")
+				continue
+			}
+			info, err = parseMetaHeader(jsonDirMetadata)
+			if err != nil {
+				err = fmt.Errorf("invalid directory metadata for '%s': %v", directoryName, err)
+				return
+			}
+			if info.BlockMarker != "" {
+				err = fmt.Errorf("invalid directory metadata for '%s': managed blocks are only supported in files", directoryName)
+				return
+			}
 			info.ReloadRequired = false
 			info.Action = commitFileAction
 			commitFileInfo[commitFilePath] = info
@@ -454,33 +690,61 @@ func loadFiles(allDeploymentFiles map[string]string, tree *object.Tree) (commitF
 			continue
 		}
 
-		// Grab metadata out of contents
-		var metadata, configContent string
-		metadata, configContent, err = extractMetadata(string(content))
+		// Metadata defaults come from directories above the file holding the header
+		headerFilePath := filePath
+		if fileIsPatched {
+			headerFilePath = patchOverlay.BaseFilePath
+		} else if fileIsAssembled {
+			headerFilePath = fragmentPaths[0]
+		}
+
+		var fileDefaults MetaHeader
+		var defaultsFound bool
+		fileDefaults, defaultsFound, err = loadDirectoryDefaults(headerFilePath, tree, directoryDefaults)
 		if err != nil {
-			err = fmt.Errorf("failed to extract metadata header from '%s': %v", commitFilePath, err)
 			return
 		}
 
+		var jsonMetadata MetaHeader
+		var configContent string
+		if !strings.Contains(string(content), Delimiter) && defaultsFound {
+			printMessage(VerbosityData, "    No metadata header, using directory file defaults\n")
+			configContent = string(content)
+			jsonMetadata = fileDefaults
+		} else {
+			// Grab metadata out of contents
+			var metadata string
+			metadata, configContent, err = extractMetadata(string(content))
+			if err != nil {
+				err = fmt.Errorf("failed to extract metadata header from '%s': %v", commitFilePath, err)
+				return
+			}
+
+			printMessage(VerbosityData, "    Parsing metadata header JSON\n")
+
+			// Parse JSON into a generic map
+			err = json.Unmarshal([]byte(metadata), &jsonMetadata)
+			if err != nil {
+				err = fmt.Errorf("failed parsing JSON metadata header for %s: %v", commitFilePath, err)
+				return
+			}
+
+			// Header fields override directory defaults
+			jsonMetadata = mergeMetaHeaders(fileDefaults, jsonMetadata)
+		}
+
 		printMessage(VerbosityData, "    Hashing file content\n")
 
 		// SHA256 Hash the metadata-less contents
 		contentHash := SHA256Sum(configContent)
 
-		printMessage(VerbosityData, "    Parsing metadata header JSON\n")
-
-		// Parse JSON into a generic map
-		var jsonMetadata MetaHeader
-		err = json.Unmarshal([]byte(metadata), &jsonMetadata)
+		// Put all information gathered into struct
+		var info CommitFileInfo
+		info, err = parseMetaHeader(jsonMetadata)
 		if err != nil {
-			err = fmt.Errorf("failed parsing JSON metadata header for %s: %v", commitFilePath, err)
+			err = fmt.Errorf("invalid metadata header for %s: %v", commitFilePath, err)
 			return
 		}
-
-		// Put all information gathered into struct
-		var info CommitFileInfo
-		info.FileOwnerGroup = jsonMetadata.TargetFileOwnerGroup
-		info.FilePermissions = jsonMetadata.TargetFilePermissions
 		info.Reload = jsonMetadata.ReloadCommands
 		if len(info.Reload) > 0 {
 			// Reload commands are present, set bool to true
@@ -501,17 +765,48 @@ func loadFiles(allDeploymentFiles map[string]string, tree *object.Tree) (commitF
 		info.Data = configContent
 		info.Action = commitFileAction
 
+		// Identical content only has to be checked once (like universal files for every host)
+		if len(jsonMetadata.LocalCheckCommands) > 0 {
+			localCheckID := contentHash + fmt.Sprintf("%q", jsonMetadata.LocalCheckCommands)
+			_, localChecksPassed := passedLocalChecks[localCheckID]
+			if !localChecksPassed {
+				printMessage(VerbosityData, "    Running local checks\n")
+
+				err = runLocalChecks(filePath, configContent, jsonMetadata.LocalCheckCommands)
+				if err != nil {
+					err = fmt.Errorf("file %s: %v", commitFilePath, err)
+					return
+				}
+				passedLocalChecks[localCheckID] = struct{}{}
+			}
+		}
+
 		// Save info struct into map for this file
 		commitFileInfo[filePath] = info
 
 		// Print verbose file metadata information
 		printMessage(VerbosityFullData, "      Owner and Group: %s\n", info.FileOwnerGroup)
-		printMessage(VerbosityFullData, "      Permissions:     %d\n", info.FilePermissions)
+		printMessage(VerbosityFullData, "      Permissions:     %s\n", formatFilePermissions(info.FilePermissions))
+		if info.SELinuxContext != "" {
+			printMessage(VerbosityFullData, "      SELinux Context: %s\n", info.SELinuxContext)
+		}
+		if info.ACL != nil {
+			printMessage(VerbosityFullData, "      ACL Entries:     %v\n", info.ACL)
+		}
+		if info.Attributes != nil {
+			printMessage(VerbosityFullData, "      Attributes:      %s\n", *info.Attributes)
+		}
+		if info.BlockMarker != "" {
+			printMessage(VerbosityFullData, "      Managed Block:   %s\n", info.BlockMarker)
+		}
 		printMessage(VerbosityFullData, "      Content Hash:    %s\n", info.Hash)
 		printMessage(VerbosityFullData, "      Checks Required? %t\n", info.ChecksRequired)
 		if info.ChecksRequired {
 			printMessage(VerbosityFullData, "      Check Commands   %s\n", info.Checks)
 		}
+		if len(jsonMetadata.LocalCheckCommands) > 0 {
+			printMessage(VerbosityFullData, "      Local Checks     %s\n", jsonMetadata.LocalCheckCommands)
+		}
 		printMessage(VerbosityFullData, "      Reload Required? %t\n", info.ReloadRequired)
 		if info.ReloadRequired {
 			printMessage(VerbosityFullData, "      Reload Comamnds  %s\n", info.Reload)
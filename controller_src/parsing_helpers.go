@@ -2,13 +2,17 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -219,6 +223,202 @@ func mapDeniedUniversalFiles(allHostsFiles map[string]map[string]struct{}, unive
 	return
 }
 
+// Splits a fragment path (like etc/sudoers.frag.d/10-base) into the assembled target path and fragment name
+// Only files directly under a fragment directory are fragments
+func splitFragmentPath(tgtFilePath string) (assembledFilePath string, fragmentName string, isFragment bool) {
+	fragmentDir, fragmentName := filepath.Split(tgtFilePath)
+	fragmentDir = strings.TrimSuffix(fragmentDir, config.OSPathSeparator)
+	if !strings.HasSuffix(fragmentDir, fragmentDirSuffix) || fragmentName == directoryMetadataFileName {
+		return
+	}
+
+	assembledFilePath = strings.TrimSuffix(fragmentDir, fragmentDirSuffix)
+	if assembledFilePath == "" || strings.HasSuffix(assembledFilePath, config.OSPathSeparator) {
+		// Fragment directory name has to be the target name plus the suffix
+		return
+	}
+	isFragment = true
+	return
+}
+
+// Record fragments (in order) that make up each assembled file per host
+// Fragments come from the universal directory, universal groups, and host directory; identical fragment names in more specific directories win
+// Keys are the assembled file path under the host directory (with linux path separators)
+func mapFragmentFiles(allHostsFiles map[string]map[string]struct{}, universalFiles map[string]map[string]struct{}, deniedUniversalFiles map[string]map[string]struct{}) (fragmentFiles map[string][]string, err error) {
+	fragmentFiles = make(map[string][]string)
+
+	for endpointName, hostInfo := range config.HostInfo {
+		// Directories applicable to this host from least to most specific
+		var sourceDirs []string
+		if !hostInfo.IgnoreUniversal {
+			sourceDirs = append(sourceDirs, config.UniversalDirectory)
+		}
+		var groupDirs []string
+		for groupName := range hostInfo.UniversalGroups {
+			groupDirs = append(groupDirs, groupName)
+		}
+		sort.Strings(groupDirs)
+		sourceDirs = append(sourceDirs, groupDirs...)
+		sourceDirs = append(sourceDirs, endpointName)
+
+		// Fragment name to repository path for each assembled file
+		assembledFiles := make(map[string]map[string]string)
+		wholeFiles := make(map[string]string)
+		for _, sourceDir := range sourceDirs {
+			sourceFiles := universalFiles[sourceDir]
+			if sourceDir == endpointName {
+				sourceFiles = allHostsFiles[endpointName]
+			}
+
+			for tgtFilePath := range sourceFiles {
+				repoFilePath := filepath.Join(sourceDir, tgtFilePath)
+				_, fileIsDenied := deniedUniversalFiles[endpointName][repoFilePath]
+				if fileIsDenied {
+					continue
+				}
+
+				assembledFilePath, fragmentName, isFragment := splitFragmentPath(tgtFilePath)
+				if !isFragment {
+					wholeFiles[tgtFilePath] = repoFilePath
+					continue
+				}
+
+				_, assembledFileSeen := assembledFiles[assembledFilePath]
+				if !assembledFileSeen {
+					assembledFiles[assembledFilePath] = make(map[string]string)
+				}
+				assembledFiles[assembledFilePath][fragmentName] = repoFilePath
+			}
+		}
+
+		for assembledFilePath, fragments := range assembledFiles {
+			wholeFilePath, hasWholeFile := wholeFiles[assembledFilePath]
+			if hasWholeFile {
+				err = fmt.Errorf("host %s: '%s' and fragments in '%s%s' both target the same file", endpointName, wholeFilePath, assembledFilePath, fragmentDirSuffix)
+				return
+			}
+
+			var fragmentNames []string
+			for fragmentName := range fragments {
+				fragmentNames = append(fragmentNames, fragmentName)
+			}
+			sort.Strings(fragmentNames)
+
+			hostFilePath := strings.ReplaceAll(endpointName+config.OSPathSeparator+assembledFilePath, config.OSPathSeparator, "/")
+			for _, fragmentName := range fragmentNames {
+				fragmentFiles[hostFilePath] = append(fragmentFiles[hostFilePath], fragments[fragmentName])
+			}
+		}
+	}
+	return
+}
+
+// Record host patch overlays and the universal file each one applies to
+// Host .patch files without a universal file for the same path are regular files
+// Patched universal files are added to the hosts denied universal files
+func mapPatchFiles(allHostsFiles map[string]map[string]struct{}, universalFiles map[string]map[string]struct{}, deniedUniversalFiles map[string]map[string]struct{}) (patchFiles map[string]PatchOverlay, err error) {
+	patchFiles = make(map[string]PatchOverlay)
+
+	for endpointName, hostFiles := range allHostsFiles {
+		_, hostIsConfigured := config.HostInfo[endpointName]
+		if !hostIsConfigured {
+			continue
+		}
+
+		for tgtFilePath := range hostFiles {
+			baseTgtFilePath, isPatch := strings.CutSuffix(tgtFilePath, patchFileSuffix)
+			if !isPatch || baseTgtFilePath == "" || strings.HasSuffix(baseTgtFilePath, config.OSPathSeparator) {
+				continue
+			}
+
+			var baseFilePath string
+			baseFilePath, err = applicableUniversalFile(endpointName, baseTgtFilePath, universalFiles)
+			if err != nil {
+				err = fmt.Errorf("host %s: patch '%s': %v", endpointName, tgtFilePath, err)
+				return
+			}
+			if baseFilePath == "" {
+				continue
+			}
+
+			_, hostHasWholeFile := hostFiles[baseTgtFilePath]
+			if hostHasWholeFile {
+				err = fmt.Errorf("host %s: '%s' and '%s' both target the same file", endpointName, baseTgtFilePath, tgtFilePath)
+				return
+			}
+
+			hostFilePath := strings.ReplaceAll(endpointName+config.OSPathSeparator+baseTgtFilePath, config.OSPathSeparator, "/")
+			patchFiles[hostFilePath] = PatchOverlay{
+				BaseFilePath:  baseFilePath,
+				PatchFilePath: filepath.Join(endpointName, tgtFilePath),
+			}
+			deniedUniversalFiles[endpointName][baseFilePath] = struct{}{}
+		}
+	}
+	return
+}
+
+// Finds the universal group or universal directory file a host receives for a target path (group files are preferred)
+// Empty when no universal file applies to the host
+func applicableUniversalFile(endpointName string, tgtFilePath string, universalFiles map[string]map[string]struct{}) (repoFilePath string, err error) {
+	hostInfo := config.HostInfo[endpointName]
+
+	var groupFilePaths []string
+	for groupName := range hostInfo.UniversalGroups {
+		_, groupHasFile := universalFiles[groupName][tgtFilePath]
+		if groupHasFile {
+			groupFilePaths = append(groupFilePaths, filepath.Join(groupName, tgtFilePath))
+		}
+	}
+	if len(groupFilePaths) > 1 {
+		sort.Strings(groupFilePaths)
+		err = fmt.Errorf("file is present in more than one universal group of this host: %v", groupFilePaths)
+		return
+	}
+	if len(groupFilePaths) == 1 {
+		repoFilePath = groupFilePaths[0]
+		return
+	}
+
+	_, universalHasFile := universalFiles[config.UniversalDirectory][tgtFilePath]
+	if universalHasFile && !hostInfo.IgnoreUniversal {
+		repoFilePath = filepath.Join(config.UniversalDirectory, tgtFilePath)
+	}
+	return
+}
+
+// Concatenates fragments into one file
+// Only the first fragment can hold the metadata header (or it comes from directory file defaults)
+func assembleFragments(fragmentPaths []string, tree *object.Tree) (content []byte, err error) {
+	for index, fragmentPath := range fragmentPaths {
+		var fragmentFile *object.File
+		fragmentFile, err = tree.File(fragmentPath)
+		if err != nil {
+			err = fmt.Errorf("failed retrieving fragment '%s' from git tree: %v", fragmentPath, err)
+			return
+		}
+
+		var fragmentContent string
+		fragmentContent, err = fragmentFile.Contents()
+		if err != nil {
+			err = fmt.Errorf("failed reading fragment '%s': %v", fragmentPath, err)
+			return
+		}
+
+		if index > 0 && strings.HasPrefix(fragmentContent, Delimiter) {
+			err = fmt.Errorf("fragment '%s' has a metadata header, only the first fragment ('%s') can have one", fragmentPath, fragmentPaths[0])
+			return
+		}
+
+		// Each fragment starts on a new line
+		if fragmentContent != "" && !strings.HasSuffix(fragmentContent, "\n") {
+			fragmentContent += "\n"
+		}
+		content = append(content, fragmentContent...)
+	}
+	return
+}
+
 // Function to extract and validate metadata JSON from file contents
 func extractMetadata(fileContents string) (metadataSection string, remainingContent string, err error) {
 	// Add newline so file content doesnt have empty line at the top
@@ -447,56 +647,600 @@ func separateHostDirFromPath(localRepoPath string) (hostDir string, targetFilePa
 	return
 }
 
-// Converts symbolic linux permission to numeric representation
-// Like rwxr-x-rx -> 755
-func permissionsSymbolicToNumeric(permissions string) (perm int) {
-	var bits string
-	// Loop permission fields
-	for _, field := range []string{permissions[:3], permissions[3:6], permissions[6:]} {
-		bit := 0
-		// Read
-		if strings.Contains(field, "r") {
-			bit += 4
+// Parses one line of remote stat output (fields of remoteStatFormat)
+// Directory listings append the path as the last field (paths can contain tabs)
+func parseRemoteStat(statOutput string, withPath bool) (info RemoteFileInfo, err error) {
+	var fields []string
+	if withPath {
+		fields = strings.SplitN(statOutput, "\t", 8)
+		if len(fields) < 8 || fields[7] == "" {
+			err = fmt.Errorf("stat output not complete, not parsing")
+			return
 		}
-		// Write
-		if strings.Contains(field, "w") {
-			bit += 2
+		info.Name = filepath.Base(fields[7])
+	} else {
+		fields = strings.Split(statOutput, "\t")
+		if len(fields) != 7 {
+			err = fmt.Errorf("stat output not complete, not parsing")
+			return
 		}
-		// Execute
-		if strings.Contains(field, "x") {
-			bit += 1
+	}
+
+	rawMode, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		err = fmt.Errorf("failed to parse mode field '%s'", fields[0])
+		return
+	}
+	info.Mode = uint32(rawMode)
+
+	switch info.Mode & 0170000 {
+	case 0100000:
+		info.Type = "file"
+	case 0040000:
+		info.Type = "directory"
+	case 0120000:
+		info.Type = "symlink"
+	case 0010000:
+		info.Type = "fifo"
+	case 0140000:
+		info.Type = "socket"
+	case 0060000:
+		info.Type = "block"
+	case 0020000:
+		info.Type = "character"
+	default:
+		err = fmt.Errorf("unknown file type in mode '%s'", fields[0])
+		return
+	}
+
+	info.Permissions = info.Mode & 07777
+
+	info.UID, err = strconv.Atoi(fields[1])
+	if err != nil {
+		err = fmt.Errorf("failed to parse uid field '%s'", fields[1])
+		return
+	}
+	info.GID, err = strconv.Atoi(fields[2])
+	if err != nil {
+		err = fmt.Errorf("failed to parse gid field '%s'", fields[2])
+		return
+	}
+	info.Size, err = strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("failed to parse size field '%s'", fields[3])
+		return
+	}
+	modTime, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("failed to parse modification time field '%s'", fields[4])
+		return
+	}
+	info.ModTime = time.Unix(modTime, 0)
+	info.Owner = fields[5]
+	info.Group = fields[6]
+	info.Exists = true
+	return
+}
+
+// Ensures metadata owner and group are in 'owner:group' form (names or numeric ids)
+func validateOwnerGroup(ownerGroup string) (err error) {
+	owner, group, found := strings.Cut(ownerGroup, ":")
+	if !found {
+		err = fmt.Errorf("'%s' is not in owner:group format", ownerGroup)
+		return
+	}
+	for _, name := range []string{owner, group} {
+		if name == "" {
+			err = fmt.Errorf("'%s' is missing the owner or group", ownerGroup)
+			return
+		}
+		if strings.HasPrefix(name, "-") || strings.ContainsAny(name, ": \t\r\n") {
+			err = fmt.Errorf("'%s' is not a valid user or group name", name)
+			return
 		}
-		// Convert sum'd bits to string to concat with other loop iterations
-		bits = bits + strconv.Itoa(bit)
 	}
+	return
+}
 
-	// Convert back to integer (ignore error, we control all input values)
-	perm, _ = strconv.Atoi(bits)
+// Checks if remote owner and group match the expected 'owner:group' (by name or numeric id)
+func remoteOwnerGroupMatches(info RemoteFileInfo, ownerGroup string) (matches bool) {
+	owner, group, _ := strings.Cut(ownerGroup, ":")
+	if owner != info.Owner && owner != strconv.Itoa(info.UID) {
+		return
+	}
+	if group != info.Group && group != strconv.Itoa(info.GID) {
+		return
+	}
+	matches = true
 	return
 }
 
-// Extracts all file information from ls -lA
-// Permissions(as 755), Ownership, type, size, name
-func extractMetadataFromLS(lsOutput string) (Type string, Permissions string, Owner string, Group string, Size int, Name string, err error) {
-	// Split ls output into fields for this file
-	fileInfo := strings.Fields(lsOutput)
+// Parses metadata permissions as octal (numbers like 640 or strings like "0640" and "4755")
+func parseFilePermissions(permissions any) (mode uint32, err error) {
+	var octalDigits string
+	switch value := permissions.(type) {
+	case float64:
+		// JSON numbers are written with octal digits (640 is 0640)
+		if value < 0 || value != float64(int64(value)) {
+			err = fmt.Errorf("invalid permissions %v", value)
+			return
+		}
+		octalDigits = strconv.FormatInt(int64(value), 10)
+	case int:
+		octalDigits = strconv.Itoa(value)
+	case uint32:
+		mode = value
+	case string:
+		octalDigits = strings.TrimPrefix(strings.TrimSpace(value), "0o")
+		if octalDigits == "" {
+			err = fmt.Errorf("empty permissions")
+			return
+		}
+	case nil:
+		err = fmt.Errorf("missing permissions")
+		return
+	default:
+		err = fmt.Errorf("invalid permissions type %T", permissions)
+		return
+	}
+
+	if octalDigits != "" {
+		var parsedMode uint64
+		parsedMode, err = strconv.ParseUint(octalDigits, 8, 32)
+		if err != nil {
+			err = fmt.Errorf("permissions '%s' are not octal", octalDigits)
+			return
+		}
+		mode = uint32(parsedMode)
+	}
 
-	// Skip misc ls output
-	if len(fileInfo) < 9 {
-		err = fmt.Errorf("ls output not complete, not parsing")
+	if mode > 07777 {
+		err = fmt.Errorf("permissions %o have bits beyond special, user, group, and other", mode)
+		mode = 0
 		return
 	}
+	return
+}
+
+// Formats permissions for chmod and metadata (like 0640 or 4755)
+func formatFilePermissions(mode uint32) (permissions string) {
+	permissions = fmt.Sprintf("%04o", mode)
+	return
+}
+
+// Converts the lowest three permission bits to letters (like 5 -> 'r-x')
+func aclPermissionLetters(permissionBits uint32) (letters string) {
+	letters = "---"
+	for index, letter := range []byte("rwx") {
+		if permissionBits&(4>>index) != 0 {
+			letters = letters[:index] + string(letter) + letters[index+1:]
+		}
+	}
+	return
+}
+
+// Overlays the fields set in one metadata header onto another (closer directory defaults or the files own header win)
+// Empty lists and strings are set (like "Reload": [] removes inherited reload commands, "SELinuxContext": "" an inherited context)
+func mergeMetaHeaders(base MetaHeader, overlay MetaHeader) (merged MetaHeader) {
+	merged = base
+	if overlay.TargetFileOwnerGroup != "" {
+		merged.TargetFileOwnerGroup = overlay.TargetFileOwnerGroup
+	}
+	if overlay.TargetFilePermissions != nil {
+		merged.TargetFilePermissions = overlay.TargetFilePermissions
+	}
+	if overlay.TargetSELinuxContext != nil {
+		merged.TargetSELinuxContext = overlay.TargetSELinuxContext
+	}
+	if overlay.TargetACL != nil {
+		merged.TargetACL = overlay.TargetACL
+	}
+	if overlay.TargetAttributes != nil {
+		merged.TargetAttributes = overlay.TargetAttributes
+	}
+	if overlay.ManagedBlock != nil {
+		merged.ManagedBlock = overlay.ManagedBlock
+	}
+	if overlay.BlockMarker != nil {
+		merged.BlockMarker = overlay.BlockMarker
+	}
+	if overlay.CheckCommands != nil {
+		merged.CheckCommands = overlay.CheckCommands
+	}
+	if overlay.ReloadCommands != nil {
+		merged.ReloadCommands = overlay.ReloadCommands
+	}
+	if overlay.LocalCheckCommands != nil {
+		merged.LocalCheckCommands = overlay.LocalCheckCommands
+	}
+	merged.FileDefaults = nil
+	return
+}
+
+// Combines file defaults of all directory metadata files above a repository file (within its top-level directory)
+// Parsed defaults are cached by directory (nil when directory has none)
+func loadDirectoryDefaults(repoFilePath string, tree *object.Tree, directoryDefaults map[string]*MetaHeader) (defaults MetaHeader, defaultsFound bool, err error) {
+	pathNames := strings.Split(repoFilePath, "/")
+	for pathDepth := 1; pathDepth < len(pathNames); pathDepth++ {
+		directory := strings.Join(pathNames[:pathDepth], "/")
+
+		dirDefaults, cached := directoryDefaults[directory]
+		if !cached {
+			dirDefaults, err = readDirectoryDefaults(directory, tree)
+			if err != nil {
+				return
+			}
+			directoryDefaults[directory] = dirDefaults
+		}
+
+		if dirDefaults != nil {
+			defaults = mergeMetaHeaders(defaults, *dirDefaults)
+			defaultsFound = true
+		}
+	}
+	return
+}
 
-	// Retrieve
-	Type = string(fileInfo[0][0])
-	Permissions = string(fileInfo[0][1:])
-	Owner = string(fileInfo[2])
-	Group = string(fileInfo[3])
-	Size, err = strconv.Atoi(fileInfo[4])
+// Retrieves file defaults from the metadata file of a repository directory (nil if not present)
+func readDirectoryDefaults(directory string, tree *object.Tree) (dirDefaults *MetaHeader, err error) {
+	metadataFile, err := tree.File(directory + "/" + directoryMetadataFileName)
+	if err == object.ErrFileNotFound {
+		err = nil
+		return
+	}
 	if err != nil {
-		err = fmt.Errorf("failed to parse size field")
-		Size = 0
+		err = fmt.Errorf("failed retrieving directory metadata for '%s': %v", directory, err)
+		return
+	}
+
+	metadataContent, err := metadataFile.Contents()
+	if err != nil {
+		err = fmt.Errorf("failed reading directory metadata for '%s': %v", directory, err)
+		return
+	}
+
+	var dirMetadata MetaHeader
+	err = json.Unmarshal([]byte(metadataContent), &dirMetadata)
+	if err != nil {
+		err = fmt.Errorf("failed parsing directory JSON metadata for '%s': %v", directory, err)
+		return
+	}
+	dirDefaults = dirMetadata.FileDefaults
+	return
+}
+
+// Validates and converts a metadata header into deployment information (owner, permissions, SELinux, ACL, attributes)
+func parseMetaHeader(metadataHeader MetaHeader) (info CommitFileInfo, err error) {
+	err = validateOwnerGroup(metadataHeader.TargetFileOwnerGroup)
+	if err != nil {
+		err = fmt.Errorf("invalid FileOwnerGroup: %v", err)
+		return
+	}
+	info.FileOwnerGroup = metadataHeader.TargetFileOwnerGroup
+	info.FilePermissions, err = parseFilePermissions(metadataHeader.TargetFilePermissions)
+	if err != nil {
+		err = fmt.Errorf("invalid FilePermissions: %v", err)
+		return
+	}
+
+	if metadataHeader.TargetSELinuxContext != nil && *metadataHeader.TargetSELinuxContext != "" {
+		err = validateSELinuxContext(*metadataHeader.TargetSELinuxContext)
+		if err != nil {
+			return
+		}
+		info.SELinuxContext = *metadataHeader.TargetSELinuxContext
+	}
+
+	if metadataHeader.TargetACL != nil {
+		info.ACL, err = normalizeACLEntries(metadataHeader.TargetACL)
+		if err != nil {
+			err = fmt.Errorf("invalid ACL: %v", err)
+			return
+		}
+	}
+
+	if metadataHeader.ManagedBlock != nil && *metadataHeader.ManagedBlock {
+		info.BlockMarker = defaultBlockMarker
+		if metadataHeader.BlockMarker != nil && *metadataHeader.BlockMarker != "" {
+			info.BlockMarker = *metadataHeader.BlockMarker
+		}
+		err = validateBlockMarker(info.BlockMarker)
+		if err != nil {
+			return
+		}
+	} else if metadataHeader.BlockMarker != nil && *metadataHeader.BlockMarker != "" {
+		err = fmt.Errorf("BlockMarker requires ManagedBlock to be true")
+		return
+	}
+
+	if metadataHeader.TargetAttributes != nil {
+		var attributes string
+		attributes, err = normalizeAttributes(*metadataHeader.TargetAttributes)
+		if err != nil {
+			err = fmt.Errorf("invalid Attributes: %v", err)
+			return
+		}
+		info.Attributes = &attributes
+	}
+	return
+}
+
+// Ensures a managed block marker can be found as a single line in the remote file
+func validateBlockMarker(marker string) (err error) {
+	if strings.Count(marker, "{mark}") != 1 {
+		err = fmt.Errorf("block marker '%s' must contain '{mark}' exactly once", marker)
+		return
+	}
+	if strings.ContainsAny(marker, "\r\n") {
+		err = fmt.Errorf("block marker must be a single line")
+		return
+	}
+	if strings.TrimSpace(marker) != marker {
+		err = fmt.Errorf("block marker '%s' has leading or trailing whitespace", marker)
+		return
+	}
+	return
+}
+
+// Finds byte offsets of the managed block (including marker lines) in file content
+// Start is -1 when the file has no block
+func findManagedBlock(fileContent string, marker string) (blockStart int, blockEnd int, err error) {
+	beginMarker := strings.Replace(marker, "{mark}", "BEGIN", 1)
+	endMarker := strings.Replace(marker, "{mark}", "END", 1)
+
+	blockStart, blockEnd = -1, -1
+	var lineStart int
+	for lineStart < len(fileContent) {
+		lineEnd := strings.IndexByte(fileContent[lineStart:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(fileContent)
+		} else {
+			lineEnd += lineStart + 1
+		}
+		line := strings.TrimSpace(fileContent[lineStart:lineEnd])
+
+		switch line {
+		case beginMarker:
+			if blockStart != -1 {
+				err = fmt.Errorf("remote file contains more than one '%s' line", beginMarker)
+				return
+			}
+			blockStart = lineStart
+		case endMarker:
+			if blockStart == -1 {
+				err = fmt.Errorf("remote file contains '%s' before '%s'", endMarker, beginMarker)
+				return
+			}
+			if blockEnd != -1 {
+				err = fmt.Errorf("remote file contains more than one '%s' line", endMarker)
+				return
+			}
+			blockEnd = lineEnd
+		}
+		lineStart = lineEnd
+	}
+
+	if blockStart != -1 && blockEnd == -1 {
+		err = fmt.Errorf("remote file contains '%s' without '%s'", beginMarker, endMarker)
+		return
+	}
+	return
+}
+
+// Inserts or replaces the managed block between marker lines, keeping the rest of the file content
+// Files without the markers get the block appended to the end
+func insertManagedBlock(fileContent string, blockContent string, marker string) (newContent string, err error) {
+	blockStart, blockEnd, err := findManagedBlock(fileContent, marker)
+	if err != nil {
+		return
+	}
+
+	// Block always ends with a newline so the end marker is on its own line
+	if blockContent != "" && !strings.HasSuffix(blockContent, "\n") {
+		blockContent += "\n"
+	}
+	block := strings.Replace(marker, "{mark}", "BEGIN", 1) + "\n" + blockContent + strings.Replace(marker, "{mark}", "END", 1) + "\n"
+
+	// Replace existing block
+	if blockStart != -1 {
+		newContent = fileContent[:blockStart] + block + fileContent[blockEnd:]
+		return
+	}
+
+	// Append new block
+	newContent = fileContent
+	if newContent != "" && !strings.HasSuffix(newContent, "\n") {
+		newContent += "\n"
+	}
+	newContent += block
+	return
+}
+
+// Removes the managed block including marker lines, keeping the rest of the file content
+func removeManagedBlock(fileContent string, marker string) (newContent string, err error) {
+	blockStart, blockEnd, err := findManagedBlock(fileContent, marker)
+	if err != nil {
+		return
+	}
+
+	newContent = fileContent
+	if blockStart != -1 {
+		newContent = fileContent[:blockStart] + fileContent[blockEnd:]
+	}
+	return
+}
+
+// Retrieves the block marker from a files metadata header merged over its directory file defaults (empty if file is not a managed block)
+// Files without a header use the defaults, like when loading files
+func managedBlockMarker(fileContent string, fileDefaults MetaHeader, defaultsFound bool) (marker string) {
+	metadataHeader := fileDefaults
+	if strings.Contains(fileContent, Delimiter) || !defaultsFound {
+		metadata, _, err := extractMetadata(fileContent)
+		if err != nil {
+			return
+		}
+
+		var fileHeader MetaHeader
+		err = json.Unmarshal([]byte(metadata), &fileHeader)
+		if err != nil {
+			return
+		}
+		metadataHeader = mergeMetaHeaders(fileDefaults, fileHeader)
+	}
+	if metadataHeader.ManagedBlock == nil || !*metadataHeader.ManagedBlock {
+		return
+	}
+
+	marker = defaultBlockMarker
+	if metadataHeader.BlockMarker != nil && *metadataHeader.BlockMarker != "" {
+		marker = *metadataHeader.BlockMarker
+	}
+	return
+}
+
+// Ensures an SELinux context has user, role, and type (level is optional)
+func validateSELinuxContext(context string) (err error) {
+	contextFields := strings.SplitN(context, ":", 4)
+	if len(contextFields) < 3 || strings.ContainsAny(context, " \t\n") {
+		err = fmt.Errorf("invalid SELinux context '%s': expected user:role:type[:level]", context)
+		return
+	}
+	for _, contextField := range contextFields {
+		if contextField == "" {
+			err = fmt.Errorf("invalid SELinux context '%s': empty field", context)
+			return
+		}
+	}
+	return
+}
+
+// Normalizes one ACL entry to getfacl form (like 'd:u:www-data:rx' -> 'default:user:www-data:r-x')
+// Base entries (no qualifier), mask, and other are reported as such, they are derived from the file permissions
+func normalizeACLEntry(entry string) (normalized string, baseEntry bool, err error) {
+	entryFields := strings.Split(strings.TrimSpace(entry), ":")
+
+	var prefix string
+	if len(entryFields) > 0 && (entryFields[0] == "d" || entryFields[0] == "default") {
+		prefix = "default:"
+		entryFields = entryFields[1:]
+	}
+	if len(entryFields) != 3 {
+		err = fmt.Errorf("entry '%s' is not [default:]type:qualifier:permissions", entry)
+		return
+	}
+
+	var tag string
+	switch entryFields[0] {
+	case "u", "user":
+		tag = "user"
+	case "g", "group":
+		tag = "group"
+	case "m", "mask", "o", "other":
+		baseEntry = true
+		return
+	default:
+		err = fmt.Errorf("entry '%s' has unknown type '%s'", entry, entryFields[0])
+		return
+	}
+
+	qualifier := entryFields[1]
+	if qualifier == "" {
+		baseEntry = true
+		return
+	}
+	if strings.ContainsAny(qualifier, " \t,") {
+		err = fmt.Errorf("entry '%s' has invalid qualifier '%s'", entry, qualifier)
+		return
+	}
+
+	permissionLetters := entryFields[2]
+	if strings.Trim(permissionLetters, "rwx-") != "" || permissionLetters == "" {
+		err = fmt.Errorf("entry '%s' has invalid permissions '%s'", entry, permissionLetters)
+		return
+	}
+	permissions := []byte("---")
+	for index, letter := range "rwx" {
+		if strings.ContainsRune(permissionLetters, letter) {
+			permissions[index] = byte(letter)
+		}
+	}
+
+	normalized = prefix + tag + ":" + qualifier + ":" + string(permissions)
+	return
+}
+
+// Normalizes metadata ACL entries into a sorted list (empty list removes all extended entries)
+func normalizeACLEntries(entries []string) (normalized []string, err error) {
+	normalized = []string{}
+	for _, entry := range entries {
+		normalizedEntry, baseEntry, errLocal := normalizeACLEntry(entry)
+		if errLocal != nil {
+			err = errLocal
+			return
+		}
+		if baseEntry {
+			err = fmt.Errorf("entry '%s' is derived from FilePermissions, only named user/group entries are allowed", entry)
+			return
+		}
+		if !slices.Contains(normalized, normalizedEntry) {
+			normalized = append(normalized, normalizedEntry)
+		}
+	}
+	sort.Strings(normalized)
+	return
+}
+
+// Extracts named entries from getfacl output (without header, effective rights comments are ignored)
+func parseRemoteACL(getfaclOutput string) (entries []string) {
+	entries = []string{}
+	for _, line := range strings.Split(getfaclOutput, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		normalizedEntry, baseEntry, err := normalizeACLEntry(line)
+		if err != nil || baseEntry {
+			continue
+		}
+		entries = append(entries, normalizedEntry)
+	}
+	sort.Strings(entries)
+	return
+}
+
+// Normalizes chattr attributes into sorted letters
+func normalizeAttributes(attributes string) (normalized string, err error) {
+	var attributeLetters []string
+	for _, letter := range strings.TrimPrefix(attributes, "+") {
+		if !strings.ContainsRune(managedFileAttributes, letter) {
+			err = fmt.Errorf("attribute '%c' cannot be managed (supported: %s)", letter, managedFileAttributes)
+			return
+		}
+		if !slices.Contains(attributeLetters, string(letter)) {
+			attributeLetters = append(attributeLetters, string(letter))
+		}
+	}
+	sort.Strings(attributeLetters)
+	normalized = strings.Join(attributeLetters, "")
+	return
+}
+
+// Extracts managed attributes from lsattr output (like '----i---------e------- /etc/file' -> 'i')
+func parseRemoteAttributes(lsattrOutput string) (attributes string) {
+	lsattrFields := strings.Fields(lsattrOutput)
+	if len(lsattrFields) == 0 {
+		return
+	}
+
+	var attributeLetters []string
+	for _, letter := range lsattrFields[0] {
+		if strings.ContainsRune(managedFileAttributes, letter) && !slices.Contains(attributeLetters, string(letter)) {
+			attributeLetters = append(attributeLetters, string(letter))
+		}
 	}
-	Name = fileInfo[8]
+	sort.Strings(attributeLetters)
+	attributes = strings.Join(attributeLetters, "")
 	return
 }
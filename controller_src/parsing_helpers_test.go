@@ -3,7 +3,9 @@ package main
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // Unit test for checkForOverride
@@ -471,106 +473,700 @@ func TestSeparateHostDirFromPath(t *testing.T) {
 	}
 }
 
-func TestPermissionsSymbolicToNumeric(t *testing.T) {
-	// Define test cases
+func TestParseRemoteStat(t *testing.T) {
 	tests := []struct {
-		input    string
-		expected int
+		name          string
+		statOutput    string
+		withPath      bool
+		expected      RemoteFileInfo
+		expectedError bool
 	}{
-		{"rwxr-xr-x", 755}, // Full permissions for owner, read and execute for others
-		{"rw-r--r--", 644}, // Read/write for owner, read-only for others
-		{"r--r--r--", 444}, // Read-only for everyone
-		{"rw-rw-rw-", 666}, // Read and write for everyone
-		{"rwx------", 700}, // Full permissions for owner only
-		{"------x", 1},     // Only execute permission for others
+		{
+			name:       "Regular file",
+			statOutput: "81a4\t0\t0\t1234\t1700000000\troot\troot",
+			expected:   RemoteFileInfo{Exists: true, Type: "file", Mode: 0100644, Permissions: 0644, Owner: "root", Group: "root", Size: 1234, ModTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "Setgid directory",
+			statOutput: "45ed\t1000\t50\t4096\t1700000000\tdeployer\tstaff",
+			expected:   RemoteFileInfo{Exists: true, Type: "directory", Mode: 042755, Permissions: 02755, UID: 1000, GID: 50, Owner: "deployer", Group: "staff", Size: 4096, ModTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "Setuid file unknown owner",
+			statOutput: "89ed\t1234\t1234\t10\t1700000000\tUNKNOWN\tUNKNOWN",
+			expected:   RemoteFileInfo{Exists: true, Type: "file", Mode: 0104755, Permissions: 04755, UID: 1234, GID: 1234, Owner: "UNKNOWN", Group: "UNKNOWN", Size: 10, ModTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "Listing entry with spaces and tabs in name",
+			statOutput: "a1ff\t0\t0\t11\t1700000000\troot\troot\t/etc/my dir/link\tname",
+			withPath:   true,
+			expected:   RemoteFileInfo{Name: "link\tname", Exists: true, Type: "symlink", Mode: 0120777, Permissions: 0777, Owner: "root", Group: "root", Size: 11, ModTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "Owner and group with spaces",
+			statOutput: "81a4\t1500\t1501\t20\t1700000000\tjohn doe\tdomain users",
+			expected:   RemoteFileInfo{Exists: true, Type: "file", Mode: 0100644, Permissions: 0644, UID: 1500, GID: 1501, Owner: "john doe", Group: "domain users", Size: 20, ModTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "Listing entry owner and group with spaces",
+			statOutput: "81a4\t1500\t1501\t20\t1700000000\tjohn doe\tdomain users\t/srv/a b",
+			withPath:   true,
+			expected:   RemoteFileInfo{Name: "a b", Exists: true, Type: "file", Mode: 0100644, Permissions: 0644, UID: 1500, GID: 1501, Owner: "john doe", Group: "domain users", Size: 20, ModTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "Listing entry sticky directory",
+			statOutput: "43ff\t0\t0\t4096\t1700000000\troot\troot\t/tmp",
+			withPath:   true,
+			expected:   RemoteFileInfo{Name: "tmp", Exists: true, Type: "directory", Mode: 041777, Permissions: 01777, Owner: "root", Group: "root", Size: 4096, ModTime: time.Unix(1700000000, 0)},
+		},
+		{"Incomplete output", "81a4\t0\t0", false, RemoteFileInfo{}, true},
+		{"Listing entry without path", "81a4\t0\t0\t1\t1700000000\troot\troot", true, RemoteFileInfo{}, true},
+		{"Invalid mode", "zzzz\t0\t0\t1\t1700000000\troot\troot", false, RemoteFileInfo{}, true},
+		{"Invalid size", "81a4\t0\t0\tbig\t1700000000\troot\troot", false, RemoteFileInfo{}, true},
+		{"Space separated output", "81a4 0 0 1 1700000000 root root", false, RemoteFileInfo{}, true},
+		{"ls output", "-rw-r--r-- 1 root root 1234 Jan 1 12:34 filename", false, RemoteFileInfo{}, true},
 	}
 
-	// Iterate over test cases
 	for _, test := range tests {
-		t.Run(test.input, func(t *testing.T) {
-			// Call the function
-			result := permissionsSymbolicToNumeric(test.input)
+		t.Run(test.name, func(t *testing.T) {
+			info, err := parseRemoteStat(test.statOutput, test.withPath)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("parseRemoteStat() error = %v, expected error: %v", err, test.expectedError)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(info, test.expected) {
+				t.Errorf("parseRemoteStat() = %+v, expected %+v", info, test.expected)
+			}
+		})
+	}
+}
+
+func TestRemoteOwnerGroupMatches(t *testing.T) {
+	info := RemoteFileInfo{UID: 0, GID: 33, Owner: "root", Group: "www-data"}
+
+	tests := []struct {
+		ownerGroup string
+		expected   bool
+	}{
+		{"root:www-data", true},
+		{"0:33", true},
+		{"root:33", true},
+		{"root:root", false},
+		{"www-data:www-data", false},
+		{"root", false},
+	}
 
-			// Check if the result matches the expected value
+	for _, test := range tests {
+		t.Run(test.ownerGroup, func(t *testing.T) {
+			result := remoteOwnerGroupMatches(info, test.ownerGroup)
 			if result != test.expected {
-				t.Errorf("For input %s, expected %d, but got %d", test.input, test.expected, result)
+				t.Errorf("remoteOwnerGroupMatches(%s) = %v, expected %v", test.ownerGroup, result, test.expected)
 			}
 		})
 	}
 }
 
-func TestExtractMetadataFromLS(t *testing.T) {
+func TestParseFilePermissions(t *testing.T) {
 	tests := []struct {
-		name          string
-		lsOutput      string
-		expectedType  string
-		expectedPerms string
-		expectedOwner string
-		expectedGroup string
-		expectedSize  int
-		expectedName  string
-		expectedErr   bool
+		name        string
+		permissions any
+		expected    uint32
+		expectError bool
 	}{
-		{
-			name:          "Valid input",
-			lsOutput:      "-rwxr-xr-x 1 user group 1234 Jan 1 12:34 filename",
-			expectedType:  "-",
-			expectedPerms: "rwxr-xr-x",
-			expectedOwner: "user",
-			expectedGroup: "group",
-			expectedSize:  1234,
-			expectedName:  "filename",
-			expectedErr:   false,
-		},
-		{
-			name:          "Incomplete input",
-			lsOutput:      "drwxr-xr-x",
-			expectedType:  "",
-			expectedPerms: "",
-			expectedOwner: "",
-			expectedGroup: "",
-			expectedSize:  0,
-			expectedName:  "",
-			expectedErr:   true,
-		},
-		{
-			name:          "Invalid size",
-			lsOutput:      "-rwxr-xr-x 1 user group invalid_size Jan 1 12:34 filename",
-			expectedType:  "-",
-			expectedPerms: "rwxr-xr-x",
-			expectedOwner: "user",
-			expectedGroup: "group",
-			expectedSize:  0,
-			expectedName:  "filename",
-			expectedErr:   true,
-		},
+		{"JSON number", float64(640), 0640, false},
+		{"JSON number with setgid", float64(2755), 02755, false},
+		{"String", "0640", 0640, false},
+		{"String sticky", "1777", 01777, false},
+		{"String go prefix", "0o4755", 04755, false},
+		{"Integer", 755, 0755, false},
+		{"Already parsed", uint32(0600), 0600, false},
+		{"Not octal", float64(689), 0, true},
+		{"Fraction", float64(644.5), 0, true},
+		{"Too large", "17777", 0, true},
+		{"Empty string", "", 0, true},
+		{"Missing", nil, 0, true},
+		{"Wrong type", true, 0, true},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			Type, Permissions, Owner, Group, Size, Name, err := extractMetadataFromLS(test.lsOutput)
+			mode, err := parseFilePermissions(test.permissions)
+			if (err != nil) != test.expectError {
+				t.Fatalf("parseFilePermissions(%v) error = %v, expected error %v", test.permissions, err, test.expectError)
+			}
+			if mode != test.expected {
+				t.Errorf("parseFilePermissions(%v) = %04o, expected %04o", test.permissions, mode, test.expected)
+			}
+		})
+	}
+}
+
+func TestAclPermissionLetters(t *testing.T) {
+	tests := map[uint32]string{0: "---", 4: "r--", 5: "r-x", 6: "rw-", 7: "rwx", 064: "r--"}
+	for permissionBits, expected := range tests {
+		result := aclPermissionLetters(permissionBits)
+		if result != expected {
+			t.Errorf("aclPermissionLetters(%o) = %s, expected %s", permissionBits, result, expected)
+		}
+	}
+}
+
+func TestValidateSELinuxContext(t *testing.T) {
+	tests := []struct {
+		context     string
+		expectError bool
+	}{
+		{"system_u:object_r:httpd_config_t:s0", false},
+		{"system_u:object_r:httpd_config_t", false},
+		{"system_u:object_r:svirt_sandbox_file_t:s0:c1,c2", false},
+		{"httpd_config_t", true},
+		{"system_u::httpd_config_t", true},
+		{"system_u:object_r:httpd config_t", true},
+	}
 
-			if (err != nil) != test.expectedErr {
-				t.Errorf("extractMetadataFromLS() error = %v, wantErr %v", err, test.expectedErr)
+	for _, test := range tests {
+		t.Run(test.context, func(t *testing.T) {
+			err := validateSELinuxContext(test.context)
+			if (err != nil) != test.expectError {
+				t.Errorf("validateSELinuxContext(%s) error = %v, expected error %v", test.context, err, test.expectError)
+			}
+		})
+	}
+}
+
+func TestNormalizeACLEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		expected    []string
+		expectError bool
+	}{
+		{"Short forms", []string{"u:www-data:rx", "g:adm:r"}, []string{"group:adm:r--", "user:www-data:r-x"}, false},
+		{"Default entries", []string{"d:u:backup:rwx", "default:group:adm:r-x"}, []string{"default:group:adm:r-x", "default:user:backup:rwx"}, false},
+		{"Duplicates", []string{"user:1000:rw", "u:1000:wr"}, []string{"user:1000:rw-"}, false},
+		{"Empty removes entries", []string{}, []string{}, false},
+		{"Base entry", []string{"user::rwx"}, nil, true},
+		{"Mask entry", []string{"mask::r-x"}, nil, true},
+		{"Unknown type", []string{"x:www-data:r"}, nil, true},
+		{"Invalid permissions", []string{"u:www-data:read"}, nil, true},
+		{"Missing permissions", []string{"u:www-data"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := normalizeACLEntries(test.entries)
+			if (err != nil) != test.expectError {
+				t.Fatalf("normalizeACLEntries(%v) error = %v, expected error %v", test.entries, err, test.expectError)
 			}
-			if Type != test.expectedType {
-				t.Errorf("extractMetadataFromLS() Type = %v, want %v", Type, test.expectedType)
+			if !test.expectError && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("normalizeACLEntries(%v) = %v, expected %v", test.entries, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseRemoteACL(t *testing.T) {
+	getfaclOutput := `user::rw-
+user:www-data:r-x	#effective:r--
+group::r--
+group:adm:r--
+mask::r--
+other::---
+default:user::rwx
+default:user:backup:rwx
+default:group::r-x
+default:mask::rwx
+default:other::---
+`
+	expected := []string{"default:user:backup:rwx", "group:adm:r--", "user:www-data:r-x"}
+
+	result := parseRemoteACL(getfaclOutput)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseRemoteACL() = %v, expected %v", result, expected)
+	}
+
+	result = parseRemoteACL("user::rw-\ngroup::r--\nother::r--\n")
+	if len(result) != 0 {
+		t.Errorf("parseRemoteACL() with only base entries = %v, expected none", result)
+	}
+}
+
+func TestNormalizeAttributes(t *testing.T) {
+	tests := []struct {
+		attributes  string
+		expected    string
+		expectError bool
+	}{
+		{"", "", false},
+		{"i", "i", false},
+		{"+ia", "ai", false},
+		{"Aii", "Ai", false},
+		{"e", "", true},
+		{"I", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.attributes, func(t *testing.T) {
+			result, err := normalizeAttributes(test.attributes)
+			if (err != nil) != test.expectError {
+				t.Fatalf("normalizeAttributes(%s) error = %v, expected error %v", test.attributes, err, test.expectError)
 			}
-			if Permissions != test.expectedPerms {
-				t.Errorf("extractMetadataFromLS() Permissions = %v, want %v", Permissions, test.expectedPerms)
+			if result != test.expected {
+				t.Errorf("normalizeAttributes(%s) = %s, expected %s", test.attributes, result, test.expected)
 			}
-			if Owner != test.expectedOwner {
-				t.Errorf("extractMetadataFromLS() Owner = %v, want %v", Owner, test.expectedOwner)
+		})
+	}
+}
+
+func TestParseRemoteAttributes(t *testing.T) {
+	tests := map[string]string{
+		"--------------e------- /etc/nginx/nginx.conf\n":    "",
+		"----i---------e------- /etc/resolv.conf\n":         "i",
+		"-----a--------e------- /var/log/audit dir\n":       "a",
+		"s---ia-A------e------- /etc/my file\n":             "Aais",
+		"----i----I----e------- /etc/dir with --- dashes\n": "i",
+	}
+
+	for lsattrOutput, expected := range tests {
+		result := parseRemoteAttributes(lsattrOutput)
+		if result != expected {
+			t.Errorf("parseRemoteAttributes(%q) = %s, expected %s", lsattrOutput, result, expected)
+		}
+	}
+}
+
+func TestParseMetaHeader(t *testing.T) {
+	attributes := "+i"
+	context := "system_u:object_r:httpd_config_t:s0"
+	metadataHeader := MetaHeader{
+		TargetFileOwnerGroup:  "root:nginx",
+		TargetFilePermissions: "2750",
+		TargetSELinuxContext:  &context,
+		TargetACL:             []string{"u:deploy:rx"},
+		TargetAttributes:      &attributes,
+	}
+
+	info, err := parseMetaHeader(metadataHeader)
+	if err != nil {
+		t.Fatalf("parseMetaHeader() unexpected error: %v", err)
+	}
+	if info.FileOwnerGroup != "root:nginx" || info.FilePermissions != 02750 || info.SELinuxContext != "system_u:object_r:httpd_config_t:s0" {
+		t.Errorf("parseMetaHeader() = %+v, unexpected owner, permissions, or context", info)
+	}
+	if !reflect.DeepEqual(info.ACL, []string{"user:deploy:r-x"}) {
+		t.Errorf("parseMetaHeader() ACL = %v, expected [user:deploy:r-x]", info.ACL)
+	}
+	if info.Attributes == nil || *info.Attributes != "i" {
+		t.Errorf("parseMetaHeader() Attributes = %v, expected i", info.Attributes)
+	}
+
+	// Unset extended metadata stays unmanaged
+	info, err = parseMetaHeader(MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644)})
+	if err != nil {
+		t.Fatalf("parseMetaHeader() unexpected error: %v", err)
+	}
+	if info.ACL != nil || info.Attributes != nil || info.SELinuxContext != "" {
+		t.Errorf("parseMetaHeader() = %+v, expected unmanaged extended metadata", info)
+	}
+
+	_, err = parseMetaHeader(MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(648)})
+	if err == nil {
+		t.Errorf("parseMetaHeader() expected error for invalid permissions")
+	}
+
+	managedBlock := true
+	info, err = parseMetaHeader(MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), ManagedBlock: &managedBlock})
+	if err != nil || info.BlockMarker != defaultBlockMarker {
+		t.Errorf("parseMetaHeader() BlockMarker = %q (error %v), expected default marker", info.BlockMarker, err)
+	}
+
+	blockMarker := "# {mark}"
+	_, err = parseMetaHeader(MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), BlockMarker: &blockMarker})
+	if err == nil {
+		t.Errorf("parseMetaHeader() expected error for BlockMarker without ManagedBlock")
+	}
+
+	// Empty strings are the unset form (no context, default marker)
+	emptyString := ""
+	info, err = parseMetaHeader(MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), TargetSELinuxContext: &emptyString, ManagedBlock: &managedBlock, BlockMarker: &emptyString})
+	if err != nil || info.SELinuxContext != "" || info.BlockMarker != defaultBlockMarker {
+		t.Errorf("parseMetaHeader() = %+v (error %v), expected no context and default marker", info, err)
+	}
+	wholeFile := false
+	_, err = parseMetaHeader(MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), ManagedBlock: &wholeFile, BlockMarker: &emptyString})
+	if err != nil {
+		t.Errorf("parseMetaHeader() unexpected error for cleared BlockMarker: %v", err)
+	}
+}
+
+func TestInsertManagedBlock(t *testing.T) {
+	marker := "# {mark} SCMP MANAGED BLOCK"
+	block := "10.0.0.5 db01\n10.0.0.6 db02\n"
+	managed := "# BEGIN SCMP MANAGED BLOCK\n" + block + "# END SCMP MANAGED BLOCK\n"
+
+	tests := []struct {
+		name        string
+		fileContent string
+		block       string
+		expected    string
+		expectError bool
+	}{
+		{"Empty file", "", block, managed, false},
+		{"Append", "127.0.0.1 localhost\n", block, "127.0.0.1 localhost\n" + managed, false},
+		{"Append without trailing newline", "127.0.0.1 localhost", block, "127.0.0.1 localhost\n" + managed, false},
+		{"Block without trailing newline", "", "10.0.0.5 db01\n10.0.0.6 db02", managed, false},
+		{"Replace keeps surrounding", "a\n# BEGIN SCMP MANAGED BLOCK\nold\n# END SCMP MANAGED BLOCK\nb\n", block, "a\n" + managed + "b\n", false},
+		{"Replace unchanged", "a\n" + managed + "b\n", block, "a\n" + managed + "b\n", false},
+		{"Indented markers", "a\n  # BEGIN SCMP MANAGED BLOCK\nold\n# END SCMP MANAGED BLOCK  \n", block, "a\n" + managed, false},
+		{"End marker at end of file", "# BEGIN SCMP MANAGED BLOCK\nold\n# END SCMP MANAGED BLOCK", block, managed, false},
+		{"Empty block", "a\n", "", "a\n# BEGIN SCMP MANAGED BLOCK\n# END SCMP MANAGED BLOCK\n", false},
+		{"Missing end", "# BEGIN SCMP MANAGED BLOCK\nold\n", block, "", true},
+		{"End before begin", "# END SCMP MANAGED BLOCK\n# BEGIN SCMP MANAGED BLOCK\n", block, "", true},
+		{"Two blocks", managed + managed, block, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := insertManagedBlock(test.fileContent, test.block, marker)
+			if (err != nil) != test.expectError {
+				t.Fatalf("insertManagedBlock() error = %v, expected error %v", err, test.expectError)
 			}
-			if Group != test.expectedGroup {
-				t.Errorf("extractMetadataFromLS() Group = %v, want %v", Group, test.expectedGroup)
+			if result != test.expected {
+				t.Errorf("insertManagedBlock() = %q, expected %q", result, test.expected)
 			}
-			if Size != test.expectedSize {
-				t.Errorf("extractMetadataFromLS() Size = %v, want %v", Size, test.expectedSize)
+		})
+	}
+}
+
+func TestRemoveManagedBlock(t *testing.T) {
+	marker := "// {mark} managed"
+
+	tests := []struct {
+		name        string
+		fileContent string
+		expected    string
+		expectError bool
+	}{
+		{"Remove", "a\n// BEGIN managed\nx\n// END managed\nb\n", "a\nb\n", false},
+		{"No block", "a\nb\n", "a\nb\n", false},
+		{"Missing end", "a\n// BEGIN managed\nx\n", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := removeManagedBlock(test.fileContent, marker)
+			if (err != nil) != test.expectError {
+				t.Fatalf("removeManagedBlock() error = %v, expected error %v", err, test.expectError)
 			}
-			if Name != test.expectedName {
-				t.Errorf("extractMetadataFromLS() Name = %v, want %v", Name, test.expectedName)
+			if result != test.expected {
+				t.Errorf("removeManagedBlock() = %q, expected %q", result, test.expected)
 			}
 		})
 	}
 }
+
+func TestValidateBlockMarker(t *testing.T) {
+	tests := []struct {
+		marker      string
+		expectError bool
+	}{
+		{"# {mark} SCMP MANAGED BLOCK", false},
+		{"<!-- {mark} managed -->", false},
+		{"# SCMP MANAGED BLOCK", true},
+		{"# {mark} {mark}", true},
+		{"# {mark}\nx", true},
+		{" # {mark}", true},
+	}
+
+	for _, test := range tests {
+		err := validateBlockMarker(test.marker)
+		if (err != nil) != test.expectError {
+			t.Errorf("validateBlockMarker(%q) error = %v, expected error %v", test.marker, err, test.expectError)
+		}
+	}
+}
+
+func TestManagedBlockMarker(t *testing.T) {
+	managedBlock := true
+	blockMarker := "; {mark}"
+	blockDefaults := MetaHeader{TargetFileOwnerGroup: "root:root", ManagedBlock: &managedBlock, BlockMarker: &blockMarker}
+
+	tests := []struct {
+		name          string
+		fileContent   string
+		fileDefaults  MetaHeader
+		defaultsFound bool
+		expected      string
+	}{
+		{"Default marker", "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644, \"ManagedBlock\": true}\n#|^^^|#\nblock\n", MetaHeader{}, false, defaultBlockMarker},
+		{"Custom marker", "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644, \"ManagedBlock\": true, \"BlockMarker\": \"; {mark}\"}\n#|^^^|#\nblock\n", MetaHeader{}, false, "; {mark}"},
+		{"Whole file", "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644}\n#|^^^|#\ncontent\n", MetaHeader{}, false, ""},
+		{"No metadata", "content\n", MetaHeader{}, false, ""},
+		{"Inherited without header", "block\n", blockDefaults, true, "; {mark}"},
+		{"Inherited under header", "#|^^^|#\n{\"FilePermissions\": 644}\n#|^^^|#\nblock\n", blockDefaults, true, "; {mark}"},
+		{"Inherited marker cleared", "#|^^^|#\n{\"BlockMarker\": \"\"}\n#|^^^|#\nblock\n", blockDefaults, true, defaultBlockMarker},
+		{"Inherited and turned off", "#|^^^|#\n{\"FilePermissions\": 644, \"ManagedBlock\": false}\n#|^^^|#\ncontent\n", blockDefaults, true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := managedBlockMarker(test.fileContent, test.fileDefaults, test.defaultsFound)
+			if result != test.expected {
+				t.Errorf("managedBlockMarker() = %q, expected %q", result, test.expected)
+			}
+		})
+	}
+}
+
+func TestSplitFragmentPath(t *testing.T) {
+	config = Config{OSPathSeparator: "/"}
+
+	tests := []struct {
+		tgtFilePath       string
+		expectedAssembled string
+		expectedFragment  string
+		expectedIsFrag    bool
+	}{
+		{"etc/sudoers.frag.d/10-base", "etc/sudoers", "10-base", true},
+		{"home/user/.bashrc.frag.d/50-aliases", "home/user/.bashrc", "50-aliases", true},
+		{"etc/sudoers", "", "", false},
+		{"etc/sudoers.frag.d/sub/10-base", "", "", false},
+		{"etc/sudoers.frag.d/" + directoryMetadataFileName, "", "", false},
+		{"etc/.frag.d/10-base", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.tgtFilePath, func(t *testing.T) {
+			assembled, fragment, isFragment := splitFragmentPath(test.tgtFilePath)
+			if isFragment != test.expectedIsFrag || (isFragment && (assembled != test.expectedAssembled || fragment != test.expectedFragment)) {
+				t.Errorf("splitFragmentPath(%s) = (%s, %s, %v), expected (%s, %s, %v)", test.tgtFilePath, assembled, fragment, isFragment, test.expectedAssembled, test.expectedFragment, test.expectedIsFrag)
+			}
+		})
+	}
+}
+
+func TestMapFragmentFiles(t *testing.T) {
+	// Mock Global
+	config = Config{
+		OSPathSeparator: "/",
+		HostInfo: map[string]EndpointInfo{
+			"web01": {
+				UniversalGroups: map[string]struct{}{"Web": {}},
+			},
+			"db01": {},
+			"isolated01": {
+				IgnoreUniversal: true,
+			},
+		},
+		UniversalDirectory: "UniversalConfs",
+	}
+
+	allHostsFiles := map[string]map[string]struct{}{
+		"web01": {
+			"etc/sudoers.frag.d/90-host":    {},
+			"etc/sudoers.frag.d/10-base":    {},
+			"etc/hosts":                     {},
+			"etc/ssh/sshd_config.frag.d/10": {},
+		},
+		"isolated01": {
+			"etc/sudoers.frag.d/90-host": {},
+		},
+	}
+	universalFiles := map[string]map[string]struct{}{
+		"UniversalConfs": {
+			"etc/sudoers.frag.d/10-base": {},
+			"etc/sudoers.frag.d/20-log":  {},
+		},
+		"Web": {
+			"etc/sudoers.frag.d/50-web": {},
+		},
+	}
+	deniedUniversalFiles := mapDeniedUniversalFiles(allHostsFiles, universalFiles)
+
+	fragmentFiles, err := mapFragmentFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if err != nil {
+		t.Fatalf("mapFragmentFiles() unexpected error: %v", err)
+	}
+
+	expected := map[string][]string{
+		"web01/etc/sudoers":         {"web01/etc/sudoers.frag.d/10-base", "UniversalConfs/etc/sudoers.frag.d/20-log", "Web/etc/sudoers.frag.d/50-web", "web01/etc/sudoers.frag.d/90-host"},
+		"web01/etc/ssh/sshd_config": {"web01/etc/ssh/sshd_config.frag.d/10"},
+		"db01/etc/sudoers":          {"UniversalConfs/etc/sudoers.frag.d/10-base", "UniversalConfs/etc/sudoers.frag.d/20-log"},
+		"isolated01/etc/sudoers":    {"isolated01/etc/sudoers.frag.d/90-host"},
+	}
+	if !reflect.DeepEqual(fragmentFiles, expected) {
+		t.Errorf("mapFragmentFiles() = %v, expected %v", fragmentFiles, expected)
+	}
+
+	// Whole file and fragments for the same target cannot be combined
+	allHostsFiles["db01"] = map[string]struct{}{"etc/sudoers": {}}
+	_, err = mapFragmentFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if err == nil {
+		t.Errorf("mapFragmentFiles() expected error for whole file next to fragments")
+	}
+}
+
+func TestMapPatchFiles(t *testing.T) {
+	// Mock Global
+	config = Config{
+		OSPathSeparator: "/",
+		HostInfo: map[string]EndpointInfo{
+			"web01": {
+				UniversalGroups: map[string]struct{}{"Web": {}},
+			},
+			"db01": {},
+			"isolated01": {
+				IgnoreUniversal: true,
+			},
+		},
+		UniversalDirectory: "UniversalConfs",
+	}
+
+	allHostsFiles := map[string]map[string]struct{}{
+		"web01": {
+			"etc/ntp.conf.patch":   {},
+			"etc/nginx.conf.patch": {},
+			"etc/fix.patch":        {},
+		},
+		"db01": {
+			"etc/ntp.conf.patch": {},
+		},
+		"isolated01": {
+			"etc/ntp.conf.patch": {},
+		},
+	}
+	universalFiles := map[string]map[string]struct{}{
+		"UniversalConfs": {
+			"etc/ntp.conf":   {},
+			"etc/nginx.conf": {},
+		},
+		"Web": {
+			"etc/nginx.conf": {},
+		},
+	}
+	deniedUniversalFiles := mapDeniedUniversalFiles(allHostsFiles, universalFiles)
+
+	patchFiles, err := mapPatchFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if err != nil {
+		t.Fatalf("mapPatchFiles() unexpected error: %v", err)
+	}
+
+	expected := map[string]PatchOverlay{
+		"web01/etc/ntp.conf":   {BaseFilePath: "UniversalConfs/etc/ntp.conf", PatchFilePath: "web01/etc/ntp.conf.patch"},
+		"web01/etc/nginx.conf": {BaseFilePath: "Web/etc/nginx.conf", PatchFilePath: "web01/etc/nginx.conf.patch"},
+		"db01/etc/ntp.conf":    {BaseFilePath: "UniversalConfs/etc/ntp.conf", PatchFilePath: "db01/etc/ntp.conf.patch"},
+	}
+	if !reflect.DeepEqual(patchFiles, expected) {
+		t.Errorf("mapPatchFiles() = %v, expected %v", patchFiles, expected)
+	}
+
+	// Patched universal files are no longer deployed as is
+	for _, deniedFile := range []string{"UniversalConfs/etc/ntp.conf", "Web/etc/nginx.conf"} {
+		_, fileIsDenied := deniedUniversalFiles["web01"][deniedFile]
+		if !fileIsDenied {
+			t.Errorf("mapPatchFiles() expected '%s' to be denied for web01", deniedFile)
+		}
+	}
+
+	// Whole host file and patch for the same target cannot be combined
+	allHostsFiles["db01"]["etc/ntp.conf"] = struct{}{}
+	_, err = mapPatchFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if err == nil {
+		t.Errorf("mapPatchFiles() expected error for whole file next to patch")
+	}
+}
+
+func TestMergeMetaHeaders(t *testing.T) {
+	immutable := "i"
+	managedBlock, wholeFile := true, false
+	context, noContext := "system_u:object_r:httpd_config_t:s0", ""
+	directoryDefaults := MetaHeader{
+		TargetFileOwnerGroup:  "root:root",
+		TargetFilePermissions: float64(644),
+		TargetSELinuxContext:  &context,
+		TargetAttributes:      &immutable,
+		ReloadCommands:        []string{"systemctl reload nginx"},
+		FileDefaults:          &MetaHeader{TargetFileOwnerGroup: "nobody:nobody"},
+	}
+
+	tests := []struct {
+		name     string
+		base     MetaHeader
+		overlay  MetaHeader
+		expected MetaHeader
+	}{
+		{
+			name:     "Empty overlay inherits everything but nested defaults",
+			base:     directoryDefaults,
+			overlay:  MetaHeader{},
+			expected: MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), TargetSELinuxContext: &context, TargetAttributes: &immutable, ReloadCommands: []string{"systemctl reload nginx"}},
+		},
+		{
+			name:     "Overlay fields win",
+			base:     directoryDefaults,
+			overlay:  MetaHeader{TargetFileOwnerGroup: "www-data:www-data", TargetFilePermissions: "0640", CheckCommands: []string{"nginx -t"}},
+			expected: MetaHeader{TargetFileOwnerGroup: "www-data:www-data", TargetFilePermissions: "0640", TargetSELinuxContext: &context, TargetAttributes: &immutable, CheckCommands: []string{"nginx -t"}, ReloadCommands: []string{"systemctl reload nginx"}},
+		},
+		{
+			name:     "Empty list removes inherited commands",
+			base:     directoryDefaults,
+			overlay:  MetaHeader{ReloadCommands: []string{}},
+			expected: MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), TargetSELinuxContext: &context, TargetAttributes: &immutable, ReloadCommands: []string{}},
+		},
+		{
+			name:     "Empty string removes inherited context",
+			base:     directoryDefaults,
+			overlay:  MetaHeader{TargetSELinuxContext: &noContext},
+			expected: MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), TargetSELinuxContext: &noContext, TargetAttributes: &immutable, ReloadCommands: []string{"systemctl reload nginx"}},
+		},
+		{
+			name:     "No defaults",
+			base:     MetaHeader{},
+			overlay:  MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(600), ManagedBlock: &managedBlock},
+			expected: MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(600), ManagedBlock: &managedBlock},
+		},
+		{
+			name:     "False overrides inherited managed block",
+			base:     MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), ManagedBlock: &managedBlock},
+			overlay:  MetaHeader{ManagedBlock: &wholeFile},
+			expected: MetaHeader{TargetFileOwnerGroup: "root:root", TargetFilePermissions: float64(644), ManagedBlock: &wholeFile},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := mergeMetaHeaders(test.base, test.overlay)
+			if !reflect.DeepEqual(merged, test.expected) {
+				t.Errorf("mergeMetaHeaders() = %+v, expected %+v", merged, test.expected)
+			}
+		})
+	}
+}
+
+func TestValidateOwnerGroup(t *testing.T) {
+	tests := []struct {
+		ownerGroup  string
+		expectError bool
+	}{
+		{"root:root", false},
+		{"www-data:adm", false},
+		{"1000:1000", false},
+		{"svc$:domain.users", false},
+		{"root", true},
+		{"root:", true},
+		{":root", true},
+		{"", true},
+		{"root:root:root", true},
+		{"-root:root", true},
+		{"ro ot:root", true},
+	}
+
+	for _, test := range tests {
+		err := validateOwnerGroup(test.ownerGroup)
+		if (err != nil) != test.expectError {
+			t.Errorf("validateOwnerGroup(%q) error = %v, expected error %v", test.ownerGroup, err, test.expectError)
+		}
+	}
+}
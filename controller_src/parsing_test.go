@@ -2,8 +2,14 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 func TestFilterHostsAndFiles(t *testing.T) {
@@ -59,6 +65,9 @@ func TestFilterHostsAndFiles(t *testing.T) {
 		name                 string
 		commitFiles          map[string]string
 		deniedUniversalFiles map[string]map[string]struct{}
+		universalFiles       map[string]map[string]struct{}
+		fragmentFiles        map[string][]string
+		patchFiles           map[string]PatchOverlay
 		hostOverride         string
 		expectedHosts        []string
 		expectedFiles        map[string]string
@@ -177,13 +186,69 @@ func TestFilterHostsAndFiles(t *testing.T) {
 				"host4": {"UniversalConfs/etc/issue"},
 			},
 		},
+		{
+			name: "Fragments Deploy Assembled File",
+			commitFiles: map[string]string{
+				"UniversalConfs/etc/sudoers.frag.d/10-base": "create",
+				"host1/etc/sudoers.frag.d/90-host":          "create",
+				"host1/etc/motd.frag.d/10-banner":           "delete",
+			},
+			fragmentFiles: map[string][]string{
+				"host1/etc/sudoers": {"UniversalConfs/etc/sudoers.frag.d/10-base", "host1/etc/sudoers.frag.d/90-host"},
+				"host2/etc/sudoers": {"UniversalConfs/etc/sudoers.frag.d/10-base"},
+			},
+			expectedHosts: []string{"host1", "host2"},
+			expectedFiles: map[string]string{
+				"host1/etc/sudoers": "create",
+				"host1/etc/motd":    "delete",
+				"host2/etc/sudoers": "create",
+			},
+			expectedFilesByHost: map[string][]string{
+				"host1": {"host1/etc/motd", "host1/etc/sudoers"},
+				"host2": {"host2/etc/sudoers"},
+			},
+		},
+		{
+			name: "Patches Deploy Patched File",
+			commitFiles: map[string]string{
+				"UniversalConfs/etc/ntp.conf": "create",
+				"host1/etc/ntp.conf.patch":    "create",
+				"host2/etc/chrony.conf.patch": "delete",
+				"host2/etc/motd.patch":        "delete",
+			},
+			deniedUniversalFiles: map[string]map[string]struct{}{
+				"host1": {
+					"UniversalConfs/etc/ntp.conf": {},
+				},
+			},
+			universalFiles: map[string]map[string]struct{}{
+				"UniversalConfs": {
+					"etc/ntp.conf":    {},
+					"etc/chrony.conf": {},
+				},
+			},
+			patchFiles: map[string]PatchOverlay{
+				"host1/etc/ntp.conf": {BaseFilePath: "UniversalConfs/etc/ntp.conf", PatchFilePath: "host1/etc/ntp.conf.patch"},
+			},
+			expectedHosts: []string{"host1", "host2", "host4"},
+			expectedFiles: map[string]string{
+				"host1/etc/ntp.conf":             "create",
+				"UniversalConfs/etc/ntp.conf":    "create",
+				"UniversalConfs/etc/chrony.conf": "create",
+			},
+			expectedFilesByHost: map[string][]string{
+				"host1": {"host1/etc/ntp.conf"},
+				"host2": {"UniversalConfs/etc/ntp.conf", "UniversalConfs/etc/chrony.conf"},
+				"host4": {"UniversalConfs/etc/ntp.conf"},
+			},
+		},
 	}
 
 	// Loop over each test case
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
 			// Call the function under test
-			allDeploymentHosts, allDeploymentFiles := filterHostsAndFiles(test.deniedUniversalFiles, test.commitFiles, test.hostOverride)
+			allDeploymentHosts, allDeploymentFiles := filterHostsAndFiles(test.deniedUniversalFiles, test.universalFiles, test.fragmentFiles, test.patchFiles, test.commitFiles, test.hostOverride)
 
 			// Validate the hosts
 			if len(allDeploymentHosts) != len(test.expectedHosts) {
@@ -241,3 +306,84 @@ func compareArrays(array1, array2 []string) (arraysIdentical bool) {
 	arraysIdentical = true
 	return
 }
+
+func TestGetCommitFilesDeletedManagedBlocks(t *testing.T) {
+	globalVerbosityLevel = 0
+	config = Config{
+		OSPathSeparator:    "/",
+		AllowDeletions:     true,
+		HostInfo:           map[string]EndpointInfo{"host1": {EndpointName: "host1"}},
+		UniversalDirectory: "UniversalConfs",
+	}
+
+	repoPath := t.TempDir()
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed retrieving worktree: %v", err)
+	}
+
+	// Directory defaults make every file beneath it a managed block
+	repoFiles := map[string]string{
+		"host1/etc/" + directoryMetadataFileName: `{"FileDefaults": {"FileOwnerGroup": "root:root", "FilePermissions": 644, "ManagedBlock": true}}`,
+		"host1/etc/inherited.conf":               "block\n",
+		"host1/etc/header.conf":                  "#|^^^|#\n{\"FilePermissions\": 600}\n#|^^^|#\nblock\n",
+		"host1/etc/whole.conf":                   "#|^^^|#\n{\"ManagedBlock\": false}\n#|^^^|#\ncontent\n",
+		"host1/other/plain.conf":                 "#|^^^|#\n{\"FileOwnerGroup\": \"root:root\", \"FilePermissions\": 644}\n#|^^^|#\ncontent\n",
+	}
+	for repoFile, content := range repoFiles {
+		filePath := filepath.Join(repoPath, repoFile)
+		err = os.MkdirAll(filepath.Dir(filePath), 0750)
+		if err != nil {
+			t.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(filePath, []byte(content), 0640)
+		if err != nil {
+			t.Fatalf("failed writing file: %v", err)
+		}
+		_, err = worktree.Add(repoFile)
+		if err != nil {
+			t.Fatalf("failed staging file: %v", err)
+		}
+	}
+	commitOptions := &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com"}}
+	_, err = worktree.Commit("add", commitOptions)
+	if err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+
+	// Directory metadata is removed in the same commit, the defaults before the commit still apply
+	for repoFile := range repoFiles {
+		_, err = worktree.Remove(repoFile)
+		if err != nil {
+			t.Fatalf("failed removing file: %v", err)
+		}
+	}
+	commitHash, err := worktree.Commit("remove", commitOptions)
+	if err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		t.Fatalf("failed retrieving commit: %v", err)
+	}
+
+	commitFiles, err := getCommitFiles(commit, "")
+	if err != nil {
+		t.Fatalf("getCommitFiles() error = %v", err)
+	}
+
+	expectedCommitFiles := map[string]string{
+		"host1/etc/" + directoryMetadataFileName: "delete",
+		"host1/etc/inherited.conf":               "blockdelete between markers " + defaultBlockMarker,
+		"host1/etc/header.conf":                  "blockdelete between markers " + defaultBlockMarker,
+		"host1/etc/whole.conf":                   "delete",
+		"host1/other/plain.conf":                 "delete",
+	}
+	if !reflect.DeepEqual(commitFiles, expectedCommitFiles) {
+		t.Errorf("getCommitFiles() = %v, expected %v", commitFiles, expectedCommitFiles)
+	}
+}
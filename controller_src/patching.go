@@ -0,0 +1,235 @@
+// controller
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// One hunk of a unified diff
+type patchHunk struct {
+	header   string   // Original '@@ -a,b +c,d @@' line for error context
+	oldStart int      // First line (1-based) the hunk applies to in the original
+	oldLines []string // Context and removed lines (with line endings)
+	newLines []string // Context and added lines (with line endings)
+}
+
+var patchHunkHeaderRegEx = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Retrieves universal file and host patch from the tree and returns the patched content
+func loadPatchedFile(patchOverlay PatchOverlay, tree *object.Tree) (content []byte, err error) {
+	baseFile, err := tree.File(patchOverlay.BaseFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed retrieving '%s' from git tree: %v", patchOverlay.BaseFilePath, err)
+		return
+	}
+	baseContent, err := baseFile.Contents()
+	if err != nil {
+		err = fmt.Errorf("failed reading '%s': %v", patchOverlay.BaseFilePath, err)
+		return
+	}
+
+	patchFile, err := tree.File(patchOverlay.PatchFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed retrieving '%s' from git tree: %v", patchOverlay.PatchFilePath, err)
+		return
+	}
+	patchContent, err := patchFile.Contents()
+	if err != nil {
+		err = fmt.Errorf("failed reading '%s': %v", patchOverlay.PatchFilePath, err)
+		return
+	}
+
+	patchedContent, err := applyUnifiedDiff(baseContent, patchContent)
+	if err != nil {
+		err = fmt.Errorf("patch '%s' does not apply to '%s': %v", patchOverlay.PatchFilePath, patchOverlay.BaseFilePath, err)
+		return
+	}
+	content = []byte(patchedContent)
+	return
+}
+
+// Parses the hunks of a unified diff for a single file
+func parseUnifiedDiff(patch string) (hunks []patchHunk, err error) {
+	patchLines := strings.SplitAfter(patch, "\n")
+
+	var fileHeaders int
+	for lineIndex := 0; lineIndex < len(patchLines); lineIndex++ {
+		line := patchLines[lineIndex]
+
+		// File headers (and anything else outside hunks like 'diff --git' lines) are ignored, but only one file is allowed
+		if strings.HasPrefix(line, "+++ ") {
+			fileHeaders++
+			if fileHeaders > 1 {
+				err = fmt.Errorf("patch changes more than one file")
+				return
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+
+		headerFields := patchHunkHeaderRegEx.FindStringSubmatch(line)
+		if headerFields == nil {
+			err = fmt.Errorf("invalid hunk header %q", strings.TrimRight(line, "\r\n"))
+			return
+		}
+
+		hunk := patchHunk{header: strings.TrimRight(headerFields[0], "\r\n")}
+		hunk.oldStart, _ = strconv.Atoi(headerFields[1])
+		oldCount, newCount := 1, 1
+		if headerFields[2] != "" {
+			oldCount, _ = strconv.Atoi(headerFields[2])
+		}
+		if headerFields[4] != "" {
+			newCount, _ = strconv.Atoi(headerFields[4])
+		}
+
+		// Read hunk body until both sides are complete (and a possible trailing newline marker)
+		var lastSide byte
+		for lineIndex+1 < len(patchLines) {
+			bodyLine := patchLines[lineIndex+1]
+			bodyComplete := len(hunk.oldLines) == oldCount && len(hunk.newLines) == newCount
+			if bodyLine == "" || (bodyComplete && bodyLine[0] != '\\') {
+				break
+			}
+			lineIndex++
+
+			switch bodyLine[0] {
+			case ' ':
+				hunk.oldLines = append(hunk.oldLines, bodyLine[1:])
+				hunk.newLines = append(hunk.newLines, bodyLine[1:])
+				lastSide = ' '
+			case '\n':
+				// Empty context line (trailing whitespace stripped by an editor)
+				hunk.oldLines = append(hunk.oldLines, "\n")
+				hunk.newLines = append(hunk.newLines, "\n")
+				lastSide = ' '
+			case '-':
+				hunk.oldLines = append(hunk.oldLines, bodyLine[1:])
+				lastSide = '-'
+			case '+':
+				hunk.newLines = append(hunk.newLines, bodyLine[1:])
+				lastSide = '+'
+			case '\\':
+				// No newline at end of file for the previous line
+				if lastSide == ' ' || lastSide == '-' {
+					hunk.oldLines[len(hunk.oldLines)-1] = strings.TrimSuffix(hunk.oldLines[len(hunk.oldLines)-1], "\n")
+				}
+				if lastSide == ' ' || lastSide == '+' {
+					hunk.newLines[len(hunk.newLines)-1] = strings.TrimSuffix(hunk.newLines[len(hunk.newLines)-1], "\n")
+				}
+			default:
+				err = fmt.Errorf("hunk %s: unexpected line %q", hunk.header, strings.TrimRight(bodyLine, "\r\n"))
+				return
+			}
+		}
+		if len(hunk.oldLines) != oldCount || len(hunk.newLines) != newCount {
+			err = fmt.Errorf("hunk %s: expected %d original and %d new lines, found %d and %d", hunk.header, oldCount, newCount, len(hunk.oldLines), len(hunk.newLines))
+			return
+		}
+
+		hunks = append(hunks, hunk)
+	}
+
+	if len(hunks) == 0 {
+		err = fmt.Errorf("patch has no hunks")
+		return
+	}
+	return
+}
+
+// Applies a unified diff to content
+// Hunks may have moved (offset) since the patch was made, but their context has to match exactly
+func applyUnifiedDiff(original string, patch string) (patched string, err error) {
+	hunks, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return
+	}
+
+	originalLines := strings.SplitAfter(original, "\n")
+	if originalLines[len(originalLines)-1] == "" {
+		originalLines = originalLines[:len(originalLines)-1]
+	}
+
+	var patchedLines []string
+	var nextLine, offset int
+	for _, hunk := range hunks {
+		// Pure additions are placed after the given line
+		hunkStart := hunk.oldStart - 1
+		if len(hunk.oldLines) == 0 {
+			hunkStart = hunk.oldStart
+		}
+		expectedLine := hunkStart + offset
+
+		matchLine := findHunk(originalLines, hunk.oldLines, expectedLine, nextLine)
+		if matchLine == -1 {
+			err = hunkMismatch(originalLines, hunk, expectedLine)
+			return
+		}
+
+		patchedLines = append(patchedLines, originalLines[nextLine:matchLine]...)
+		patchedLines = append(patchedLines, hunk.newLines...)
+		nextLine = matchLine + len(hunk.oldLines)
+		offset = matchLine - hunkStart
+	}
+	patchedLines = append(patchedLines, originalLines[nextLine:]...)
+
+	patched = strings.Join(patchedLines, "")
+	return
+}
+
+// Finds the line index where hunk lines match, searching outward from the expected line
+// Returns -1 if the hunk is not found after minimumLine
+func findHunk(originalLines []string, hunkLines []string, expectedLine int, minimumLine int) (matchLine int) {
+	maximumLine := len(originalLines) - len(hunkLines)
+	for distance := 0; expectedLine-distance >= minimumLine || expectedLine+distance <= maximumLine; distance++ {
+		for _, candidate := range []int{expectedLine - distance, expectedLine + distance} {
+			if candidate < minimumLine || candidate > maximumLine {
+				continue
+			}
+			if hunkMatches(originalLines[candidate:], hunkLines) {
+				matchLine = candidate
+				return
+			}
+		}
+	}
+	matchLine = -1
+	return
+}
+
+// Checks if all hunk lines are at the start of the given lines
+func hunkMatches(lines []string, hunkLines []string) (matches bool) {
+	if len(lines) < len(hunkLines) {
+		return
+	}
+	for index, hunkLine := range hunkLines {
+		if lines[index] != hunkLine {
+			return
+		}
+	}
+	matches = true
+	return
+}
+
+// Describes why a hunk did not apply at its expected location
+func hunkMismatch(originalLines []string, hunk patchHunk, expectedLine int) (err error) {
+	for index, hunkLine := range hunk.oldLines {
+		lineNumber := expectedLine + index
+		if lineNumber < 0 || lineNumber >= len(originalLines) {
+			err = fmt.Errorf("hunk %s: expected line %d to be %q, but file has %d lines", hunk.header, lineNumber+1, strings.TrimRight(hunkLine, "\r\n"), len(originalLines))
+			return
+		}
+		if originalLines[lineNumber] != hunkLine {
+			err = fmt.Errorf("hunk %s: expected line %d to be %q, found %q", hunk.header, lineNumber+1, strings.TrimRight(hunkLine, "\r\n"), strings.TrimRight(originalLines[lineNumber], "\r\n"))
+			return
+		}
+	}
+	err = fmt.Errorf("hunk %s: lines do not match anywhere after the previous hunk", hunk.header)
+	return
+}
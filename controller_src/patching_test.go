@@ -0,0 +1,135 @@
+// controller
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	original := "server 0.pool.ntp.org\nserver 1.pool.ntp.org\ndriftfile /var/lib/ntp/drift\nrestrict default nomodify\nrestrict 127.0.0.1\n"
+
+	tests := []struct {
+		name          string
+		original      string
+		patch         string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "Replace line",
+			original: original,
+			patch: `--- UniversalConfs/etc/ntp.conf
++++ host1/etc/ntp.conf
+@@ -1,3 +1,3 @@
+-server 0.pool.ntp.org
++server ntp.internal iburst
+ server 1.pool.ntp.org
+ driftfile /var/lib/ntp/drift
+`,
+			expected: "server ntp.internal iburst\nserver 1.pool.ntp.org\ndriftfile /var/lib/ntp/drift\nrestrict default nomodify\nrestrict 127.0.0.1\n",
+		},
+		{
+			name:     "Hunk moved by universal edit",
+			original: "# managed\n# by universal\n" + original,
+			patch: `@@ -4,2 +4,3 @@
+ restrict default nomodify
+ restrict 127.0.0.1
++restrict 10.0.0.0 mask 255.0.0.0
+`,
+			expected: "# managed\n# by universal\n" + original + "restrict 10.0.0.0 mask 255.0.0.0\n",
+		},
+		{
+			name:     "Multiple hunks",
+			original: original,
+			patch: `@@ -1,1 +1,0 @@
+-server 0.pool.ntp.org
+@@ -5 +4,2 @@
+ restrict 127.0.0.1
++tinker panic 0
+`,
+			expected: "server 1.pool.ntp.org\ndriftfile /var/lib/ntp/drift\nrestrict default nomodify\nrestrict 127.0.0.1\ntinker panic 0\n",
+		},
+		{
+			name:     "Pure addition after line",
+			original: "a\nb\nc\n",
+			patch: `@@ -2,0 +3 @@
++inserted
+`,
+			expected: "a\nb\ninserted\nc\n",
+		},
+		{
+			name:     "Addition at start",
+			original: "a\n",
+			patch: `@@ -0,0 +1 @@
++first
+`,
+			expected: "first\na\n",
+		},
+		{
+			name:     "No newline at end of original",
+			original: "a\nb",
+			patch: `@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+			expected: "a\nb\n",
+		},
+		{
+			name:     "No newline at end of both",
+			original: "a\nb",
+			patch: `@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+			expected: "a\nc",
+		},
+		{
+			name:          "Context no longer matches",
+			original:      strings.Replace(original, "driftfile /var/lib/ntp/drift", "driftfile /var/lib/ntpsec/drift", 1),
+			patch:         "@@ -2,2 +2,2 @@\n server 1.pool.ntp.org\n-driftfile /var/lib/ntp/drift\n+driftfile /srv/drift\n",
+			expectedError: `hunk @@ -2,2 +2,2 @@: expected line 3 to be "driftfile /var/lib/ntp/drift", found "driftfile /var/lib/ntpsec/drift"`,
+		},
+		{
+			name:          "Truncated hunk",
+			original:      original,
+			patch:         "@@ -1,3 +1,3 @@\n-server 0.pool.ntp.org\n+server ntp.internal\n",
+			expectedError: "expected 3 original and 3 new lines",
+		},
+		{
+			name:          "More than one file",
+			original:      original,
+			patch:         "--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n--- a/y\n+++ b/y\n@@ -1 +1 @@\n-a\n+b\n",
+			expectedError: "more than one file",
+		},
+		{
+			name:          "No hunks",
+			original:      original,
+			patch:         "just text\n",
+			expectedError: "no hunks",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, err := applyUnifiedDiff(test.original, test.patch)
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Fatalf("applyUnifiedDiff() error = %v, expected error containing %q", err, test.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyUnifiedDiff() unexpected error: %v", err)
+			}
+			if patched != test.expected {
+				t.Errorf("applyUnifiedDiff() = %q, expected %q", patched, test.expected)
+			}
+		})
+	}
+}
@@ -70,8 +70,16 @@ func preDeployment(deployMode string, commitID string, hostOverride string, file
 	// Create map of denied Universal files per host
 	deniedUniversalFiles := mapDeniedUniversalFiles(allHostsFiles, universalFiles)
 
+	// Create map of host patch overlays (patched universal files are denied for the host)
+	patchFiles, err := mapPatchFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	logError("Failed to map patch overlays", err, true)
+
+	// Create map of fragments that make up assembled files per host
+	fragmentFiles, err := mapFragmentFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	logError("Failed to map file fragments", err, true)
+
 	// Create map of deployment files/info per host and list of all deployment files across hosts
-	allDeploymentHosts, allDeploymentFiles := filterHostsAndFiles(deniedUniversalFiles, commitFiles, hostOverride)
+	allDeploymentHosts, allDeploymentFiles := filterHostsAndFiles(deniedUniversalFiles, universalFiles, fragmentFiles, patchFiles, commitFiles, hostOverride)
 
 	// Ensure files/hosts weren't all filtered out - Non-error because this can happen under normal operations
 	// Can happen if user specifies change deploy mode with a host that didn't have any changes in the specified commit
@@ -82,7 +90,7 @@ func preDeployment(deployMode string, commitID string, hostOverride string, file
 	}
 
 	// Load the files for deployment
-	commitFileInfo, err := loadFiles(allDeploymentFiles, tree)
+	commitFileInfo, err := loadFiles(allDeploymentFiles, fragmentFiles, patchFiles, tree)
 	logError("Error loading files", err, true)
 
 	// Ensure local system is in a state that is able to deploy
@@ -95,6 +103,9 @@ func preDeployment(deployMode string, commitID string, hostOverride string, file
 	// Semaphore to limit concurrency of host deployment go routines as specified in main config
 	semaphore := make(chan struct{}, config.MaxSSHConcurrency)
 
+	// Wipe passwords when returning - dry-run and fail tracker output still need them (password status and redaction)
+	defer wipeHostSecrets()
+
 	// Start SSH Deployments by host
 	var wg sync.WaitGroup
 	for _, endpointName := range allDeploymentHosts {
@@ -118,7 +129,7 @@ func preDeployment(deployMode string, commitID string, hostOverride string, file
 	wg.Wait()
 
 	// Remove vault cache
-	config.Vault = make(map[string]Credential)
+	wipeVault()
 
 	// If user requested dry run - print collected information
 	if dryRunRequested {
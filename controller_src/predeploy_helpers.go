@@ -3,15 +3,19 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
 )
 
 // Does a couple things
@@ -48,6 +52,62 @@ func localSystemChecks() (err error) {
 	return
 }
 
+// Runs metadata LocalCheck commands on the controller against a temporary copy of the header-stripped file content
+// '%s' in a command is replaced by the temporary file path (appended when not present)
+func runLocalChecks(repoFilePath string, content string, localChecks []string) (err error) {
+	// Keep the extension so checkers can detect the file type
+	tmpFile, err := os.CreateTemp("", "scmp-localcheck-*"+filepath.Ext(repoFilePath))
+	if err != nil {
+		err = fmt.Errorf("failed creating temporary file: %v", err)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(content)
+	if err != nil {
+		tmpFile.Close()
+		err = fmt.Errorf("failed writing temporary file: %v", err)
+		return
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		err = fmt.Errorf("failed writing temporary file: %v", err)
+		return
+	}
+
+	for _, localCheck := range localChecks {
+		checkCommand := localCheck + " " + shellQuote(tmpFile.Name())
+		if strings.Contains(localCheck, "%s") {
+			checkCommand = strings.ReplaceAll(localCheck, "%s", shellQuote(tmpFile.Name()))
+		}
+
+		printMessage(VerbosityData, "    Running local check '%s'\n", localCheck)
+
+		// Relative paths in commands are from the repository root
+		ctx, cancel := context.WithTimeout(context.Background(), localCheckTimeout)
+		command := exec.CommandContext(ctx, "sh", "-c", checkCommand)
+		command.Dir = config.RepositoryPath
+		output, errLocal := command.CombinedOutput()
+		cancel()
+
+		// Show repository path instead of temporary path in checker output
+		checkOutput := strings.TrimSpace(strings.ReplaceAll(string(output), tmpFile.Name(), repoFilePath))
+
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("local check '%s' timed out after %s", localCheck, localCheckTimeout)
+			return
+		}
+		if errLocal != nil {
+			err = fmt.Errorf("local check '%s' failed: %v", localCheck, errLocal)
+			if checkOutput != "" {
+				err = fmt.Errorf("%v\n%s", err, checkOutput)
+			}
+			return
+		}
+	}
+	return
+}
+
 // Commit changes in git repository
 func commitChanges() (err error) {
 	// If automatic commit is not desired, return early
@@ -300,6 +360,12 @@ func printDeploymentInformation(commitFileInfo map[string]CommitFileInfo, allDep
 
 		// Print out files for this specific host
 		for _, file := range hostInfo.DeploymentFiles {
+			// Directory metadata with only file defaults is not deployed
+			_, fileLoaded := commitFileInfo[file]
+			if !fileLoaded {
+				continue
+			}
+
 			// Format to remote path type
 			_, targetFile := separateHostDirFromPath(file)
 
@@ -315,15 +381,10 @@ func printDeploymentInformation(commitFileInfo map[string]CommitFileInfo, allDep
 // Ties into dry-runs to have a unified print of host information
 // Information only prints when verbosity level is more than or equal to 2
 func printHostInformation(hostInfo EndpointInfo) {
-	if len(hostInfo.Password) == 0 {
-		// If password is empty, indicate to user
-		hostInfo.Password = "*Host Does Not Use Passwords*"
-	} else if globalVerbosityLevel == 2 {
-		// Truncate passwords at verbosity level 2
-		if len(hostInfo.Password) > 6 {
-			hostInfo.Password = hostInfo.Password[:6]
-		}
-		hostInfo.Password += "..."
+	// Never print passwords, only whether one is used
+	passwordStatus := "*Host Does Not Use Passwords*"
+	if len(hostInfo.Password) > 0 {
+		passwordStatus = "*Retrieved From Vault*"
 	}
 
 	// Print out information for this specific host
@@ -331,8 +392,15 @@ func printHostInformation(hostInfo EndpointInfo) {
 	printMessage(VerbosityProgress, "  Options:\n")
 	printMessage(VerbosityProgress, "       Endpoint Address:  %s\n", hostInfo.Endpoint)
 	printMessage(VerbosityProgress, "       SSH User:          %s\n", hostInfo.EndpointUser)
-	printMessage(VerbosityProgress, "       SSH Key:           %s\n", hostInfo.PrivateKey.PublicKey())
-	printMessage(VerbosityProgress, "       Password:          %s\n", hostInfo.Password)
+	if len(hostInfo.ProxyJump) > 0 {
+		printMessage(VerbosityProgress, "       Jump Hosts:        %s\n", strings.Join(hostInfo.ProxyJump, " -> "))
+	}
+	if hostInfo.PrivateKey != nil {
+		printMessage(VerbosityProgress, "       SSH Key:           %s %s\n", hostInfo.PrivateKey.PublicKey().Type(), ssh.FingerprintSHA256(hostInfo.PrivateKey.PublicKey()))
+	} else {
+		printMessage(VerbosityProgress, "       SSH Key:           *Host Does Not Use Keys*\n")
+	}
+	printMessage(VerbosityProgress, "       Password:          %s\n", passwordStatus)
 	printMessage(VerbosityProgress, "       Transfer Buffer:   %s\n", hostInfo.RemoteTransferBuffer)
 	printMessage(VerbosityProgress, "       Backup Dir:        %s\n", hostInfo.RemoteBackupDir)
 }
@@ -0,0 +1,37 @@
+// controller
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunLocalChecks(t *testing.T) {
+	config.RepositoryPath = t.TempDir()
+
+	tests := []struct {
+		name           string
+		content        string
+		localChecks    []string
+		expectError    bool
+		expectedOutput string
+	}{
+		{"Placeholder", "key: value\n", []string{"grep -q 'key: value' %s"}, false, ""},
+		{"Appended path", "key: value\n", []string{"test -s"}, false, ""},
+		{"Extension kept", "{}\n", []string{`case %s in *.json) true ;; *) false ;; esac`}, false, ""},
+		{"All commands run", "key: value\n", []string{"true", "grep -q missing %s"}, true, ""},
+		{"Output shows repository path", "bad\n", []string{"echo \"%s: line 1: syntax error\"; false"}, true, "web01/etc/app.json: line 1: syntax error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := runLocalChecks("web01/etc/app.json", test.content, test.localChecks)
+			if (err != nil) != test.expectError {
+				t.Fatalf("runLocalChecks() error = %v, expected error %v", err, test.expectError)
+			}
+			if test.expectedOutput != "" && !strings.Contains(err.Error(), test.expectedOutput) {
+				t.Errorf("runLocalChecks() error = %q, expected to contain %q", err.Error(), test.expectedOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// controller
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ###########################################
+//      REMOTE CAPABILITY DETECTION
+// ###########################################
+
+// Shell script listing tools (with symbolic links resolved), BusyBox applets and SELinux state of the remote host
+// A mounted selinuxfs also means SELinux is enabled (selinuxenabled is not always installed)
+const remoteCapabilityProbe string = `for tool in "$@"; do
+	toolPath=$(command -v "$tool" 2>/dev/null) || continue
+	case "$toolPath" in /*) ;; *) continue ;; esac
+	if [ -h "$toolPath" ]; then toolPath=$(readlink -f "$toolPath" 2>/dev/null || echo "$toolPath"); fi
+	echo "tool $tool $toolPath"
+done
+if command -v busybox >/dev/null 2>&1; then
+	busybox --list 2>/dev/null | while read -r applet; do echo "applet $applet"; done
+fi
+if { command -v selinuxenabled >/dev/null 2>&1 && selinuxenabled; } || [ -e /sys/fs/selinux/enforce ]; then echo "selinux enabled"; fi`
+
+// Directories searched in addition to the login user PATH, escalated commands find administration tools (restorecon, setfacl) there
+const remoteAdminToolPath string = "/usr/local/sbin:/usr/sbin:/sbin"
+
+// Detects available remote commands on first use for a host, later calls return the cached result
+// Detection runs as the login user (no privilege escalation) with the administration tool directories added to PATH
+func detectRemoteCapabilities(sshClient *ssh.Client, endpointName string, escalation PrivilegeEscalation) (capabilities RemoteCapabilities, err error) {
+	RemoteCapabilitiesMutex.Lock()
+	capabilities, detected := remoteCapabilities[endpointName]
+	RemoteCapabilitiesMutex.Unlock()
+
+	if !detected {
+		probeScript := `PATH="$PATH:` + remoteAdminToolPath + `"; export PATH` + "\n" + remoteCapabilityProbe
+		command := buildCommand(append([]string{"sh", "-c", probeScript, "sh"}, remoteCapabilityTools...)...)
+		var probeOutput string
+		probeOutput, err = RunSSHCommand(sshClient, command, "", PrivilegeEscalation{Method: "none"}, 30)
+		if err != nil {
+			err = fmt.Errorf("failed to detect remote commands: %v", err)
+			return
+		}
+		capabilities = parseRemoteCapabilities(probeOutput)
+
+		RemoteCapabilitiesMutex.Lock()
+		remoteCapabilities[endpointName] = capabilities
+		RemoteCapabilitiesMutex.Unlock()
+
+		hashMethod := strings.Join(capabilities.Commands["sha256sum"], " ")
+		if hashMethod == "" {
+			hashMethod = "local (od download)"
+		}
+		printMessage(VerbosityProgress, "Host %s: Remote userland: busybox=%t, selinux=%t, hashing: %s\n", endpointName, capabilities.BusyBox, capabilities.SELinux, hashMethod)
+	}
+
+	err = checkRemoteCapabilities(capabilities, escalation)
+	return
+}
+
+// Parses output of the remote capability probe and picks compatible command variants
+func parseRemoteCapabilities(probeOutput string) (capabilities RemoteCapabilities) {
+	capabilities.Tools = make(map[string]string)
+	capabilities.Commands = make(map[string][]string)
+
+	applets := make(map[string]bool)
+	for _, line := range strings.Split(probeOutput, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) == 3 && fields[0] == "tool" {
+			capabilities.Tools[fields[1]] = fields[2]
+		} else if len(fields) == 2 && fields[0] == "applet" {
+			applets[fields[1]] = true
+		} else if len(fields) == 2 && fields[0] == "selinux" {
+			capabilities.SELinux = fields[1] == "enabled"
+		}
+	}
+
+	// Core commands resolving to the BusyBox binary identify its userland
+	for _, coreTool := range []string{"sh", "stat", "find"} {
+		if filepath.Base(capabilities.Tools[coreTool]) == "busybox" {
+			capabilities.BusyBox = true
+		}
+	}
+
+	// Applets without their own link are run through the BusyBox binary
+	for _, tool := range []string{"stat", "find", "readlink", "od", "sha256sum"} {
+		if capabilities.Tools[tool] != "" {
+			capabilities.Commands[tool] = []string{tool}
+		} else if capabilities.Tools["busybox"] != "" && applets[tool] {
+			capabilities.Commands[tool] = []string{"busybox", tool}
+		}
+	}
+
+	// Other hashing commands with sha256sum compatible output (hash first)
+	if len(capabilities.Commands["sha256sum"]) == 0 {
+		if capabilities.Tools["sha256"] != "" {
+			capabilities.Commands["sha256sum"] = []string{"sha256", "-r"}
+		} else if capabilities.Tools["openssl"] != "" {
+			capabilities.Commands["sha256sum"] = []string{"openssl", "dgst", "-sha256", "-r"}
+		}
+	}
+	return
+}
+
+// Ensures remote host has the commands needed for deployments
+func checkRemoteCapabilities(capabilities RemoteCapabilities, escalation PrivilegeEscalation) (err error) {
+	var missingTools []string
+	for _, tool := range []string{"stat", "find", "readlink"} {
+		if len(capabilities.Commands[tool]) == 0 {
+			missingTools = append(missingTools, tool)
+		}
+	}
+	// Content is hashed locally without a hashing command
+	if len(capabilities.Commands["sha256sum"]) == 0 && len(capabilities.Commands["od"]) == 0 {
+		missingTools = append(missingTools, "sha256sum (or od)")
+	}
+	if len(missingTools) > 0 {
+		err = fmt.Errorf("remote host is missing required commands: %s", strings.Join(missingTools, ", "))
+		return
+	}
+
+	if escalation.Method != "none" && capabilities.Tools[escalation.Method] == "" {
+		err = fmt.Errorf("privilege escalation method '%s' is not installed on remote host (set PrivilegeEscalation for this host)", escalation.Method)
+		return
+	}
+	return
+}
+
+// Retrieves invocation of a remote tool (the tool name itself if undetected)
+func remoteCommand(capabilities RemoteCapabilities, tool string) (commandWords []string) {
+	commandWords = capabilities.Commands[tool]
+	if len(commandWords) == 0 {
+		commandWords = []string{tool}
+	}
+	return
+}
+
+// Retrieves SHA256 hash of a remote file
+// Hosts without a hashing command send the content as hex (od) to be hashed locally
+func remoteFileHash(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remoteFilePath string) (fileHash string, err error) {
+	// Undetected hosts are expected to have sha256sum
+	hashCommand := capabilities.Commands["sha256sum"]
+	if capabilities.Commands == nil {
+		hashCommand = []string{"sha256sum"}
+	}
+
+	if len(hashCommand) > 0 {
+		command := buildCommand(append(hashCommand, "--", remoteFilePath)...)
+		var commandOutput string
+		commandOutput, err = RunSSHCommand(sshClient, command, "root", escalation, 90)
+		if err != nil {
+			return
+		}
+
+		fileHash = SHA256RegEx.FindString(commandOutput)
+		if fileHash == "" {
+			err = fmt.Errorf("no hash in output of remote command '%s'", command)
+		}
+		return
+	}
+
+	command := buildCommand(append(remoteCommand(capabilities, "od"), "-An", "-v", "-tx1", "--", remoteFilePath)...)
+	commandOutput, err := RunSSHCommand(sshClient, command, "root", escalation, 90)
+	if err != nil {
+		return
+	}
+
+	fileContents, err := hex.DecodeString(strings.Join(strings.Fields(commandOutput), ""))
+	if err != nil {
+		err = fmt.Errorf("failed to decode remote file content: %v", err)
+		return
+	}
+	contentHash := sha256.Sum256(fileContents)
+	fileHash = hex.EncodeToString(contentHash[:])
+	return
+}
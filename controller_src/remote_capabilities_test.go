@@ -0,0 +1,173 @@
+// controller
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRemoteCapabilities(t *testing.T) {
+	tests := []struct {
+		name             string
+		probeOutput      string
+		expectedBusyBox  bool
+		expectedCommands map[string][]string
+	}{
+		{
+			name:            "GNU coreutils",
+			probeOutput:     "tool sh /usr/bin/dash\ntool stat /usr/bin/stat\ntool find /usr/bin/find\ntool readlink /usr/bin/readlink\ntool od /usr/bin/od\ntool sha256sum /usr/bin/sha256sum\ntool sudo /usr/bin/sudo\n",
+			expectedBusyBox: false,
+			expectedCommands: map[string][]string{
+				"stat": {"stat"}, "find": {"find"}, "readlink": {"readlink"}, "od": {"od"}, "sha256sum": {"sha256sum"},
+			},
+		},
+		{
+			name:            "Alpine BusyBox",
+			probeOutput:     "tool sh /bin/busybox\ntool stat /bin/busybox\ntool find /usr/bin/find\ntool readlink /bin/busybox\ntool od /bin/busybox\ntool sha256sum /bin/busybox\ntool busybox /bin/busybox\ntool doas /usr/bin/doas\napplet stat\napplet sha256sum\n",
+			expectedBusyBox: true,
+			expectedCommands: map[string][]string{
+				"stat": {"stat"}, "find": {"find"}, "readlink": {"readlink"}, "od": {"od"}, "sha256sum": {"sha256sum"},
+			},
+		},
+		{
+			name:            "BusyBox without applet links",
+			probeOutput:     "tool sh /bin/busybox\ntool busybox /bin/busybox\napplet find\napplet stat\napplet readlink\napplet od\napplet sha256sum\n",
+			expectedBusyBox: true,
+			expectedCommands: map[string][]string{
+				"stat": {"busybox", "stat"}, "find": {"busybox", "find"}, "readlink": {"busybox", "readlink"}, "od": {"busybox", "od"}, "sha256sum": {"busybox", "sha256sum"},
+			},
+		},
+		{
+			name:            "Applets without busybox in PATH",
+			probeOutput:     "tool sh /bin/sh\ntool stat /usr/bin/stat\napplet find\n",
+			expectedBusyBox: false,
+			expectedCommands: map[string][]string{
+				"stat": {"stat"},
+			},
+		},
+		{
+			name:            "BSD hashing command",
+			probeOutput:     "tool stat /usr/bin/stat\ntool sha256 /sbin/sha256\ntool openssl /usr/bin/openssl\n",
+			expectedBusyBox: false,
+			expectedCommands: map[string][]string{
+				"stat": {"stat"}, "sha256sum": {"sha256", "-r"},
+			},
+		},
+		{
+			name:            "OpenSSL hashing command",
+			probeOutput:     "tool openssl /usr/bin/openssl\n",
+			expectedBusyBox: false,
+			expectedCommands: map[string][]string{
+				"sha256sum": {"openssl", "dgst", "-sha256", "-r"},
+			},
+		},
+		{
+			name:             "Empty output",
+			probeOutput:      "",
+			expectedBusyBox:  false,
+			expectedCommands: map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capabilities := parseRemoteCapabilities(test.probeOutput)
+			if capabilities.BusyBox != test.expectedBusyBox {
+				t.Errorf("BusyBox = %v, expected %v", capabilities.BusyBox, test.expectedBusyBox)
+			}
+			if !reflect.DeepEqual(capabilities.Commands, test.expectedCommands) {
+				t.Errorf("Commands = %v, expected %v", capabilities.Commands, test.expectedCommands)
+			}
+		})
+	}
+}
+
+func TestCheckRemoteCapabilities(t *testing.T) {
+	complete := parseRemoteCapabilities("tool stat /usr/bin/stat\ntool find /usr/bin/find\ntool readlink /usr/bin/readlink\ntool od /usr/bin/od\ntool sudo /usr/bin/sudo\n")
+	noHashing := parseRemoteCapabilities("tool stat /usr/bin/stat\ntool find /usr/bin/find\ntool readlink /usr/bin/readlink\n")
+	noStat := parseRemoteCapabilities("tool find /usr/bin/find\ntool readlink /usr/bin/readlink\ntool sha256sum /usr/bin/sha256sum\n")
+
+	tests := []struct {
+		name         string
+		capabilities RemoteCapabilities
+		method       string
+		expectError  bool
+	}{
+		{"Complete with sudo", complete, "sudo", false},
+		{"Complete without escalation", complete, "none", false},
+		{"Escalation not installed", complete, "doas", true},
+		{"No hashing command or od", noHashing, "none", true},
+		{"No stat", noStat, "none", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkRemoteCapabilities(test.capabilities, PrivilegeEscalation{Method: test.method})
+			if (err != nil) != test.expectError {
+				t.Errorf("checkRemoteCapabilities() error = %v, expected error: %v", err, test.expectError)
+			}
+		})
+	}
+}
+
+// Runs the capability probe against a BusyBox stand-in (a multi-call script with applet links)
+func TestRemoteCapabilityProbeBusyBox(t *testing.T) {
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available to run the probe")
+	}
+
+	standInDirectory := t.TempDir()
+	busyBoxPath := filepath.Join(standInDirectory, "busybox")
+	busyBoxScript := "#!" + shellPath + `
+applet=${0##*/}
+if [ "$applet" = busybox ]; then
+	if [ "$1" = --list ]; then
+		printf '%s\n' sh find stat readlink od sha256sum
+		exit 0
+	fi
+	applet=$1
+	shift
+fi
+PATH='` + os.Getenv("PATH") + `' exec "$applet" "$@"
+`
+	err = os.WriteFile(busyBoxPath, []byte(busyBoxScript), 0755)
+	if err != nil {
+		t.Fatalf("failed to write BusyBox stand-in: %v", err)
+	}
+	// Only some applets are linked, like an embedded image
+	for _, applet := range []string{"sh", "stat", "find", "readlink"} {
+		err = os.Symlink("busybox", filepath.Join(standInDirectory, applet))
+		if err != nil {
+			t.Fatalf("failed to link applet: %v", err)
+		}
+	}
+
+	command := exec.Command(shellPath, append([]string{"-c", remoteCapabilityProbe, "sh"}, remoteCapabilityTools...)...)
+	command.Env = []string{"PATH=" + standInDirectory}
+	probeOutput, err := command.Output()
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+
+	capabilities := parseRemoteCapabilities(string(probeOutput))
+	if !capabilities.BusyBox {
+		t.Errorf("BusyBox userland not detected from probe output:\n%s", probeOutput)
+	}
+	expectedCommands := map[string][]string{
+		"stat":      {"stat"},
+		"find":      {"find"},
+		"readlink":  {"readlink"},
+		"od":        {"busybox", "od"},
+		"sha256sum": {"busybox", "sha256sum"},
+	}
+	if !reflect.DeepEqual(capabilities.Commands, expectedCommands) {
+		t.Errorf("Commands = %v, expected %v\nprobe output:\n%s", capabilities.Commands, expectedCommands, probeOutput)
+	}
+	if capabilities.Tools["sudo"] != "" {
+		t.Errorf("sudo should not be found in the stand-in PATH")
+	}
+}
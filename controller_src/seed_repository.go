@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -79,55 +80,36 @@ func seedRepositoryFiles(hostOverride string, remoteFileOverride string) {
 		}
 
 		// Connect to the SSH server
-		client, err := connectToSSH(hostInfo.Endpoint, hostInfo.EndpointUser, hostInfo.Password, hostInfo.PrivateKey, hostInfo.KeyAlgo)
+		client, err := connectToSSH(hostInfo)
 		logError("Failed connect to SSH server", err, false)
 		defer client.Close()
 
+		// Pick command variants for this hosts userland
+		escalation := hostPrivilegeEscalation(hostInfo)
+		capabilities, err := detectRemoteCapabilities(client, endpointName, escalation)
+		logError("Failed to detect remote host commands", err, false)
+
 		// Run menu for user to select desired files or direct download
-		selectedFiles := make(map[string][]string)
+		selectedFiles := make(map[string]RemoteFileInfo)
 		if remoteFileOverride == "" {
-			selectedFiles, err = runSelection(endpointName, client, hostInfo.Password)
+			selectedFiles, err = runSelection(endpointName, client, escalation, capabilities)
 			logError("Error retrieving remote file list", err, false)
 		} else {
 			// Get remote file metadata
 			remoteFiles := strings.Split(remoteFileOverride, ",")
 			for _, remoteFile := range remoteFiles {
-				// Ls the remote file for metadata information
-				command := "ls -lA " + remoteFile
-				var fileLS string
-				fileLS, err = RunSSHCommand(client, command, "", config.DisableSudo, hostInfo.Password, 30)
+				// Stat the remote file for metadata information
+				var fileInfo RemoteFileInfo
+				fileInfo, err = statRemotePath(client, escalation, capabilities, remoteFile)
 				logError("Failed to retrieve remote file information", err, false)
 
-				// Split ls output into fields for this file
-				fileInfo := strings.Fields(fileLS)
-
-				// Skip misc ls output
-				if len(fileInfo) < 9 {
-					continue
-				}
-
-				// Split out permissions and check for directory or regular file
-				fileType := string(fileInfo[0][0])
-
-				// Identify if file is directory
-				if fileType == "d" {
-					// Skip file if dir
-					continue
-				} else if fileType != "-" {
-					// Skip other non-files
+				// Skip anything but existing regular files
+				if !fileInfo.Exists || fileInfo.Type != "file" {
 					continue
 				}
 
-				// Filtering file metadata
-				fileName := string(fileInfo[8])
-				permissions := string(fileInfo[0][1:])
-				fileOwner := string(fileInfo[2])
-				fileGroup := string(fileInfo[3])
-
 				// Add file info to map
-				selectedFiles[fileName] = append(selectedFiles[fileName], permissions)
-				selectedFiles[fileName] = append(selectedFiles[fileName], fileOwner)
-				selectedFiles[fileName] = append(selectedFiles[fileName], fileGroup)
+				selectedFiles[remoteFile] = fileInfo
 			}
 		}
 
@@ -137,29 +119,32 @@ func seedRepositoryFiles(hostOverride string, remoteFileOverride string) {
 
 		// Download user file choices to local repo and format
 		for targetFilePath, fileInfo := range selectedFiles {
-			err = retrieveSelectedFile(targetFilePath, fileInfo, endpointName, client, hostInfo.Password, hostInfo.RemoteTransferBuffer)
+			err = retrieveSelectedFile(targetFilePath, fileInfo, endpointName, client, escalation, capabilities, hostInfo.RemoteTransferBuffer)
 			logError("Error seeding repository", err, false)
 		}
 	}
 
+	// Passwords are no longer needed
+	wipeHostSecrets()
+	wipeVault()
+
 	printMessage(VerbosityStandard, "============================================================\n")
 }
 
 // Runs the CLI-based menu that user will use to select which files to download
-func runSelection(endpointName string, client *ssh.Client, SudoPassword string) (selectedFiles map[string][]string, err error) {
+func runSelection(endpointName string, client *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities) (selectedFiles map[string]RemoteFileInfo, err error) {
 	// Start selection at root of filesystem - '/'
 	directory := "/"
 	directoryStack := []string{"/"}
 
 	// Initialize return value
-	selectedFiles = make(map[string][]string)
+	selectedFiles = make(map[string]RemoteFileInfo)
 
 	// Loop until user is done selecting
 	for {
 		// Get file names and info for the directory
-		command := "ls -lA " + directory
-		var directoryList string
-		directoryList, err = RunSSHCommand(client, command, "", config.DisableSudo, SudoPassword, 30)
+		var directoryEntries []RemoteFileInfo
+		directoryEntries, err = listRemoteDirectory(client, escalation, capabilities, directory, 30)
 		if err != nil {
 			// All errors except permission denied exits selection menu
 			if !strings.Contains(err.Error(), "Permission denied") {
@@ -183,23 +168,20 @@ func runSelection(endpointName string, client *ssh.Client, SudoPassword string)
 			continue
 		}
 
-		// Create array of files in the directory from the ls output
-		directoryListFiles := strings.Split(directoryList, "\n")
-
 		// Initialize vars for holding file information
 		var dirList []string
-		filesInfo := make(map[string][]string)
+		filesInfo := make(map[string]RemoteFileInfo)
 		isDir := make(map[string]bool)
 		maxLength := 0
 
-		// Extract information from the ls output
-		for _, file := range directoryListFiles {
-			// Retrieve File metadata
-			fileType, permissions, fileOwner, fileGroup, _, fileName, errLocal := extractMetadataFromLS(file)
-			if errLocal != nil {
-				// Only error for this function is incomplete ls, which we skip
-				continue
-			}
+		// Sort entries by name for the menu
+		sort.Slice(directoryEntries, func(i, j int) bool {
+			return directoryEntries[i].Name < directoryEntries[j].Name
+		})
+
+		// Extract information from the directory entries
+		for _, fileInfo := range directoryEntries {
+			fileName := fileInfo.Name
 
 			// Determine column spacing from longest file name
 			if length := len(fileName); length > maxLength {
@@ -210,18 +192,15 @@ func runSelection(endpointName string, client *ssh.Client, SudoPassword string)
 			dirList = append(dirList, fileName)
 
 			// Identify if file is directory
-			if fileType == "d" {
+			if fileInfo.Type == "directory" {
 				// Skip further processing of directories
 				isDir[fileName] = true
 				continue
-			} else if fileType == "-" {
-				isDir[fileName] = false
 			}
+			isDir[fileName] = false
 
 			// Add file info to map
-			filesInfo[fileName] = append(filesInfo[fileName], permissions)
-			filesInfo[fileName] = append(filesInfo[fileName], fileOwner)
-			filesInfo[fileName] = append(filesInfo[fileName], fileGroup)
+			filesInfo[fileName] = fileInfo
 		}
 
 		// Use the length of dir list after filtering
@@ -320,9 +299,7 @@ func runSelection(endpointName string, client *ssh.Client, SudoPassword string)
 				absolutePath := filepath.Join(directory, name)
 
 				// Save file and relevant metadata into map
-				selectedFiles[absolutePath] = append(selectedFiles[absolutePath], filesInfo[name][0])
-				selectedFiles[absolutePath] = append(selectedFiles[absolutePath], filesInfo[name][1])
-				selectedFiles[absolutePath] = append(selectedFiles[absolutePath], filesInfo[name][2])
+				selectedFiles[absolutePath] = filesInfo[name]
 			}
 		}
 
@@ -338,7 +315,7 @@ func runSelection(endpointName string, client *ssh.Client, SudoPassword string)
 // Downloads user selected files from remote host
 // Adds metadata header
 // Recreates directory structure of remote host in the local repository
-func retrieveSelectedFile(targetFilePath string, fileInfo []string, endpointName string, client *ssh.Client, SudoPassword string, tmpRemoteFilePath string) (err error) {
+func retrieveSelectedFile(targetFilePath string, fileInfo RemoteFileInfo, endpointName string, client *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, tmpRemoteFilePath string) (err error) {
 	// Recommended reload commands for known configuration files
 	// If user wants reloads, they will be prompted to use the reloads below if the file has the prefix of a map key (reloads are optional)
 	// names surrounded by '??' indicate sections that should be filled in with relevant info from user selected files
@@ -358,24 +335,8 @@ func retrieveSelectedFile(targetFilePath string, fileInfo []string, endpointName
 		"/etc/syslog-ng":       {"syslog-ng -s", "systemctl restart syslog-ng", "systemctl is-active syslog-ng"},
 	}
 
-	// Copy desired file to buffer location
-	command := "cp " + targetFilePath + " " + tmpRemoteFilePath
-	_, err = RunSSHCommand(client, command, "", config.DisableSudo, SudoPassword, 20)
-	if err != nil {
-		err = fmt.Errorf("ssh command failure: %v", err)
-		return
-	}
-
-	// Ensure buffer file can be read and then deleted later
-	command = "chmod 666 " + tmpRemoteFilePath
-	_, err = RunSSHCommand(client, command, "", config.DisableSudo, SudoPassword, 10)
-	if err != nil {
-		err = fmt.Errorf("ssh command failure: %v", err)
-		return
-	}
-
 	// Download remote file contents
-	fileContents, err := SCPDownload(client, tmpRemoteFilePath)
+	fileContents, err := downloadRemoteFile(client, escalation, targetFilePath, tmpRemoteFilePath)
 	if err != nil {
 		return
 	}
@@ -386,13 +347,46 @@ func retrieveSelectedFile(targetFilePath string, fileInfo []string, endpointName
 	// Use target file path and hosts name for repo file location
 	configFilePath := endpointName + hostFilePath
 
-	// Convert permissions string to number format
-	numberPermissions := permissionsSymbolicToNumeric(fileInfo[0])
-
 	// Put metadata into JSON format
 	var metadataHeader MetaHeader
-	metadataHeader.TargetFileOwnerGroup = fileInfo[1] + ":" + fileInfo[2]
-	metadataHeader.TargetFilePermissions = numberPermissions
+	// Ids without a name on the remote host are kept numeric
+	fileOwner, fileGroup := fileInfo.Owner, fileInfo.Group
+	if fileOwner == "UNKNOWN" {
+		fileOwner = strconv.Itoa(fileInfo.UID)
+	}
+	if fileGroup == "UNKNOWN" {
+		fileGroup = strconv.Itoa(fileInfo.GID)
+	}
+	metadataHeader.TargetFileOwnerGroup = fileOwner + ":" + fileGroup
+	metadataHeader.TargetFilePermissions = formatFilePermissions(fileInfo.Permissions)
+
+	// Extended metadata is only recorded when the remote host supports and uses it
+	if capabilities.SELinux {
+		var context string
+		context, err = remoteSELinuxContext(client, escalation, capabilities, targetFilePath)
+		if err != nil {
+			return
+		}
+		if context != "" {
+			metadataHeader.TargetSELinuxContext = &context
+		}
+	}
+	if capabilities.Tools["getfacl"] != "" && capabilities.Tools["setfacl"] != "" {
+		metadataHeader.TargetACL, err = remoteACL(client, escalation, capabilities, targetFilePath)
+		if err != nil {
+			return
+		}
+		if len(metadataHeader.TargetACL) == 0 {
+			metadataHeader.TargetACL = nil
+		}
+	}
+	if capabilities.Tools["lsattr"] != "" && capabilities.Tools["chattr"] != "" {
+		// Filesystems without attribute support fail lsattr
+		attributes, errLocal := remoteAttributes(client, escalation, capabilities, targetFilePath)
+		if errLocal == nil && attributes != "" {
+			metadataHeader.TargetAttributes = &attributes
+		}
+	}
 
 	// Ask user for confirmation to use reloads
 	reloadWanted, err := promptUser("Does file '%s' need reload commands? [y/N]: ", configFilePath)
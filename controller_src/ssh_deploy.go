@@ -41,6 +41,12 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 	commitFileByCommand := make(map[string][]string)
 	var commitFilesNoReload []string
 	for _, commitFilePath := range commitFilePaths {
+		// Directory metadata with only file defaults has nothing to deploy
+		_, fileLoaded := commitFileInfo[commitFilePath]
+		if !fileLoaded {
+			continue
+		}
+
 		// New files with reload commands
 		if commitFileInfo[commitFilePath].ReloadRequired {
 			// Create an ID based on the command array to uniquely identify the group that files will belong to
@@ -58,8 +64,8 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 
 	printMessage(VerbosityProgress, "Host %s: Connecting to SSH server\n", endpointName)
 
-	// Get sudo password from info map
-	Password := endpointInfo.Password
+	// Get privilege escalation method and password from info map
+	escalation := hostPrivilegeEscalation(endpointInfo)
 
 	// Bail before initiating outbound connections if in dry-run mode
 	if dryRunRequested {
@@ -67,7 +73,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 	}
 
 	// Connect to the SSH server
-	sshClient, err := connectToSSH(endpointInfo.Endpoint, endpointInfo.EndpointUser, endpointInfo.Password, endpointInfo.PrivateKey, endpointInfo.KeyAlgo)
+	sshClient, err := connectToSSH(endpointInfo)
 	if err != nil {
 		recordDeploymentFailure(endpointName, commitFilePaths, 0, fmt.Errorf("failed connect to SSH server %v", err))
 		return
@@ -76,6 +82,13 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 
 	printMessage(VerbosityProgress, "Host %s: Connected to SSH server\n", endpointName)
 
+	// Pick command variants for this hosts userland
+	capabilities, err := detectRemoteCapabilities(sshClient, endpointName, escalation)
+	if err != nil {
+		recordDeploymentFailure(endpointName, commitFilePaths, 0, err)
+		return
+	}
+
 	// Get this hosts remote transfer buffer file path
 	tmpRemoteFilePath := endpointInfo.RemoteTransferBuffer
 	tmpBackupPath := endpointInfo.RemoteBackupDir
@@ -86,8 +99,8 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 	printMessage(VerbosityProgress, "Host %s: Preparing remote config backup directory\n", endpointName)
 
 	// Create backup directory
-	command := "mkdir " + tmpBackupPath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, Password, 10)
+	command := buildCommand("mkdir", "--", tmpBackupPath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		// Since we blindly try to create the directory, ignore errors about it already existing
 		if !strings.Contains(err.Error(), "File exists") {
@@ -126,7 +139,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 				for _, command := range commitFileInfo[commitFilePath].Checks {
 					printMessage(VerbosityData, "Host %s:   Running check command '%s'\n", endpointName, command)
 
-					_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, Password, 90)
+					_, err = RunSSHCommand(sshClient, command, "root", escalation, 90)
 					if err != nil {
 						// Record this failed command - first failure always stops file deployment
 						recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, fmt.Errorf("failed SSH Command on host during check command %s: %v", command, err))
@@ -146,15 +159,39 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 			printMessage(VerbosityData, "Host %s:   Backing up config %s\n", endpointName, targetFilePath)
 
 			// Create a backup config on remote host if remote file already exists
-			oldRemoteFileHash, err := backupOldConfig(sshClient, Password, targetFilePath, tmpBackupPath)
+			oldRemoteFileHash, err := backupOldConfig(sshClient, escalation, capabilities, targetFilePath, tmpBackupPath)
 			if err != nil {
 				recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, err)
 				dontRunReloads = true
 				continue
 			}
 
-			// Compare hashes and skip to next file deployment if remote is same as local
-			if oldRemoteFileHash == commitFileInfo[commitFilePath].Hash {
+			// Managed blocks deploy the remote file with the block inserted
+			deployInfo := commitFileInfo[commitFilePath]
+			if deployInfo.BlockMarker != "" {
+				deployInfo, err = mergeManagedBlock(sshClient, escalation, targetFilePath, tmpRemoteFilePath, oldRemoteFileHash, deployInfo)
+				if err != nil {
+					recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, err)
+					dontRunReloads = true
+					continue
+				}
+			}
+
+			// Compare hashes and only correct metadata drift if remote is same as local
+			if oldRemoteFileHash == deployInfo.Hash {
+				var MetadataModified bool
+				MetadataModified, err = applyFileMetadata(sshClient, escalation, capabilities, targetFilePath, deployInfo)
+				if err != nil {
+					recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, fmt.Errorf("failed correcting metadata: %v", err))
+					dontRunReloads = true
+					continue
+				}
+				if MetadataModified {
+					printMessage(VerbosityProgress, "Host %s: File '%s' hash matches local... corrected metadata drift\n", endpointName, targetFilePath)
+					backupFileHashes[targetFilePath] = oldRemoteFileHash
+					continue
+				}
+
 				printMessage(VerbosityProgress, "Host %s: File '%s' hash matches local... skipping this file\n", endpointName, targetFilePath)
 				filesRequiringReload-- // Decrement counter when one file is found to be identical
 				continue
@@ -163,10 +200,10 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 			printMessage(VerbosityData, "Host %s:   Transferring config %s to remote\n", endpointName, commitFilePath)
 
 			// Transfer config file to remote with correct ownership and permissions
-			err = createFile(sshClient, Password, targetFilePath, tmpRemoteFilePath, commitFileInfo[commitFilePath].Data, commitFileInfo[commitFilePath].Hash, commitFileInfo[commitFilePath].FileOwnerGroup, commitFileInfo[commitFilePath].FilePermissions)
+			err = createFile(sshClient, escalation, capabilities, targetFilePath, tmpRemoteFilePath, deployInfo)
 			if err != nil {
 				recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, err)
-				err = restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, oldRemoteFileHash, Password)
+				err = restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, oldRemoteFileHash, escalation, capabilities)
 				if err != nil {
 					recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, fmt.Errorf("failed old config restoration: %v", err))
 				}
@@ -199,7 +236,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 		for _, command := range commandReloadArray {
 			printMessage(VerbosityData, "Host %s:   Running reload command '%s'\n", endpointName, command)
 
-			_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, Password, 90)
+			_, err = RunSSHCommand(sshClient, command, "root", escalation, 90)
 			if err != nil {
 				// Record this failed command - first failure always stops reloads
 				// Record failures using the arry of all files for this command group and signal to record all the files using index "0"
@@ -226,7 +263,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 				printMessage(VerbosityData, "Host %s:   Restoring config file %s due to failed reload command\n", endpointName, targetFilePath)
 
 				// Put backup file into origina location
-				err = restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, backupFileHashes[targetFilePath], Password)
+				err = restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, backupFileHashes[targetFilePath], escalation, capabilities)
 				if err != nil {
 					recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, fmt.Errorf("failed old config restoration: %v", err))
 				}
@@ -262,7 +299,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 			for _, command := range commitFileInfo[commitFilePath].Checks {
 				printMessage(VerbosityData, "Host %s:   Running check command '%s'\n", endpointName, command)
 
-				_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, Password, 90)
+				_, err = RunSSHCommand(sshClient, command, "root", escalation, 90)
 				if err != nil {
 					// Record this failed command - first failure always stops file deployment
 					recordDeploymentFailure(endpointName, commitFilePaths, commitIndex, fmt.Errorf("failed SSH Command on host during check command %s: %v", command, err))
@@ -281,7 +318,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 		if targetFileAction == "delete" {
 			printMessage(VerbosityData, "Host %s:   Deleting config %s\n", endpointName, targetFilePath)
 
-			err = deleteFile(sshClient, Password, targetFilePath)
+			err = deleteFile(sshClient, escalation, capabilities, targetFilePath)
 			if err != nil {
 				// Only record errors where removal of the specific file failed
 				if strings.Contains(err.Error(), "failed to remove file") {
@@ -298,11 +335,30 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 			continue
 		}
 
+		// Remove managed block from remote file if deleted in repo
+		if strings.HasPrefix(targetFileAction, "blockdelete") {
+			printMessage(VerbosityData, "Host %s:   Removing managed block from config %s\n", endpointName, targetFilePath)
+
+			blockMarker := strings.TrimPrefix(targetFileAction, "blockdelete between markers ")
+			var BlockRemoved bool
+			BlockRemoved, err = deleteManagedBlock(sshClient, escalation, capabilities, targetFilePath, tmpRemoteFilePath, tmpBackupPath, blockMarker)
+			if err != nil {
+				recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, err)
+				continue
+			}
+
+			// Only increment metrics for modifications
+			if BlockRemoved {
+				postDeployedConfigsLocal++
+			}
+			continue
+		}
+
 		// Create symbolic link if requested
 		if strings.Contains(targetFileAction, "symlinkcreate") {
 			printMessage(VerbosityData, "Host %s:   Creating symlink %s\n", endpointName, targetFilePath)
 
-			err = createSymLink(sshClient, Password, targetFilePath, targetFileAction)
+			err = createSymLink(sshClient, escalation, capabilities, targetFilePath, targetFileAction)
 			if err != nil {
 				recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, err)
 				continue
@@ -322,7 +378,7 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 
 			// Check if dir needs to be created/modified, and do so if required
 			var DirModified bool
-			DirModified, err = modifyDirectory(sshClient, Password, targetFilePath, commitFileInfo[commitFilePath].FileOwnerGroup, commitFileInfo[commitFilePath].FilePermissions)
+			DirModified, err = modifyDirectory(sshClient, escalation, capabilities, targetFilePath, commitFileInfo[commitFilePath])
 			if err != nil {
 				recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, err)
 				continue
@@ -340,14 +396,36 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 		printMessage(VerbosityData, "Host %s:   Backing up config %s\n", endpointName, targetFilePath)
 
 		// Create a backup config on remote host if remote file already exists
-		oldRemoteFileHash, err := backupOldConfig(sshClient, Password, targetFilePath, tmpBackupPath)
+		oldRemoteFileHash, err := backupOldConfig(sshClient, escalation, capabilities, targetFilePath, tmpBackupPath)
 		if err != nil {
 			recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, err)
 			continue
 		}
 
-		// Compare hashes and skip to next file deployment if remote is same as local
-		if oldRemoteFileHash == commitFileInfo[commitFilePath].Hash {
+		// Managed blocks deploy the remote file with the block inserted
+		deployInfo := commitFileInfo[commitFilePath]
+		if deployInfo.BlockMarker != "" {
+			deployInfo, err = mergeManagedBlock(sshClient, escalation, targetFilePath, tmpRemoteFilePath, oldRemoteFileHash, deployInfo)
+			if err != nil {
+				recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, err)
+				continue
+			}
+		}
+
+		// Compare hashes and only correct metadata drift if remote is same as local
+		if oldRemoteFileHash == deployInfo.Hash {
+			var MetadataModified bool
+			MetadataModified, err = applyFileMetadata(sshClient, escalation, capabilities, targetFilePath, deployInfo)
+			if err != nil {
+				recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, fmt.Errorf("failed correcting metadata: %v", err))
+				continue
+			}
+			if MetadataModified {
+				printMessage(VerbosityProgress, "Host %s: File '%s' hash matches local... corrected metadata drift\n", endpointName, targetFilePath)
+				postDeployedConfigsLocal++
+				continue
+			}
+
 			printMessage(VerbosityProgress, "Host %s: File '%s' hash matches local... skipping this file\n", endpointName, targetFilePath)
 			continue
 		}
@@ -355,10 +433,10 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 		printMessage(VerbosityData, "Host %s:   Transferring config %s to remote\n", endpointName, commitFilePath)
 
 		// Transfer config file to remote with correct ownership and permissions
-		err = createFile(sshClient, Password, targetFilePath, tmpRemoteFilePath, commitFileInfo[commitFilePath].Data, commitFileInfo[commitFilePath].Hash, commitFileInfo[commitFilePath].FileOwnerGroup, commitFileInfo[commitFilePath].FilePermissions)
+		err = createFile(sshClient, escalation, capabilities, targetFilePath, tmpRemoteFilePath, deployInfo)
 		if err != nil {
 			recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, err)
-			err = restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, oldRemoteFileHash, Password)
+			err = restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, oldRemoteFileHash, escalation, capabilities)
 			if err != nil {
 				recordDeploymentFailure(endpointName, commitFilesNoReload, commitIndex, fmt.Errorf("failed old config restoration: %v", err))
 			}
@@ -372,8 +450,8 @@ func deployConfigs(wg *sync.WaitGroup, semaphore chan struct{}, endpointInfo End
 	printMessage(VerbosityProgress, "Host %s: Cleaning up remote temporary directories\n", endpointName)
 
 	// Cleanup temporary files
-	command = "rm -r " + tmpRemoteFilePath + " " + tmpBackupPath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, Password, 30)
+	command = buildCommand("rm", "-r", "--", tmpRemoteFilePath, tmpBackupPath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 30)
 	if err != nil {
 		// Only print error if there was a file to remove in the first place
 		if !strings.Contains(err.Error(), "No such file or directory") {
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -16,39 +17,38 @@ import (
 // ###########################################
 
 // Run full deployment of a new file to remote host
-func createFile(sshClient *ssh.Client, SudoPassword string, targetFilePath string, tmpRemoteFilePath string, fileContents string, fileContentHash string, fileOwnerGroup string, filePermissions int) (err error) {
+func createFile(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, targetFilePath string, tmpRemoteFilePath string, fileInfo CommitFileInfo) (err error) {
+	// Immutable and append-only files cannot be replaced (only cleared when metadata manages attributes)
+	if fileInfo.Attributes != nil {
+		err = clearBlockingAttributes(sshClient, escalation, capabilities, targetFilePath)
+		if err != nil {
+			return
+		}
+	}
+
 	// Transfer local file to remote
-	err = TransferFile(sshClient, fileContents, targetFilePath, SudoPassword, tmpRemoteFilePath, fileOwnerGroup, filePermissions)
+	err = TransferFile(sshClient, fileInfo.Data, targetFilePath, escalation, capabilities, tmpRemoteFilePath, fileInfo.FileOwnerGroup, fileInfo.FilePermissions)
 	if err != nil {
 		err = fmt.Errorf("failed SFTP config file transfer to remote host: %v", err)
 		return
 	}
 
-	// Check if deployed file is present on disk
-	NewFileExists, err := CheckRemoteFileDirExistence(sshClient, targetFilePath, SudoPassword, false)
+	// Apply remaining metadata (SELinux, ACL, attributes) to the file now in place
+	_, err = applyFileMetadata(sshClient, escalation, capabilities, targetFilePath, fileInfo)
 	if err != nil {
-		err = fmt.Errorf("error checking deployed file presence on remote host: %v", err)
-		return
-	}
-	// Failed transfer
-	if !NewFileExists {
-		err = fmt.Errorf("deployed file on remote host is not present after file transfer")
+		err = fmt.Errorf("failed applying metadata to deployed file: %v", err)
 		return
 	}
 
 	// Get Hash of new deployed conf file
-	command := "sha256sum " + targetFilePath
-	CommandOutput, err := RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 90)
+	NewRemoteFileHash, err := remoteFileHash(sshClient, escalation, capabilities, targetFilePath)
 	if err != nil {
 		err = fmt.Errorf("failed SSH Command on host during hash of deployed file: %v", err)
 		return
 	}
 
-	// Parse hash command output to get just the hex
-	NewRemoteFileHash := SHA256RegEx.FindString(CommandOutput)
-
 	// Compare hashes and restore old conf if they dont match
-	if NewRemoteFileHash != fileContentHash {
+	if NewRemoteFileHash != fileInfo.Hash {
 		err = fmt.Errorf("hash of config file post deployment does not match hash of pre deployment")
 		return
 	}
@@ -56,41 +56,166 @@ func createFile(sshClient *ssh.Client, SudoPassword string, targetFilePath strin
 	return
 }
 
+// Replaces file content with the remote file content around the managed block
+// Remote file content is verified against the hash taken during backup
+func mergeManagedBlock(sshClient *ssh.Client, escalation PrivilegeEscalation, targetFilePath string, tmpRemoteFilePath string, oldRemoteFileHash string, fileInfo CommitFileInfo) (deployInfo CommitFileInfo, err error) {
+	deployInfo = fileInfo
+
+	// Missing remote file starts out empty
+	var remoteFileContent string
+	if oldRemoteFileHash != "" {
+		remoteFileContent, err = downloadRemoteFile(sshClient, escalation, targetFilePath, tmpRemoteFilePath)
+		if err != nil {
+			err = fmt.Errorf("failed retrieving remote file for managed block: %v", err)
+			return
+		}
+		if SHA256Sum(remoteFileContent) != oldRemoteFileHash {
+			err = fmt.Errorf("hash of downloaded remote file does not match hash of backed up file")
+			return
+		}
+	}
+
+	deployInfo.Data, err = insertManagedBlock(remoteFileContent, fileInfo.Data, fileInfo.BlockMarker)
+	if err != nil {
+		return
+	}
+	deployInfo.Hash = SHA256Sum(deployInfo.Data)
+	return
+}
+
+// Removes a managed block from a remote file, keeping its content, owner, and permissions otherwise
+// Missing files or files without the block are left alone
+func deleteManagedBlock(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, targetFilePath string, tmpRemoteFilePath string, tmpBackupPath string, marker string) (Removed bool, err error) {
+	remoteInfo, err := statRemotePath(sshClient, escalation, capabilities, targetFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed checking file presence on remote host: %v", err)
+		return
+	}
+	if !remoteInfo.Exists {
+		return
+	}
+
+	oldRemoteFileHash, err := backupOldConfig(sshClient, escalation, capabilities, targetFilePath, tmpBackupPath)
+	if err != nil {
+		return
+	}
+
+	remoteFileContent, err := downloadRemoteFile(sshClient, escalation, targetFilePath, tmpRemoteFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed retrieving remote file for managed block: %v", err)
+		return
+	}
+	if SHA256Sum(remoteFileContent) != oldRemoteFileHash {
+		err = fmt.Errorf("hash of downloaded remote file does not match hash of backed up file")
+		return
+	}
+
+	var deployInfo CommitFileInfo
+	deployInfo.Data, err = removeManagedBlock(remoteFileContent, marker)
+	if err != nil {
+		return
+	}
+	if deployInfo.Data == remoteFileContent {
+		return
+	}
+	deployInfo.Hash = SHA256Sum(deployInfo.Data)
+	deployInfo.FileOwnerGroup = strconv.Itoa(remoteInfo.UID) + ":" + strconv.Itoa(remoteInfo.GID)
+	deployInfo.FilePermissions = remoteInfo.Permissions
+
+	err = createFile(sshClient, escalation, capabilities, targetFilePath, tmpRemoteFilePath, deployInfo)
+	if err != nil {
+		restoreErr := restoreOldConfig(sshClient, targetFilePath, tmpBackupPath, oldRemoteFileHash, escalation, capabilities)
+		if restoreErr != nil {
+			err = fmt.Errorf("%v (failed old config restoration: %v)", err, restoreErr)
+		}
+		return
+	}
+	Removed = true
+	return
+}
+
+// Retrieves content of a remote file through the transfer buffer (file may only be readable with privilege escalation)
+func downloadRemoteFile(sshClient *ssh.Client, escalation PrivilegeEscalation, remoteFilePath string, tmpRemoteFilePath string) (fileContent string, err error) {
+	// Remove previous buffer so the copy is created with the permissions of the remote file
+	command := buildCommand("rm", "-f", "--", tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("ssh command failure: %v", err)
+		return
+	}
+
+	// Copy desired file to buffer location
+	command = buildCommand("cp", "--", remoteFilePath, tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 20)
+	if err != nil {
+		err = fmt.Errorf("ssh command failure: %v", err)
+		return
+	}
+
+	// Ensure buffer file can be read by the login user only
+	command = buildCommand("chown", "--", sshClient.User(), tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("ssh command failure: %v", err)
+		return
+	}
+	command = buildCommand("chmod", "600", "--", tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("ssh command failure: %v", err)
+		return
+	}
+
+	fileContent, err = SCPDownload(sshClient, tmpRemoteFilePath)
+	if err != nil {
+		return
+	}
+
+	// Buffer is recreated by the next transfer (as the login user)
+	command = buildCommand("rm", "-f", "--", tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("ssh command failure: %v", err)
+		return
+	}
+	return
+}
+
 // Create a copy of an existing config file into the temporary backup file path (only if targetFilePath exists)
 // Also returns the hash of the file before being touched for verification of restore if needed
-func backupOldConfig(sshClient *ssh.Client, SudoPassword string, targetFilePath string, tmpBackupPath string) (oldRemoteFileHash string, err error) {
+func backupOldConfig(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, targetFilePath string, tmpBackupPath string) (oldRemoteFileHash string, err error) {
 	// Find if target file exists on remote
-	oldFileExists, err := CheckRemoteFileDirExistence(sshClient, targetFilePath, SudoPassword, false)
+	oldFileInfo, err := statRemotePath(sshClient, escalation, capabilities, targetFilePath)
 	if err != nil {
 		err = fmt.Errorf("failed checking file presence on remote host: %v", err)
 		return
 	}
 
 	// If remote file doesn't exist, return early
-	if !oldFileExists {
+	if !oldFileInfo.Exists {
+		return
+	}
+	if oldFileInfo.Type == "directory" {
+		err = fmt.Errorf("remote path is a directory, refusing to replace it with a file")
 		return
 	}
 
 	// Get the SHA256 hash of the remote old conf file
-	command := "sha256sum " + targetFilePath
-	CommandOutput, err := RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 90)
+	oldRemoteFileHash, err = remoteFileHash(sshClient, escalation, capabilities, targetFilePath)
 	if err != nil {
 		err = fmt.Errorf("failed SSH Command on host during hash of old config file: %v", err)
 		return
 	}
 
-	// Parse hash command output to get just the hex
-	oldRemoteFileHash = SHA256RegEx.FindString(CommandOutput)
-
 	// Unique ID for this backup - base64 the target file path - can be later decoded for restoration
 	backupFileName := base64.StdEncoding.EncodeToString([]byte(targetFilePath))
 
 	// Absolute path to backup file
 	tmpBackupFilePath := tmpBackupPath + "/" + backupFileName
 
-	// Backup old config
-	command = "cp -p " + targetFilePath + " " + tmpBackupFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 90)
+	// Backup old config (with ACL, SELinux context and other extended attributes where supported)
+	command := buildCommand("cp", "-a", "--", targetFilePath, tmpBackupFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 90)
 	if err != nil {
 		err = fmt.Errorf("error making backup of old config file: %v", err)
 		return
@@ -102,7 +227,7 @@ func backupOldConfig(sshClient *ssh.Client, SudoPassword string, targetFilePath
 // Moves backup config file into original location after file deployment failure
 // Assumes backup file is located in the directory at backupFilePath
 // Ensures restoration worked by hashing and comparing to pre-deployment file hash
-func restoreOldConfig(sshClient *ssh.Client, targetFilePath string, tmpBackupPath string, oldRemoteFileHash string, SudoPassword string) (err error) {
+func restoreOldConfig(sshClient *ssh.Client, targetFilePath string, tmpBackupPath string, oldRemoteFileHash string, escalation PrivilegeEscalation, capabilities RemoteCapabilities) (err error) {
 	// Empty oldRemoteFileHash indicates there was nothing to backup, therefore restore should not occur
 	if oldRemoteFileHash == "" {
 		return
@@ -112,25 +237,27 @@ func restoreOldConfig(sshClient *ssh.Client, targetFilePath string, tmpBackupPat
 	backupFileName := base64.StdEncoding.EncodeToString([]byte(targetFilePath))
 	backupFilePath := tmpBackupPath + "/" + backupFileName
 
+	// Attributes applied by this deployment would block the restore
+	err = clearBlockingAttributes(sshClient, escalation, capabilities, targetFilePath)
+	if err != nil {
+		return
+	}
+
 	// Move backup conf into place
-	command := "mv " + backupFilePath + " " + targetFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 90)
+	command := buildCommand("mv", "--", backupFilePath, targetFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 90)
 	if err != nil {
 		err = fmt.Errorf("failed SSH Command on host during restoration of old config file: %v", err)
 		return
 	}
 
 	// Check to make sure restore worked with hash
-	command = "sha256sum " + targetFilePath
-	CommandOutput, err := RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 90)
+	RemoteFileHash, err := remoteFileHash(sshClient, escalation, capabilities, targetFilePath)
 	if err != nil {
 		err = fmt.Errorf("failed SSH Command on host during hash of old config file: %v", err)
 		return
 	}
 
-	// Parse hash command output to get just the hex
-	RemoteFileHash := SHA256RegEx.FindString(CommandOutput)
-
 	// Ensure restoration succeeded
 	if oldRemoteFileHash != RemoteFileHash {
 		err = fmt.Errorf("restored file hash is different than its original hash")
@@ -140,42 +267,86 @@ func restoreOldConfig(sshClient *ssh.Client, targetFilePath string, tmpBackupPat
 	return
 }
 
-// Checks if file/dir is already present on remote host
-func CheckRemoteFileDirExistence(sshClient *ssh.Client, remotePath string, SudoPassword string, IsDir bool) (Exists bool, err error) {
-	var command string
-	if IsDir {
-		command = "ls -d " + remotePath
-	} else {
-		command = "ls " + remotePath
+// Retrieves metadata of a remote path (symbolic links are not followed)
+// A missing path is not an error, it is returned with Exists set to false
+func statRemotePath(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remotePath string) (info RemoteFileInfo, err error) {
+	// Existence is tested by the shell, so no localized error messages are parsed
+	// Symbolic link targets follow on the next line
+	statCommand := buildCommand(append(remoteCommand(capabilities, "stat"), "-c", remoteStatFormat, "--")...)
+	readLinkCommand := buildCommand(append(remoteCommand(capabilities, "readlink"), "--")...)
+	statScript := `if [ -e "$1" ] || [ -h "$1" ]; then LC_ALL=C ` + statCommand + ` "$1" && if [ -h "$1" ]; then ` + readLinkCommand + ` "$1"; fi; fi`
+	command := buildCommand("sh", "-c", statScript, "sh", remotePath)
+	commandOutput, err := RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve metadata of '%s': %v", remotePath, err)
+		return
 	}
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+
+	// Empty output means path does not exist
+	if commandOutput == "" {
+		return
+	}
+
+	statLine, linkTarget, _ := strings.Cut(commandOutput, "\n")
+	info, err = parseRemoteStat(statLine, false)
 	if err != nil {
-		Exists = false
-		if strings.Contains(err.Error(), "No such file or directory") {
-			err = nil
-			return
-		}
+		err = fmt.Errorf("failed to parse metadata of '%s': %v", remotePath, err)
 		return
 	}
-	Exists = true
+	info.Name = filepath.Base(remotePath)
+	if info.Type == "symlink" {
+		info.LinkTarget = strings.TrimSuffix(linkTarget, "\n")
+	}
+	return
+}
+
+// Retrieves metadata of all entries in a remote directory (symbolic links are not followed)
+func listRemoteDirectory(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, directoryPath string, timeout int) (entries []RemoteFileInfo, err error) {
+	findCommand := buildCommand(remoteCommand(capabilities, "find")...)
+	statCommand := buildCommand(append(remoteCommand(capabilities, "stat"), "-c", remoteStatFormat+"\t%n", "--")...)
+	listScript := `LC_ALL=C exec ` + findCommand + ` "$1" -mindepth 1 -maxdepth 1 -exec ` + statCommand + ` {} +`
+	command := buildCommand("sh", "-c", listScript, "sh", directoryPath)
+	commandOutput, err := RunSSHCommand(sshClient, command, "root", escalation, timeout)
+	if err != nil {
+		err = fmt.Errorf("failed to list directory '%s': %v", directoryPath, err)
+		return
+	}
+
+	for _, statLine := range strings.Split(commandOutput, "\n") {
+		if statLine == "" {
+			continue
+		}
+
+		entry, errLocal := parseRemoteStat(statLine, true)
+		if errLocal != nil {
+			// Names with newlines are split across lines, skip the fragments
+			printMessage(VerbosityDebug, "Skipping unparsable directory entry in '%s': %v\n", directoryPath, errLocal)
+			continue
+		}
+		entries = append(entries, entry)
+	}
 	return
 }
 
 // Transfers file content in variable to remote temp buffer, then moves into remote file path location
 // Uses global var for remote temp buffer file path location
-func TransferFile(sshClient *ssh.Client, localFileContent string, remoteFilePath string, SudoPassword string, tmpRemoteFilePath string, fileOwnerGroup string, filePermissions int) (err error) {
+func TransferFile(sshClient *ssh.Client, localFileContent string, remoteFilePath string, escalation PrivilegeEscalation, capabilities RemoteCapabilities, tmpRemoteFilePath string, fileOwnerGroup string, filePermissions uint32) (err error) {
 	var command string
 
 	// Check if remote dir exists, if not create
 	directoryPath := filepath.Dir(remoteFilePath)
-	directoryExists, err := CheckRemoteFileDirExistence(sshClient, directoryPath, SudoPassword, true)
+	directoryInfo, err := statRemotePath(sshClient, escalation, capabilities, directoryPath)
 	if err != nil {
 		err = fmt.Errorf("failed checking directory existence: %v", err)
 		return
 	}
-	if !directoryExists {
-		command = "mkdir -p " + directoryPath
-		_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	if directoryInfo.Exists && directoryInfo.Type != "directory" {
+		err = fmt.Errorf("parent path '%s' exists but is a %s, not a directory", directoryPath, directoryInfo.Type)
+		return
+	}
+	if !directoryInfo.Exists {
+		command = buildCommand("mkdir", "-p", "--", directoryPath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 		if err != nil {
 			err = fmt.Errorf("failed to create directory: %v", err)
 			return
@@ -189,24 +360,24 @@ func TransferFile(sshClient *ssh.Client, localFileContent string, remoteFilePath
 	}
 
 	// Ensure owner/group are correct
-	command = "chown " + fileOwnerGroup + " " + tmpRemoteFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	command = buildCommand("chown", "--", fileOwnerGroup, tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		err = fmt.Errorf("failed SSH Command on host during owner/group change: %v", err)
 		return
 	}
 
 	// Ensure permissions are correct
-	command = "chmod " + strconv.Itoa(filePermissions) + " " + tmpRemoteFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	command = buildCommand("chmod", formatFilePermissions(filePermissions), "--", tmpRemoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		err = fmt.Errorf("failed SSH Command on host during permissions change: %v", err)
 		return
 	}
 
 	// Move file from tmp dir to actual deployment path
-	command = "mv " + tmpRemoteFilePath + " " + remoteFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 30)
+	command = buildCommand("mv", "--", tmpRemoteFilePath, remoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 30)
 	if err != nil {
 		err = fmt.Errorf("failed to move new file into place: %v", err)
 		return
@@ -215,22 +386,28 @@ func TransferFile(sshClient *ssh.Client, localFileContent string, remoteFilePath
 }
 
 // Deletes given file from remote and parent directory if empty
-func deleteFile(sshClient *ssh.Client, SudoPassword string, targetFilePath string) (err error) {
+func deleteFile(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, targetFilePath string) (err error) {
 	// Note: technically inefficient; if a file is moved within same directory, this will delete the file and parent dir(maybe)
 	//                                then when deploying the moved file, it will recreate folder that was just deleted.
 
-	// Attempt remove file
-	command := "rm " + targetFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 30)
+	// Only remove file if it is present
+	fileInfo, err := statRemotePath(sshClient, escalation, capabilities, targetFilePath)
 	if err != nil {
-		// Real errors only if file was present to begin with
-		if !strings.Contains(strings.ToLower(err.Error()), "no such file or directory") {
-			err = fmt.Errorf("failed to remove file '%s': %v", targetFilePath, err)
+		err = fmt.Errorf("failed to remove file '%s': %v", targetFilePath, err)
+		return
+	}
+	if fileInfo.Exists {
+		if fileInfo.Type == "directory" {
+			err = fmt.Errorf("failed to remove file '%s': remote path is a directory", targetFilePath)
 			return
 		}
 
-		// Reset err var
-		err = nil
+		command := buildCommand("rm", "--", targetFilePath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 30)
+		if err != nil {
+			err = fmt.Errorf("failed to remove file '%s': %v", targetFilePath, err)
+			return
+		}
 	}
 
 	// Danger Zone: Remove empty parent dirs
@@ -238,14 +415,18 @@ func deleteFile(sshClient *ssh.Client, SudoPassword string, targetFilePath strin
 	maxLoopCount := 1000 // for safety - sane number to avoid endless dir loops
 	for i := 0; i < maxLoopCount; i++ {
 		// Check for presence of anything in dir
-		command = "ls -A " + targetPath
-		CommandOutput, _ := RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+		var directoryEntries []RemoteFileInfo
+		directoryEntries, err = listRemoteDirectory(sshClient, escalation, capabilities, targetPath, 10)
+		if err != nil {
+			err = fmt.Errorf("failed to check if parent directory '%s' is empty: %v", targetPath, err)
+			break
+		}
 
-		// Empty stdout means empty dir
-		if CommandOutput == "" {
+		// No entries means empty dir
+		if len(directoryEntries) == 0 {
 			// Safe remove directory
-			command = "rmdir " + targetPath
-			_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 30)
+			command := buildCommand("rmdir", "--", targetPath)
+			_, err = RunSSHCommand(sshClient, command, "root", escalation, 30)
 			if err != nil {
 				// Error breaks loop
 				err = fmt.Errorf("failed to remove empty parent directory '%s' for file '%s': %v", targetPath, targetFilePath, err)
@@ -265,26 +446,30 @@ func deleteFile(sshClient *ssh.Client, SudoPassword string, targetFilePath strin
 }
 
 // Create symbolic link to specific target file (as present in file action string)
-func createSymLink(sshClient *ssh.Client, SudoPassword string, targetFilePath string, targetFileAction string) (err error) {
+func createSymLink(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, targetFilePath string, targetFileAction string) (err error) {
 	// Check if a file is already there - if so, error
-	OldSymLinkExists, err := CheckRemoteFileDirExistence(sshClient, targetFilePath, SudoPassword, false)
+	// Extract target path
+	tgtActionSplitReady := strings.ReplaceAll(targetFileAction, " to target ", "?")
+	targetActionArray := strings.SplitN(tgtActionSplitReady, "?", 2)
+	symLinkTarget := targetActionArray[1]
+
+	oldSymLinkInfo, err := statRemotePath(sshClient, escalation, capabilities, targetFilePath)
 	if err != nil {
 		err = fmt.Errorf("failed checking file existence before creating symbolic link: %v", err)
 		return
 	}
-	if OldSymLinkExists {
+	if oldSymLinkInfo.Exists {
+		// Link is already in place
+		if oldSymLinkInfo.Type == "symlink" && oldSymLinkInfo.LinkTarget == symLinkTarget {
+			return
+		}
 		err = fmt.Errorf("file already exists where symbolic link is supposed to be created")
 		return
 	}
 
-	// Extract target path
-	tgtActionSplitReady := strings.ReplaceAll(targetFileAction, " to target ", "?")
-	targetActionArray := strings.SplitN(tgtActionSplitReady, "?", 2)
-	symLinkTarget := targetActionArray[1]
-
 	// Create symbolic link
-	command := "ln -s " + symLinkTarget + " " + targetFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	command := buildCommand("ln", "-s", "--", symLinkTarget, targetFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		err = fmt.Errorf("failed to create symbolic link: %v", err)
 		return
@@ -294,74 +479,271 @@ func createSymLink(sshClient *ssh.Client, SudoPassword string, targetFilePath st
 }
 
 // Creates or modifies a remote directory
-// Handles owner, group, and permissions
-func modifyDirectory(sshClient *ssh.Client, SudoPassword string, targetDirectoryName string, DirOwnerGroup string, DirPermissions int) (Modified bool, err error) {
+// Handles owner, group, permissions, SELinux context, ACL, and attributes
+func modifyDirectory(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, targetDirectoryName string, directoryMetadata CommitFileInfo) (Modified bool, err error) {
 	// Check if directory exists, if not create
-	directoryExists, err := CheckRemoteFileDirExistence(sshClient, targetDirectoryName, SudoPassword, true)
+	directoryInfo, err := statRemotePath(sshClient, escalation, capabilities, targetDirectoryName)
 	if err != nil {
 		err = fmt.Errorf("failed checking directory existence: %v", err)
 		return
 	}
-	if !directoryExists {
-		command := "mkdir -p " + targetDirectoryName
-		_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	if directoryInfo.Exists && directoryInfo.Type != "directory" {
+		err = fmt.Errorf("expected remote path to be directory, but got type '%s' instead", directoryInfo.Type)
+		return
+	}
+	if !directoryInfo.Exists {
+		command := buildCommand("mkdir", "-p", "--", targetDirectoryName)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 		if err != nil {
 			err = fmt.Errorf("failed to create directory: %v", err)
 			return
 		}
+		Modified = true
 	}
 
-	// Get metadata from existing directory
-	command := "ls -ld " + targetDirectoryName
-	lsOutput, err := RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	metadataModified, err := applyFileMetadata(sshClient, escalation, capabilities, targetDirectoryName, directoryMetadata)
 	if err != nil {
-		err = fmt.Errorf("failed to retrieve directory metadata: %v", err)
 		return
 	}
+	if metadataModified {
+		// For metrics
+		Modified = true
+	}
+	return
+}
 
-	// Extract ls information
-	Type, permissionsSymbolic, owner, group, _, _, err := extractMetadataFromLS(lsOutput)
+// Brings metadata of an existing remote file or directory in line with the repository
+// Returns if anything had drifted (and was corrected)
+func applyFileMetadata(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remotePath string, metadata CommitFileInfo) (modified bool, err error) {
+	remoteInfo, err := statRemotePath(sshClient, escalation, capabilities, remotePath)
 	if err != nil {
 		return
 	}
-	if Type != "d" {
-		err = fmt.Errorf("expected remote path to be directory, but got type '%s' instead", Type)
+	if !remoteInfo.Exists {
+		err = fmt.Errorf("remote path '%s' is not present", remotePath)
 		return
 	}
 
-	// Convert permissions to numeric
-	RemotePermissions := permissionsSymbolicToNumeric(permissionsSymbolic)
+	// Find differences
+	ownerChanged := !remoteOwnerGroupMatches(remoteInfo, metadata.FileOwnerGroup)
+
+	// Numeric chmod keeps special bits of directories (GNU), they are only compared when metadata sets any
+	remotePermissions := remoteInfo.Permissions
+	if remoteInfo.Type == "directory" && metadata.FilePermissions&07000 == 0 {
+		remotePermissions &= 0777
+	}
+	// Changing owner clears setuid/setgid of files
+	permissionsChanged := remotePermissions != metadata.FilePermissions || (ownerChanged && remoteInfo.Type != "directory")
 
-	// Check if remote permissions match expected
-	if RemotePermissions != DirPermissions {
-		command = "chmod " + strconv.Itoa(RemotePermissions) + " " + targetDirectoryName
-		_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	var aclChanged bool
+	if metadata.ACL != nil {
+		var remoteACLEntries []string
+		remoteACLEntries, err = remoteACL(sshClient, escalation, capabilities, remotePath)
 		if err != nil {
-			err = fmt.Errorf("failed SSH Command on host during permissions change: %v", err)
 			return
 		}
-		// For metrics
-		Modified = true
-	} else {
-		// For metrics
-		Modified = false
+		aclChanged = !slices.Equal(remoteACLEntries, metadata.ACL)
 	}
 
-	// Check if remote ownership match expected
-	RemoteOwnerGroup := owner + ":" + group
-	if RemoteOwnerGroup != DirOwnerGroup {
-		command = "chown " + DirOwnerGroup + " " + targetDirectoryName
-		_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	var contextChanged bool
+	if metadata.SELinuxContext != "" {
+		if !capabilities.SELinux {
+			printMessage(VerbosityStandard, "Warning: SELinux is not enabled on remote host, not applying context to '%s'\n", remotePath)
+		} else {
+			var remoteContext string
+			remoteContext, err = remoteSELinuxContext(sshClient, escalation, capabilities, remotePath)
+			if err != nil {
+				return
+			}
+			contextChanged = remoteContext != metadata.SELinuxContext
+		}
+	}
+
+	var remoteAttributeLetters string
+	var attributesChanged bool
+	if metadata.Attributes != nil {
+		remoteAttributeLetters, err = remoteAttributes(sshClient, escalation, capabilities, remotePath)
+		if err != nil {
+			return
+		}
+		attributesChanged = remoteAttributeLetters != *metadata.Attributes
+	}
+
+	// Immutable and append-only files reject all other changes, so clear them first and set them again last
+	if (ownerChanged || permissionsChanged || aclChanged || contextChanged) && strings.ContainsAny(remoteAttributeLetters, "ai") {
+		command := buildCommand("chattr", "-ai", remotePath) // chattr does not support '--' (path is absolute)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+		if err != nil {
+			err = fmt.Errorf("failed to clear immutable/append-only attributes: %v", err)
+			return
+		}
+		remoteAttributeLetters = strings.NewReplacer("a", "", "i", "").Replace(remoteAttributeLetters)
+		attributesChanged = remoteAttributeLetters != *metadata.Attributes
+	}
+
+	if ownerChanged {
+		command := buildCommand("chown", "--", metadata.FileOwnerGroup, remotePath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 		if err != nil {
 			err = fmt.Errorf("failed SSH Command on host during owner/group change: %v", err)
 			return
 		}
-		// For metrics
-		Modified = true
-	} else {
-		// For metrics
-		Modified = false
+		modified = true
 	}
 
+	// Removing extended entries resets the group bits, so permissions are applied after
+	if aclChanged {
+		command := buildCommand("setfacl", "-b", "--", remotePath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+		if err != nil {
+			err = fmt.Errorf("failed to remove ACL entries: %v", err)
+			return
+		}
+		modified = true
+	}
+
+	if permissionsChanged || aclChanged {
+		command := buildCommand("chmod", formatFilePermissions(metadata.FilePermissions), "--", remotePath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+		if err != nil {
+			err = fmt.Errorf("failed SSH Command on host during permissions change: %v", err)
+			return
+		}
+		modified = true
+	}
+
+	// Mask is the group permissions, so stat reports the same mode as the metadata
+	if aclChanged && len(metadata.ACL) > 0 {
+		aclEntries := append(slices.Clone(metadata.ACL), "mask::"+aclPermissionLetters(metadata.FilePermissions>>3))
+		command := buildCommand("setfacl", "-m", strings.Join(aclEntries, ","), "--", remotePath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+		if err != nil {
+			err = fmt.Errorf("failed to set ACL entries: %v", err)
+			return
+		}
+	}
+
+	if contextChanged {
+		if capabilities.Tools["chcon"] == "" {
+			err = fmt.Errorf("chcon is not installed on remote host (required for SELinuxContext metadata)")
+			return
+		}
+		command := buildCommand("chcon", "--", metadata.SELinuxContext, remotePath)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+		if err != nil {
+			err = fmt.Errorf("failed to change SELinux context: %v", err)
+			return
+		}
+		modified = true
+	} else if metadata.SELinuxContext == "" && capabilities.SELinux && capabilities.Tools["restorecon"] == "" {
+		printMessage(VerbosityStandard, "Warning: restorecon is not installed on remote host, '%s' keeps the SELinux context of the transfer buffer\n", remotePath)
+	} else if metadata.SELinuxContext == "" && capabilities.SELinux {
+		// Default context from policy (files moved from the transfer buffer keep its context)
+		command := buildCommand("restorecon", "-v", "--", remotePath)
+		var restoreOutput string
+		restoreOutput, err = RunSSHCommand(sshClient, command, "root", escalation, 30)
+		if err != nil {
+			err = fmt.Errorf("failed to restore default SELinux context: %v", err)
+			return
+		}
+		if strings.TrimSpace(restoreOutput) != "" {
+			modified = true
+		}
+	}
+
+	if attributesChanged {
+		attributeChanges := []string{"chattr"}
+		var addedAttributes, removedAttributes string
+		for _, letter := range managedFileAttributes {
+			wanted := strings.ContainsRune(*metadata.Attributes, letter)
+			present := strings.ContainsRune(remoteAttributeLetters, letter)
+			if wanted && !present {
+				addedAttributes += string(letter)
+			} else if !wanted && present {
+				removedAttributes += string(letter)
+			}
+		}
+		if removedAttributes != "" {
+			attributeChanges = append(attributeChanges, "-"+removedAttributes)
+		}
+		if addedAttributes != "" {
+			attributeChanges = append(attributeChanges, "+"+addedAttributes)
+		}
+		command := buildCommand(append(attributeChanges, remotePath)...) // chattr does not support '--' (path is absolute)
+		_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+		if err != nil {
+			err = fmt.Errorf("failed to change file attributes: %v", err)
+			return
+		}
+		modified = true
+	}
+
+	return
+}
+
+// Clears immutable and append-only attributes of a remote file if present
+// Missing files and filesystems without attributes have nothing to clear
+func clearBlockingAttributes(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remotePath string) (err error) {
+	if capabilities.Tools["lsattr"] == "" || capabilities.Tools["chattr"] == "" {
+		return
+	}
+
+	attributes, errLocal := remoteAttributes(sshClient, escalation, capabilities, remotePath)
+	if errLocal != nil || !strings.ContainsAny(attributes, "ai") {
+		return
+	}
+
+	command := buildCommand("chattr", "-ai", remotePath) // chattr does not support '--' (path is absolute)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("failed to clear immutable/append-only attributes of '%s': %v", remotePath, err)
+		return
+	}
+	return
+}
+
+// Retrieves the SELinux context of a remote path
+func remoteSELinuxContext(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remotePath string) (context string, err error) {
+	command := buildCommand(append(remoteCommand(capabilities, "stat"), "-c", "%C", "--", remotePath)...)
+	commandOutput, err := RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve SELinux context: %v", err)
+		return
+	}
+	context = strings.TrimSpace(commandOutput)
+	return
+}
+
+// Retrieves the named and default ACL entries of a remote path
+func remoteACL(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remotePath string) (entries []string, err error) {
+	if capabilities.Tools["getfacl"] == "" || capabilities.Tools["setfacl"] == "" {
+		err = fmt.Errorf("getfacl/setfacl are not installed on remote host (required for ACL metadata)")
+		return
+	}
+
+	command := buildCommand("getfacl", "-c", "-p", "--", remotePath)
+	commandOutput, err := RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve ACL: %v", err)
+		return
+	}
+	entries = parseRemoteACL(commandOutput)
+	return
+}
+
+// Retrieves the managed chattr attributes of a remote path
+func remoteAttributes(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remotePath string) (attributes string, err error) {
+	if capabilities.Tools["lsattr"] == "" || capabilities.Tools["chattr"] == "" {
+		err = fmt.Errorf("lsattr/chattr are not installed on remote host (required for Attributes metadata)")
+		return
+	}
+
+	command := buildCommand("lsattr", "-d", "--", remotePath)
+	commandOutput, err := RunSSHCommand(sshClient, command, "root", escalation, 10)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve file attributes: %v", err)
+		return
+	}
+	attributes = parseRemoteAttributes(commandOutput)
 	return
 }
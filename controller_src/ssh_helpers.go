@@ -4,14 +4,16 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/base64"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"path"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,7 +21,6 @@ import (
 	"github.com/bramvdbogaerde/go-scp"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // ###########################################
@@ -27,8 +28,9 @@ import (
 // ###########################################
 
 // Given an identity file, determines if its a public or private key, and loads the private key (sometimes from the SSH agent)
+// If a user certificate is available for the key, the returned signer presents the certificate
 // Also retrieves key algorithm type for later ssh connect
-func SSHIdentityToKey(SSHIdentityFile string) (PrivateKey ssh.Signer, KeyAlgo string, err error) {
+func SSHIdentityToKey(SSHIdentityFile string, SSHCertificateFile string) (PrivateKey ssh.Signer, KeyAlgo string, err error) {
 	// Load SSH private key
 	// Parse out which is which here and if pub key use as id for agent keychain
 	var SSHKeyType string
@@ -41,11 +43,13 @@ func SSHIdentityToKey(SSHIdentityFile string) (PrivateKey ssh.Signer, KeyAlgo st
 	}
 
 	// Determine key type
+	var encryptedPublicKey ssh.PublicKey
 	_, err = ssh.ParsePrivateKey(SSHIdentity)
 	if err == nil {
 		SSHKeyType = "private"
-	} else if _, encryptedKey := err.(*ssh.PassphraseMissingError); encryptedKey {
+	} else if passphraseErr, encryptedKey := err.(*ssh.PassphraseMissingError); encryptedKey {
 		SSHKeyType = "encrypted"
+		encryptedPublicKey = passphraseErr.PublicKey
 	}
 
 	_, _, _, _, err = ssh.ParseAuthorizedKey(SSHIdentity)
@@ -53,6 +57,15 @@ func SSHIdentityToKey(SSHIdentityFile string) (PrivateKey ssh.Signer, KeyAlgo st
 		SSHKeyType = "public"
 	}
 
+	// Encrypted keys already decrypted in the SSH agent need no passphrase
+	var agentSigner ssh.Signer
+	if SSHKeyType == "encrypted" {
+		agentSigner = sshAgentSigner(encryptedPublicKey)
+		if agentSigner != nil {
+			SSHKeyType = "agent"
+		}
+	}
+
 	// Load key from keyring if requested
 	if SSHKeyType == "public" {
 		// Ensure user supplied identity is a public key if requesting to use agent
@@ -131,18 +144,36 @@ func SSHIdentityToKey(SSHIdentityFile string) (PrivateKey ssh.Signer, KeyAlgo st
 			return
 		}
 
+		// Add key algorithm to return value for later connect
+		KeyAlgo = PrivateKey.PublicKey().Type()
+	} else if SSHKeyType == "agent" {
+		PrivateKey = agentSigner
+
 		// Add key algorithm to return value for later connect
 		KeyAlgo = PrivateKey.PublicKey().Type()
 	} else if SSHKeyType == "encrypted" {
-		// Ask user for key password
-		var passphrase string
-		passphrase, err = promptUserForSecret("Enter passphrase for the SSH key `%s`: ", SSHIdentityFile)
+		// Use passphrase stored in vault if present
+		var passphraseBytes []byte
+		passphraseBytes, err = lookupKeyPassphrase(SSHIdentityFile)
 		if err != nil {
+			err = fmt.Errorf("failed retrieving key passphrase from vault: %v", err)
 			return
 		}
 
+		// Ask user for key password
+		if len(passphraseBytes) == 0 {
+			var passphrase string
+			passphrase, err = promptUserForSecret("Enter passphrase for the SSH key `%s`: ", SSHIdentityFile)
+			if err != nil {
+				return
+			}
+			passphraseBytes = []byte(passphrase)
+		}
+
 		// Decrypt and parse private key with password
-		PrivateKey, err = ssh.ParsePrivateKeyWithPassphrase(SSHIdentity, []byte(passphrase))
+		registerSecret(passphraseBytes)
+		PrivateKey, err = ssh.ParsePrivateKeyWithPassphrase(SSHIdentity, passphraseBytes)
+		wipeBytes(passphraseBytes)
 		if err != nil {
 			err = fmt.Errorf("invalid encrypted private key in identity file: %v", err)
 			return
@@ -155,11 +186,135 @@ func SSHIdentityToKey(SSHIdentityFile string) (PrivateKey ssh.Signer, KeyAlgo st
 		return
 	}
 
+	// Present certificate instead of the bare key when available
+	PrivateKey, err = loadSSHCertificate(PrivateKey, SSHIdentityFile, SSHCertificateFile)
+	if err != nil {
+		err = fmt.Errorf("ssh certificate: %v", err)
+		return
+	}
+
 	return
 }
 
-// Validates endpoint address and port, then combines both strings
-func ParseEndpointAddress(endpointIP string, Port string) (endpointSocket string, err error) {
+// Finds the signer for a public key in the running SSH agent
+// Returns nil when there is no agent, no public key, or the agent does not hold the key
+func sshAgentSigner(publicKey ssh.PublicKey) (signer ssh.Signer) {
+	agentSock := os.Getenv("SSH_AUTH_SOCK")
+	if publicKey == nil || agentSock == "" {
+		return
+	}
+
+	agentConn, err := net.Dial("unix", agentSock)
+	if err != nil {
+		return
+	}
+
+	signers, err := agent.NewClient(agentConn).Signers()
+	if err != nil {
+		agentConn.Close()
+		return
+	}
+	for _, agentSigner := range signers {
+		if bytes.Equal(agentSigner.PublicKey().Marshal(), publicKey.Marshal()) {
+			signer = agentSigner
+			return
+		}
+	}
+	agentConn.Close()
+	return
+}
+
+// Wraps a signer with its OpenSSH user certificate
+// Uses the given certificate file, otherwise '<identity>-cert.pub' if it exists (like OpenSSH)
+func loadSSHCertificate(signer ssh.Signer, SSHIdentityFile string, SSHCertificateFile string) (certSigner ssh.Signer, err error) {
+	certSigner = signer
+	if signer == nil {
+		return
+	}
+
+	certificateRequired := SSHCertificateFile != ""
+	if !certificateRequired {
+		SSHCertificateFile = strings.TrimSuffix(SSHIdentityFile, ".pub") + "-cert.pub"
+	}
+
+	certificateFile, err := os.ReadFile(expandHomeDirectory(SSHCertificateFile))
+	if os.IsNotExist(err) && !certificateRequired {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(certificateFile)
+	if err != nil {
+		err = fmt.Errorf("invalid certificate file '%s': %v", SSHCertificateFile, err)
+		return
+	}
+	certificate, isCertificate := publicKey.(*ssh.Certificate)
+	if !isCertificate || certificate.CertType != ssh.UserCert {
+		err = fmt.Errorf("'%s' is not a user certificate", SSHCertificateFile)
+		return
+	}
+
+	if !bytes.Equal(certificate.Key.Marshal(), signer.PublicKey().Marshal()) {
+		err = fmt.Errorf("certificate '%s' was not issued for identity '%s'", SSHCertificateFile, SSHIdentityFile)
+		return
+	}
+
+	// Short-lived certificates are common, report expiry here instead of as an authentication failure
+	currentTime := uint64(time.Now().Unix())
+	if currentTime < certificate.ValidAfter {
+		err = fmt.Errorf("certificate '%s' is not valid until %s", SSHCertificateFile, time.Unix(int64(certificate.ValidAfter), 0).Format(time.RFC3339))
+		return
+	}
+	if certificate.ValidBefore != ssh.CertTimeInfinity && currentTime >= certificate.ValidBefore {
+		err = fmt.Errorf("certificate '%s' expired at %s", SSHCertificateFile, time.Unix(int64(certificate.ValidBefore), 0).Format(time.RFC3339))
+		return
+	}
+
+	certSigner, err = ssh.NewCertSigner(certificate, signer)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityProgress, "Using certificate '%s' (key ID '%s', serial %d)\n", SSHCertificateFile, certificate.KeyId, certificate.Serial)
+	return
+}
+
+// Host key algorithms to request from the server
+// Key types already in known_hosts for the host are requested instead of the identity key type (like OpenSSH)
+// Certificate algorithms are only preferred when a certificate authority in known_hosts covers the host
+func preferredHostKeyAlgorithms(keyAlgorithm string, knownKeyTypes []string, trustsCertAuthority bool) (hostKeyAlgorithms []string) {
+	keyTypes := knownKeyTypes
+	if len(keyTypes) == 0 {
+		// Without a key or known keys, the library defaults are used
+		if keyAlgorithm == "" {
+			return
+		}
+		keyTypes = []string{keyAlgorithm}
+	}
+
+	if trustsCertAuthority {
+		for _, keyType := range keyTypes {
+			certificateAlgorithm, certificateSupported := hostCertificateAlgorithms[keyType]
+			if certificateSupported {
+				hostKeyAlgorithms = append(hostKeyAlgorithms, certificateAlgorithm)
+			}
+		}
+	}
+
+	for _, keyType := range keyTypes {
+		// RSA keys are stored as ssh-rsa but should use SHA-2 signatures
+		if keyType == ssh.KeyAlgoRSA {
+			hostKeyAlgorithms = append(hostKeyAlgorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		hostKeyAlgorithms = append(hostKeyAlgorithms, keyType)
+	}
+	return
+}
+
+// Validates endpoint address (IP or DNS name) and port, then combines both strings
+func ParseEndpointAddress(endpointAddress string, Port string) (endpointSocket string, err error) {
 	// Use regex for v4 match
 	IPv4RegEx := regexp.MustCompile(`^((25[0-5]|(2[0-4]|1\d|[1-9]|)\d)\.?\b){4}$`)
 
@@ -170,40 +325,282 @@ func ParseEndpointAddress(endpointIP string, Port string) (endpointSocket string
 		return
 	}
 
-	// Verify IP address
-	IPCheck := net.ParseIP(endpointIP)
-	if IPCheck == nil && !IPv4RegEx.MatchString(endpointIP) {
-		err = fmt.Errorf("endpoint ip '%s' is not valid", endpointIP)
+	// Verify IP address, anything else must be a valid DNS name
+	IPCheck := net.ParseIP(endpointAddress)
+	if IPCheck == nil && !IPv4RegEx.MatchString(endpointAddress) {
+		if !validHostname(endpointAddress) {
+			err = fmt.Errorf("endpoint address '%s' is not a valid IP or host name", endpointAddress)
+			return
+		}
+		endpointAddress = strings.ToLower(strings.TrimSuffix(endpointAddress, "."))
+	}
+
+	// Get endpoint socket by ipv6 or ipv4/name
+	endpointSocket = net.JoinHostPort(endpointAddress, strconv.Itoa(endpointPort))
+	return
+}
+
+// Checks if a name is a valid DNS host name
+// All-numeric names are refused so invalid IPv4 addresses are not looked up as names
+func validHostname(hostname string) (valid bool) {
+	hostname = strings.TrimSuffix(hostname, ".")
+	if hostname == "" || len(hostname) > 253 {
 		return
 	}
 
-	// Get endpoint socket by ipv6 or ipv4
-	if strings.Contains(endpointIP, ":") {
-		endpointSocket = "[" + endpointIP + "]" + ":" + strconv.Itoa(endpointPort)
-	} else {
-		endpointSocket = endpointIP + ":" + strconv.Itoa(endpointPort)
+	var allNumeric bool = true
+	for _, label := range strings.Split(hostname, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return
+		}
+		for _, char := range label {
+			isDigit := char >= '0' && char <= '9'
+			isLetter := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+			if !isDigit && !isLetter && char != '-' {
+				return
+			}
+			if !isDigit {
+				allNumeric = false
+			}
+		}
 	}
 
+	valid = !allNumeric
 	return
 }
 
-// Handle building client config and connection to remote host
+// Resolves the host name of an endpoint to its addresses (cached for the whole run)
+// Network is tcp, tcp4 or tcp6 (from AddressFamily), for tcp IPv4 addresses are tried first
+func resolveEndpointAddresses(network string, endpointSocket string) (addresses []string, err error) {
+	host, port, err := net.SplitHostPort(endpointSocket)
+	if err != nil {
+		return
+	}
+
+	// Nothing to resolve for IP addresses
+	if net.ParseIP(host) != nil {
+		addresses = []string{endpointSocket}
+		return
+	}
+
+	ResolvedAddressesMutex.Lock()
+	defer ResolvedAddressesMutex.Unlock()
+
+	ipNetwork := strings.Replace(network, "tcp", "ip", 1)
+	cacheKey := network + "/" + host
+	IPs, cached := resolvedAddresses[cacheKey]
+	if !cached {
+		printMessage(VerbosityProgress, "Resolving host name %s\n", host)
+
+		IPs, err = net.DefaultResolver.LookupIP(context.Background(), ipNetwork, host)
+		if err != nil {
+			err = fmt.Errorf("failed to resolve host name: %v", err)
+			return
+		}
+
+		// Stable sort keeps resolver order within each family
+		sort.SliceStable(IPs, func(i, j int) bool {
+			return IPs[i].To4() != nil && IPs[j].To4() == nil
+		})
+		resolvedAddresses[cacheKey] = IPs
+	}
+
+	for _, IP := range IPs {
+		addresses = append(addresses, net.JoinHostPort(IP.String(), port))
+	}
+	if len(addresses) == 0 {
+		err = fmt.Errorf("no addresses found for host name %s (network %s)", host, ipNetwork)
+	}
+	return
+}
+
+// Opens a network connection to an endpoint, trying each resolved address in order
+func dialEndpoint(network string, endpointSocket string, timeout time.Duration) (conn net.Conn, err error) {
+	addresses, err := resolveEndpointAddresses(network, endpointSocket)
+	if err != nil {
+		return
+	}
+
+	for _, address := range addresses {
+		conn, err = net.DialTimeout(network, address, timeout)
+		if err == nil {
+			return
+		}
+		printMessage(VerbosityProgress, "Endpoint %s: connection to %s failed: %v\n", endpointSocket, address, err)
+	}
+	return
+}
+
+// Parses the ProxyJump option into the list of jump hosts
+func parseProxyJump(proxyJump string) (jumpHosts []string, err error) {
+	proxyJump = strings.TrimSpace(proxyJump)
+	if proxyJump == "" || strings.ToLower(proxyJump) == "none" {
+		return
+	}
+
+	for _, jumpHost := range strings.Split(proxyJump, ",") {
+		jumpHost = strings.TrimSpace(jumpHost)
+		if jumpHost == "" {
+			err = fmt.Errorf("empty jump host in '%s'", proxyJump)
+			return
+		}
+		jumpHost = strings.TrimPrefix(jumpHost, "ssh://")
+		jumpHosts = append(jumpHosts, jumpHost)
+	}
+	return
+}
+
+// Splits a jump host in the form [user@]host[:port] (IPv6 hosts in brackets when a port is given)
+func parseJumpHostAddress(jumpHost string) (user string, host string, port string, err error) {
+	host = jumpHost
+	if strings.Contains(host, "@") {
+		user, host, _ = strings.Cut(host, "@")
+		if user == "" {
+			err = fmt.Errorf("empty user in jump host '%s'", jumpHost)
+			return
+		}
+	}
+
+	port = "22"
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+		var splitErr error
+		host, port, splitErr = net.SplitHostPort(host)
+		if splitErr != nil {
+			err = fmt.Errorf("invalid jump host '%s': %v", jumpHost, splitErr)
+			return
+		}
+	}
+
+	if host == "" {
+		err = fmt.Errorf("empty host in jump host '%s'", jumpHost)
+		return
+	}
+	return
+}
+
+// Retrieves connection information for each jump host of a host
+// Jump hosts that are configured hosts use their own settings and credentials
+// Others use the user, identity and certificate of the host being connected to unless the user is given
+func resolveJumpHosts(hostInfo EndpointInfo) (jumpHosts []EndpointInfo, err error) {
+	for _, jumpHostName := range hostInfo.ProxyJump {
+		if jumpHostName == hostInfo.EndpointName {
+			err = fmt.Errorf("host %s cannot be its own jump host", jumpHostName)
+			return
+		}
+
+		jumpHostInfo, configuredJumpHost := config.HostInfo[jumpHostName]
+		if configuredJumpHost && jumpHostInfo.Endpoint != "" {
+			// Chains are only taken from the host being connected to, the jump hosts own ProxyJump is not used
+			jumpHostInfo, err = retrieveLoginSecrets(jumpHostInfo)
+			if err != nil {
+				err = fmt.Errorf("jump host %s: %v", jumpHostName, err)
+				return
+			}
+			config.HostInfo[jumpHostName] = jumpHostInfo
+
+			jumpHosts = append(jumpHosts, jumpHostInfo)
+			continue
+		}
+
+		var user, host, port string
+		user, host, port, err = parseJumpHostAddress(jumpHostName)
+		if err != nil {
+			return
+		}
+
+		jumpHostInfo = EndpointInfo{
+			EndpointName:    jumpHostName,
+			EndpointUser:    hostInfo.EndpointUser,
+			IdentityFile:    hostInfo.IdentityFile,
+			CertificateFile: hostInfo.CertificateFile,
+			PrivateKey:      hostInfo.PrivateKey,
+			KeyAlgo:         hostInfo.KeyAlgo,
+			Options:         hostInfo.Options,
+		}
+		if user != "" {
+			jumpHostInfo.EndpointUser = user
+		}
+
+		jumpHostInfo.Endpoint, err = ParseEndpointAddress(host, port)
+		if err != nil {
+			err = fmt.Errorf("jump host %s: %v", jumpHostName, err)
+			return
+		}
+
+		jumpHosts = append(jumpHosts, jumpHostInfo)
+	}
+	return
+}
+
+// Handle connection to remote host, through its jump hosts if any
+// Jump host connections are closed once the connection to the host is closed
+func connectToSSH(hostInfo EndpointInfo) (client *ssh.Client, err error) {
+	var jumpClients []*ssh.Client
+	defer func() {
+		if err != nil {
+			closeSSHClients(jumpClients)
+		}
+	}()
+
+	var jumpClient *ssh.Client
+	for _, jumpHost := range hostInfo.JumpHosts {
+		printMessage(VerbosityProgress, "Endpoint %s: Connecting through jump host %s (%s)\n", hostInfo.Endpoint, jumpHost.EndpointName, jumpHost.Endpoint)
+
+		jumpClient, err = dialSSH(jumpClient, jumpHost)
+		if err != nil {
+			err = fmt.Errorf("jump host %s: %v", jumpHost.EndpointName, err)
+			return
+		}
+		jumpClients = append(jumpClients, jumpClient)
+	}
+
+	client, err = dialSSH(jumpClient, hostInfo)
+	if err != nil {
+		return
+	}
+
+	if len(jumpClients) > 0 {
+		go func() {
+			client.Wait()
+			closeSSHClients(jumpClients)
+		}()
+	}
+	return
+}
+
+// Closes connections in reverse order (innermost jump first)
+func closeSSHClients(clients []*ssh.Client) {
+	for index := len(clients) - 1; index >= 0; index-- {
+		clients[index].Close()
+	}
+}
+
+// Handle building client config and connection to a single host, directly or through an existing connection
 // Attempts to automatically recover from some errors like no route to host by waiting a bit
-func connectToSSH(endpointSocket string, endpointUser string, LoginPassword string, PrivateKey ssh.Signer, keyAlgorithm string) (client *ssh.Client, err error) {
+func dialSSH(jumpClient *ssh.Client, hostInfo EndpointInfo) (client *ssh.Client, err error) {
+	endpointSocket := hostInfo.Endpoint
+	options := hostInfo.Options
+
+	hostKeyAlgorithms, err := applyAlgorithmList(preferredHostKeyAlgorithms(hostInfo.KeyAlgo, knownHostKeyTypes(endpointSocket), knownHostsTrustsCertAuthority(endpointSocket)), options.HostKeyAlgorithms)
+	if err != nil {
+		err = fmt.Errorf("invalid HostKeyAlgorithms: %v", err)
+		return
+	}
+
 	// Setup config for client
 	SSHconfig := &ssh.ClientConfig{
-		User: endpointUser,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(PrivateKey),
-			ssh.Password(LoginPassword),
+		Config: ssh.Config{
+			Ciphers:      options.Ciphers,
+			KeyExchanges: options.KexAlgorithms,
+			MACs:         options.MACs,
 		},
+		User: hostInfo.EndpointUser,
+		Auth: buildAuthMethods(hostInfo),
 		// Some IPS rules flag on GO's ssh client string
-		ClientVersion: "SSH-2.0-OpenSSH_9.8p1",
-		HostKeyAlgorithms: []string{
-			keyAlgorithm,
-		},
-		HostKeyCallback: hostKeyCallback,
-		Timeout:         30 * time.Second,
+		ClientVersion:     "SSH-2.0-OpenSSH_9.8p1",
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		HostKeyCallback:   hostKeyCallback(options.StrictHostKeyChecking),
+		Timeout:           options.ConnectTimeout,
 	}
 
 	// Only attempt connection x times
@@ -213,8 +610,13 @@ func connectToSSH(endpointSocket string, endpointUser string, LoginPassword stri
 	for attempts := 0; attempts <= maxConnectionAttempts; attempts++ {
 		printMessage(VerbosityProgress, "Endpoint %s: Establishing connection to SSH server (%d/%d)\n", endpointSocket, attempts, maxConnectionAttempts)
 
-		// Connect to the SSH server direct
-		client, err = ssh.Dial("tcp", endpointSocket, SSHconfig)
+		if jumpClient == nil {
+			// Connect to the SSH server direct
+			client, err = dialSSHDirect(options.AddressFamily, endpointSocket, SSHconfig)
+		} else {
+			// Connect to the SSH server through the previous jump host
+			client, err = dialSSHThrough(jumpClient, options.AddressFamily, endpointSocket, SSHconfig)
+		}
 
 		// Determine if error is recoverable
 		if err != nil {
@@ -232,169 +634,282 @@ func connectToSSH(endpointSocket string, endpointUser string, LoginPassword stri
 			break
 		}
 	}
-
-	return
-}
-
-// Custom HostKeyCallback for validating remote public key against known pub keys
-// If unknown, will ask user if it should trust the remote host
-func hostKeyCallback(hostname string, remote net.Addr, PubKey ssh.PublicKey) (err error) {
-	// Turn remote address into format used with known_hosts file entries
-	cleanHost, _, err := net.SplitHostPort(remote.String())
 	if err != nil {
-		err = fmt.Errorf("error with ssh server key check: unable to determine hostname in address: %v", err)
 		return
 	}
 
-	// If the remote addr is IPv6, extract the address part
-	// Only inside the brackets - OpenSSH does not include brackets when checking against known_hosts
-	if strings.Contains(cleanHost, "]") {
-		cleanHost = strings.TrimPrefix(cleanHost, "[")
-		cleanHost = strings.TrimSuffix(cleanHost, "]")
+	if options.ServerAliveInterval > 0 {
+		go sendSSHKeepalives(client, options.ServerAliveInterval, options.ServerAliveCountMax)
 	}
+	return
+}
 
-	// Convert ssh line protocol public key to known_hosts encoding
-	remotePubKey := base64.StdEncoding.EncodeToString(PubKey.Marshal())
-
-	// Get the public key type
-	pubKeyType := PubKey.Type()
-
-	// Find an entry that matches the host we are handshaking with
-	for _, knownhostkey := range config.KnownHosts {
-		// Separate the public key section from the hashed host section
-		knownhostkey = strings.TrimPrefix(knownhostkey, "|")
-		knownhost := strings.SplitN(knownhostkey, " ", 2)
-		if len(knownhost) < 2 {
-			continue
+// Creates authentication methods in the order of the hosts PreferredAuthentications
+// Password authentication is only offered when the host has a password
+func buildAuthMethods(hostInfo EndpointInfo) (authMethods []ssh.AuthMethod) {
+	LoginPassword := hostInfo.Password
+
+	for _, authMethod := range hostInfo.Options.PreferredAuthentications {
+		switch authMethod {
+		case "publickey":
+			var signers []ssh.Signer
+			if hostInfo.PrivateKey != nil {
+				signers = append(signers, hostInfo.PrivateKey)
+			}
+			if hostInfo.Options.OfferAgentKeys {
+				signers = append(signers, sshAgentSigners()...)
+			}
+			if len(signers) > 0 {
+				authMethods = append(authMethods, ssh.PublicKeys(signers...))
+			}
+		case "keyboard-interactive":
+			// Vault password is only sent once per connection so a wrong password cannot be retried until lockout
+			var passwordSent bool
+			authMethods = append(authMethods, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) (answers []string, err error) {
+				return answerKeyboardInteractive(hostInfo.EndpointName, LoginPassword, &passwordSent, name, instruction, questions, echos)
+			}))
+		case "password":
+			if len(LoginPassword) > 0 {
+				authMethods = append(authMethods, ssh.PasswordCallback(func() (string, error) { return string(LoginPassword), nil }))
+			}
 		}
+	}
+	return
+}
 
-		// Only Process hashed lines of known_hosts
-		knownHostsPart := strings.Split(knownhost[0], "|")
-		if len(knownHostsPart) < 3 || knownHostsPart[0] != "1" {
-			continue
-		}
+// Answers keyboard-interactive challenges of a host
+// Password prompts are answered with the vault password, all other challenges (like OTP codes) are asked on the terminal
+func answerKeyboardInteractive(endpointName string, password []byte, passwordSent *bool, name string, instruction string, questions []string, echos []bool) (answers []string, err error) {
+	// Only one host at a time may use the terminal
+	TerminalPromptMutex.Lock()
+	defer TerminalPromptMutex.Unlock()
 
-		// Retrieve fields from known_hosts hash section
-		salt := knownHostsPart[1]
-		hashedKnownHost := knownHostsPart[2]
-		knownkeysPart := strings.Fields(knownhost[1])
+	if len(questions) > 0 && (name != "" || instruction != "") {
+		printMessage(VerbosityStandard, "Host %s: %s\n", endpointName, strings.TrimSpace(name+"\n"+instruction))
+	}
 
-		// Ensure Key section has at least algorithm and key fields
-		if len(knownkeysPart) < 2 {
+	for index, question := range questions {
+		if len(password) > 0 && !*passwordSent && isPasswordPrompt(question) {
+			printMessage(VerbosityProgress, "Host %s: answering '%s' with vault password\n", endpointName, strings.TrimSpace(question))
+			answers = append(answers, string(password))
+			*passwordSent = true
 			continue
 		}
 
-		// Hash the cleaned host name with the salt from known_hosts line
-		var saltBytes []byte
-		saltBytes, err = base64.StdEncoding.DecodeString(salt)
+		var answer string
+		if echos[index] {
+			answer, err = promptUserForLine("Host %s: %s", endpointName, question)
+		} else {
+			answer, err = promptUserForSecret("Host %s: %s", endpointName, question)
+		}
 		if err != nil {
-			err = fmt.Errorf("error decoding salt: %v", err)
+			err = fmt.Errorf("unable to answer keyboard-interactive challenge '%s': %v", strings.TrimSpace(question), err)
 			return
 		}
+		registerSecret([]byte(answer))
+		answers = append(answers, answer)
+	}
+	return
+}
 
-		// Create the HMAC-SHA1 using the salt as the key
-		hmacAlgo := hmac.New(sha1.New, saltBytes)
-		hmacAlgo.Write([]byte(cleanHost))
-		hashed := hmacAlgo.Sum(nil)
-
-		// Convert hash hosts name to hex base64
-		hashedHost := base64.StdEncoding.EncodeToString(hashed)
-
-		// Compare hashed values of host and known_host host
-		if hashedHost == hashedKnownHost {
-			// Grab just the key part from known_hosts
-			localPubKey := strings.Join(knownkeysPart[1:], " ")
-			// Compare public keys
-			if localPubKey == remotePubKey {
-				// nil err means SSH is cleared to continue handshake
-				return
-			}
-		}
+// Checks if a keyboard-interactive challenge asks for the login password (and not an OTP or a new password)
+func isPasswordPrompt(question string) (isPassword bool) {
+	question = strings.ToLower(question)
+	if !strings.Contains(question, "password") {
+		return
 	}
 
-	// If global was set, dont ask user to add unknown key
-	if addAllUnknownHosts {
-		err = writeKnownHost(cleanHost, pubKeyType, remotePubKey)
-		if err != nil {
+	for _, otherSecret := range []string{"new", "one-time", "one time", "otp", "token", "code", "verification", "pin"} {
+		if strings.Contains(question, otherSecret) {
 			return
 		}
+	}
+	isPassword = true
+	return
+}
+
+// Retrieves all signers from the SSH agent (none if the agent is not available)
+func sshAgentSigners() (signers []ssh.Signer) {
+	agentSock := os.Getenv("SSH_AUTH_SOCK")
+	if agentSock == "" {
+		return
+	}
+
+	AgentConn, err := net.Dial("unix", agentSock)
+	if err != nil {
+		printMessage(VerbosityProgress, "SSH agent not available: %v\n", err)
 		return
 	}
 
-	// If env var is set, use as prompt answer
-	envaddToKnownHosts := os.Getenv(environmentUnknownSSHHostKey)
+	signers, err = agent.NewClient(AgentConn).Signers()
+	if err != nil {
+		printMessage(VerbosityProgress, "SSH agent signers: %v\n", err)
+		AgentConn.Close()
+		return
+	}
+	return
+}
 
-	// Key was not found in known_hosts - Prompt user
-	fmt.Printf("Host %s not in known_hosts. Key: %s %s\n", cleanHost, pubKeyType, remotePubKey)
-	var addToKnownHosts string
-	if envaddToKnownHosts != "" {
-		// Put environment answer into answer var - also show answered prompt
-		addToKnownHosts = envaddToKnownHosts
-		printMessage(VerbosityStandard, "Do you want to add this key to known_hosts? [y/N/all/skip]: %s\n", addToKnownHosts)
-	} else {
-		addToKnownHosts, err = promptUser("Do you want to add this key to known_hosts? [y/N/all/skip]: ")
-		if err != nil {
+// Parses the PreferredAuthentications option, methods the controller does not support are ignored
+func parseAuthenticationMethods(preferredAuthentications string) (authMethods []string, err error) {
+	if preferredAuthentications == "" {
+		authMethods = defaultAuthenticationMethods
+		return
+	}
+
+	for _, authMethod := range strings.Split(preferredAuthentications, ",") {
+		authMethod = strings.ToLower(strings.TrimSpace(authMethod))
+		switch authMethod {
+		case "publickey", "password", "keyboard-interactive":
+			if !slices.Contains(authMethods, authMethod) {
+				authMethods = append(authMethods, authMethod)
+			}
+		case "gssapi-with-mic", "hostbased":
+			continue
+		default:
+			err = fmt.Errorf("unknown authentication method '%s'", authMethod)
 			return
 		}
 	}
-	addToKnownHosts = strings.TrimSpace(addToKnownHosts)
-	addToKnownHosts = strings.ToLower(addToKnownHosts)
 
-	// Parse user response
-	if addToKnownHosts == "all" {
-		// User wants to trust all future pub key prompts 'all' implies 'yes' to this first host key
-		// For the duration of this program run, all unknown remote host keys will be added to known_hosts
-		addAllUnknownHosts = true
-	} else if addToKnownHosts == "skip" {
-		// Continue connection, but don't write host key
-		return
-	} else if addToKnownHosts != "y" {
-		// User did not say yes, abort connection
-		err = fmt.Errorf("not continuing with connection to %s", cleanHost)
+	if len(authMethods) == 0 {
+		err = fmt.Errorf("no supported authentication methods in '%s'", preferredAuthentications)
 		return
 	}
+	return
+}
 
-	// Add remote pubkey to known_hosts file
-	err = writeKnownHost(cleanHost, pubKeyType, remotePubKey)
-	if err != nil {
+// Applies an ssh_config algorithm list to the default algorithms
+// '+' appends to, '-' removes from (wildcards allowed), and '^' prepends to the defaults, otherwise the list replaces them
+func applyAlgorithmList(defaultAlgorithms []string, algorithmList string) (algorithms []string, err error) {
+	algorithmList = strings.TrimSpace(algorithmList)
+	if algorithmList == "" {
+		algorithms = defaultAlgorithms
 		return
 	}
 
-	// SSH is authorized to proceed connection to host
+	var modifier byte
+	if strings.ContainsAny(algorithmList[:1], "+-^") {
+		modifier = algorithmList[0]
+		algorithmList = algorithmList[1:]
+	}
+
+	var listedAlgorithms []string
+	for _, algorithm := range strings.Split(algorithmList, ",") {
+		algorithm = strings.TrimSpace(algorithm)
+		if algorithm == "" {
+			err = fmt.Errorf("empty algorithm name")
+			return
+		}
+		listedAlgorithms = append(listedAlgorithms, algorithm)
+	}
+
+	addUnique := func(newAlgorithms []string) {
+		for _, algorithm := range newAlgorithms {
+			if !slices.Contains(algorithms, algorithm) {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+
+	switch modifier {
+	case '+':
+		addUnique(defaultAlgorithms)
+		addUnique(listedAlgorithms)
+	case '^':
+		addUnique(listedAlgorithms)
+		addUnique(defaultAlgorithms)
+	case '-':
+		for _, algorithm := range defaultAlgorithms {
+			removed := false
+			for _, removePattern := range listedAlgorithms {
+				matched, _ := path.Match(removePattern, algorithm)
+				if matched {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	default:
+		addUnique(listedAlgorithms)
+	}
+
+	if len(algorithms) == 0 {
+		err = fmt.Errorf("no algorithms left from '%s'", algorithmList)
+		return
+	}
 	return
 }
 
-// Writes new public key for remote host to known_hosts file
-func writeKnownHost(cleanHost string, pubKeyType string, remotePubKey string) (err error) {
-	// Show progress to user
-	printMessage(VerbosityStandard, "Writing new host entry in known_hosts... ")
-
-	// Get hashed host
-	hashSection := knownhosts.HashHostname(cleanHost)
+// Sends keepalive requests until the connection closes
+// Closes the connection when too many requests in a row go unanswered
+func sendSSHKeepalives(client *ssh.Client, interval time.Duration, countMax int) {
+	keepaliveTicker := time.NewTicker(interval)
+	defer keepaliveTicker.Stop()
+
+	var unanswered int
+	for range keepaliveTicker.C {
+		keepaliveReply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			keepaliveReply <- err
+		}()
+
+		select {
+		case err := <-keepaliveReply:
+			if err != nil {
+				// Connection closed
+				return
+			}
+			unanswered = 0
+		case <-time.After(interval):
+			unanswered++
+			if unanswered >= countMax {
+				printMessage(VerbosityStandard, "Endpoint %s: no response to %d keepalives, disconnecting\n", client.RemoteAddr(), unanswered)
+				client.Close()
+				return
+			}
+		}
+	}
+}
 
-	// New line to be added
-	newKnownHost := hashSection + " " + pubKeyType + " " + remotePubKey
+// Opens an SSH connection directly, resolving host names locally
+// Host keys are still checked against the configured address, not the resolved IP
+func dialSSHDirect(network string, endpointSocket string, SSHconfig *ssh.ClientConfig) (client *ssh.Client, err error) {
+	conn, err := dialEndpoint(network, endpointSocket, SSHconfig.Timeout)
+	if err != nil {
+		return
+	}
 
-	// Lock file for writing - unlock on func return
-	KnownHostMutex.Lock()
-	defer KnownHostMutex.Unlock()
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, endpointSocket, SSHconfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	client = ssh.NewClient(clientConn, channels, requests)
+	return
+}
 
-	// Open the known_hosts file
-	knownHostsfile, err := os.OpenFile(config.KnownHostsFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+// Opens an SSH connection tunneled through an existing SSH connection
+func dialSSHThrough(jumpClient *ssh.Client, network string, endpointSocket string, SSHconfig *ssh.ClientConfig) (client *ssh.Client, err error) {
+	tunnelConn, err := jumpClient.Dial(network, endpointSocket)
 	if err != nil {
-		err = fmt.Errorf("failed to open known_hosts file: %v", err)
 		return
 	}
-	defer knownHostsfile.Close()
 
-	// Write the new known host string followed by a newline
-	if _, err = knownHostsfile.WriteString(newKnownHost + "\n"); err != nil {
-		err = fmt.Errorf("failed to write new known host to known_hosts file: %v", err)
+	// Jump host connections have no dial timeout, bound the handshake instead
+	tunnelConn.SetDeadline(time.Now().Add(SSHconfig.Timeout))
+	clientConn, channels, requests, err := ssh.NewClientConn(tunnelConn, endpointSocket, SSHconfig)
+	if err != nil {
+		tunnelConn.Close()
 		return
 	}
+	tunnelConn.SetDeadline(time.Time{})
 
-	// Show progress to user
-	printMessage(VerbosityStandard, "Success\n")
+	client = ssh.NewClient(clientConn, channels, requests)
 	return
 }
 
@@ -452,12 +967,12 @@ func SCPDownload(client *ssh.Client, remoteFilePath string) (fileContent string,
 	return
 }
 
-// Runs the given remote ssh command with sudo
-// runAs input will change to the user using sudo if not root
-// disableSudo will determine if command runs with sudo or not (default, will always use sudo)
-// Empty sudoPassword will run without assuming the user account doesn't require any passwords
+// Runs the given remote ssh command with the hosts privilege escalation method
+// runAs input will change to that user if not root
+// Escalation method 'none' runs the command as the login user (also used with --disable-privilege-escalation)
+// Empty escalation password will run assuming the user account doesn't require any passwords
 // timeout is the max execution time in seconds for the given command
-func RunSSHCommand(client *ssh.Client, command string, runAs string, disableSudo bool, sudoPassword string, timeout int) (CommandOutput string, err error) {
+func RunSSHCommand(client *ssh.Client, command string, runAs string, escalation PrivilegeEscalation, timeout int) (CommandOutput string, err error) {
 	// Open new session (exec)
 	session, err := client.NewSession()
 	if err != nil {
@@ -488,26 +1003,29 @@ func RunSSHCommand(client *ssh.Client, command string, runAs string, disableSudo
 	}
 	defer stdin.Close()
 
-	// Prepare command prefix
-	cmdPrefix := "sudo "
-	if sudoPassword != "" {
-		// sudo password provided, adding stdin arg to sudo
-		cmdPrefix += "-S "
-	}
-	if runAs != "" && runAs != "root" {
-		// Non-root other user requested, adding su to sudo
-		cmdPrefix += "-u " + runAs + " "
-	}
-	if disableSudo {
-		// No sudo requested, remove sudo prefix
-		cmdPrefix = ""
+	// Random marker the escalated command prints once authentication is done
+	authSentinelBytes := make([]byte, 16)
+	_, err = io.ReadFull(rand.Reader, authSentinelBytes)
+	if err != nil {
+		err = fmt.Errorf("failed to generate authentication marker: %v", err)
+		return
 	}
+	authSentinel := "SCMP-AUTH-" + hex.EncodeToString(authSentinelBytes)
 
-	// Add prefix to command
-	command = cmdPrefix + command
+	// Add escalation to command
+	command, passwordOnTerminal := buildEscalatedCommand(escalation, runAs, command, authSentinel)
 
 	printMessage(VerbosityDebug, "  Running command '%s'\n", command)
 
+	// Methods other than sudo only read passwords from a terminal (output of both streams is then on stdout)
+	if passwordOnTerminal {
+		err = session.RequestPty("dumb", 40, 200, ssh.TerminalModes{ssh.ECHO: 0})
+		if err != nil {
+			err = fmt.Errorf("failed to request terminal for %s password prompt: %v", escalation.Method, err)
+			return
+		}
+	}
+
 	// Start the command
 	err = session.Start(command)
 	if err != nil {
@@ -515,22 +1033,44 @@ func RunSSHCommand(client *ssh.Client, command string, runAs string, disableSudo
 		return
 	}
 
-	// Write sudo password to stdin - write even if password is empty
-	_, err = stdin.Write([]byte(sudoPassword))
-	if err != nil {
-		err = fmt.Errorf("failed to write to command stdin: %v", err)
-		return
-	}
-
-	// Close stdin to signal no more writing
-	err = stdin.Close()
-	if err != nil {
-		if strings.Contains(err.Error(), "EOF") {
-			// End of file is not an error - reset err and dont return
-			err = nil
+	// Read output while the command runs (answering password prompts on the terminal)
+	var Commandstdout, Commandstderr []byte
+	var passwordPromptEnd, passwordPrompts int
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		if passwordOnTerminal {
+			Commandstdout, passwordPromptEnd, passwordPrompts = answerPasswordPrompts(stdout, stdin, escalation.Password, authSentinel)
 		} else {
-			err = fmt.Errorf("failed to close stdin: %v", err)
-			return
+			Commandstdout, _ = io.ReadAll(stdout)
+		}
+	}()
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		Commandstderr, _ = io.ReadAll(stderr)
+	}()
+
+	if !passwordOnTerminal {
+		// Write sudo password to stdin - write even if password is empty
+		if escalation.Method == "sudo" {
+			_, err = stdin.Write(escalation.Password)
+			if err != nil {
+				err = fmt.Errorf("failed to write to command stdin: %v", err)
+				return
+			}
+		}
+
+		// Close stdin to signal no more writing
+		err = stdin.Close()
+		if err != nil {
+			if strings.Contains(err.Error(), "EOF") {
+				// End of file is not an error - reset err and dont return
+				err = nil
+			} else {
+				err = fmt.Errorf("failed to close stdin: %v", err)
+				return
+			}
 		}
 	}
 
@@ -540,33 +1080,15 @@ func RunSSHCommand(client *ssh.Client, command string, runAs string, disableSudo
 	defer cancel()
 
 	// Wait for the command to finish with timeout
-	var Commandstderr []byte
-	var exitStatusZero bool
 	errChannel := make(chan error)
 	go func() {
 		errChannel <- session.Wait()
 	}()
 	// Block until errChannel is done, then parse errors
+	var commandErr error
 	select {
-	// Command finishes before timeout with error
-	case err = <-errChannel:
-		if err != nil {
-			// Return both exit status and stderr (readall errors are ignored as exit status will still be present)
-			var errorsError error // Store local error
-			Commandstderr, errorsError = io.ReadAll(stderr)
-			if errorsError != nil {
-				// Return at any errors reading the command error
-				err = fmt.Errorf("error reading error from command '%s': %v", command, errorsError)
-				return
-			}
-
-			// Return commands error
-			err = fmt.Errorf("error with command '%s': %v: %s", command, err, Commandstderr)
-			return
-		} else {
-			// nil from session.Wait() means exit status zero from the command
-			exitStatusZero = true
-		}
+	// Command finishes before timeout
+	case commandErr = <-errChannel:
 	// Timer finishes before command
 	case <-ctx.Done():
 		session.Signal(ssh.SIGTERM)
@@ -574,41 +1096,214 @@ func RunSSHCommand(client *ssh.Client, command string, runAs string, disableSudo
 		err = fmt.Errorf("closed ssh session: exceeded timeout (%d seconds) for command %s", timeout, command)
 		return
 	}
+	<-outputDone
+	<-stderrDone
 
-	// Read commands output from session
-	Commandstdout, err := io.ReadAll(stdout)
-	if err != nil {
-		err = fmt.Errorf("error reading from io.Reader: %v", err)
-		return
-	}
-
-	// Read commands error output from session
-	Commandstderr, err = io.ReadAll(stderr)
-	if err != nil {
-		err = fmt.Errorf("error reading from io.Reader: %v", err)
-		return
+	// Terminal output is only the commands output after the authentication marker (or the escalation error after the last prompt)
+	if passwordOnTerminal {
+		Commandstdout = bytes.ReplaceAll(Commandstdout[passwordPromptEnd:], []byte("\r\n"), []byte("\n"))
 	}
 
 	// Convert bytes to string
 	CommandOutput = string(Commandstdout)
 	CommandError := string(Commandstderr)
 
-	// If the command had an error on the remote side and session indicated non-zero exit status
-	if CommandError != "" && !exitStatusZero {
-		// Only return valid errors
-		if strings.Contains(CommandError, "[sudo] password for") {
-			// Sudo puts password prompts into stderr when running with '-S'
-			err = nil
-		} else {
-			err = fmt.Errorf("%s", CommandError)
+	if commandErr != nil {
+		// Terminal output has errors mixed into stdout
+		if passwordOnTerminal {
+			CommandError = CommandOutput
+		}
+
+		// Report failed escalation separately from command errors
+		escalationError := privilegeEscalationError(escalation.Method, CommandError, passwordPrompts)
+		if escalationError != "" {
+			err = fmt.Errorf("privilege escalation using %s failed for command '%s': %s", escalation.Method, command, escalationError)
+			return
+		}
+
+		// Return commands error
+		err = fmt.Errorf("error with command '%s': %v: %s", command, commandErr, CommandError)
+		return
+	}
+
+	return
+}
+
+// Adds privilege escalation to a command
+// The command always runs as one 'sh -c' word so command lists, pipes, and comments are escalated as a whole
+// Methods that read passwords from a terminal print the authentication marker before the command
+// Returns if the method reads its password from a terminal (instead of stdin like sudo -S)
+func buildEscalatedCommand(escalation PrivilegeEscalation, runAs string, command string, authSentinel string) (escalatedCommand string, passwordOnTerminal bool) {
+	// Root is the default target user of all methods
+	if runAs == "root" {
+		runAs = ""
+	}
+	hasPassword := len(escalation.Password) > 0
+
+	shellCommand := "sh -c " + shellQuote(command)
+	terminalCommand := "sh -c " + shellQuote("printf '%s\\n' "+authSentinel+"\n"+command)
+
+	switch escalation.Method {
+	case "sudo":
+		userArg := ""
+		if runAs != "" {
+			userArg = "-u " + shellQuote(runAs) + " "
+		}
+		if !hasPassword {
+			escalatedCommand = "sudo -n " + userArg + shellCommand
+			return
+		}
+		// NOPASSWD rules are detected first, the password on stdin is then never read
+		escalatedCommand = "if sudo -n true 2>/dev/null; then sudo -n " + userArg + shellCommand + " </dev/null; else sudo -S -p '' " + userArg + shellCommand + "; fi"
+	case "doas":
+		userArg := ""
+		if runAs != "" {
+			userArg = "-u " + shellQuote(runAs) + " "
+		}
+		if !hasPassword {
+			escalatedCommand = "doas -n " + userArg + shellCommand
+			return
+		}
+		escalatedCommand = "doas " + userArg + terminalCommand
+		passwordOnTerminal = true
+	case "su":
+		targetUser := runAs
+		if targetUser == "" {
+			targetUser = "root"
+		}
+		// User before -c works for both util-linux and BusyBox su (the command is already one shell word)
+		if !hasPassword {
+			escalatedCommand = "su " + shellQuote(targetUser) + " -c " + shellQuote(command)
+			return
+		}
+		escalatedCommand = "su " + shellQuote(targetUser) + " -c " + shellQuote("printf '%s\\n' "+authSentinel+"\n"+command)
+		passwordOnTerminal = true
+	case "run0":
+		userArg := ""
+		if runAs != "" {
+			userArg = "--user=" + shellQuote(runAs) + " "
+		}
+		if !hasPassword {
+			escalatedCommand = "run0 --no-ask-password " + userArg + shellCommand
+			return
+		}
+		escalatedCommand = "run0 " + userArg + terminalCommand
+		passwordOnTerminal = true
+	case "pkexec":
+		userArg := ""
+		if runAs != "" {
+			userArg = "--user " + shellQuote(runAs) + " "
+		}
+		if !hasPassword {
+			escalatedCommand = "pkexec " + userArg + shellCommand
+			return
+		}
+		escalatedCommand = "pkexec " + userArg + terminalCommand
+		passwordOnTerminal = true
+	default:
+		// No escalation
+		escalatedCommand = command
+	}
+	return
+}
+
+// Reads terminal output of a command and answers the password prompt of the escalation method
+// Only output before the authentication marker line is from the escalation method, everything after it is command output
+// A second prompt means the password was refused, stdin is then closed so the method fails instead of waiting
+// Returns all output, the offset where command output (or the error after the first prompt) starts, and the number of prompts seen
+func answerPasswordPrompts(terminalOutput io.Reader, terminalInput io.WriteCloser, password []byte, authSentinel string) (output []byte, promptEnd int, prompts int) {
+	// Terminals usually turn the newline into CRLF
+	sentinelLines := [][]byte{[]byte(authSentinel + "\r\n"), []byte(authSentinel + "\n")}
+	authenticated := false
+
+	readBuffer := make([]byte, 4096)
+	for {
+		readBytes, readErr := terminalOutput.Read(readBuffer)
+		output = append(output, readBuffer[:readBytes]...)
+
+		if !authenticated {
+			for _, sentinelLine := range sentinelLines {
+				sentinelIndex := bytes.Index(output[promptEnd:], sentinelLine)
+				if sentinelIndex != -1 {
+					authenticated = true
+					promptEnd += sentinelIndex + len(sentinelLine)
+					break
+				}
+			}
+		}
+		if !authenticated && prompts < 2 && passwordPromptRegEx.Match(output[promptEnd:]) {
+			prompts++
+			if prompts == 1 {
+				promptEnd = len(output)
+				terminalInput.Write(append(append([]byte{}, password...), '\n'))
+			} else {
+				// Never answered again
+				terminalInput.Close()
+			}
+		}
+
+		if readErr != nil {
+			return
+		}
+	}
+}
+
+// Identifies errors of the privilege escalation method itself (wrong password, not permitted) in command errors
+// Returns empty string when the error is from the command
+func privilegeEscalationError(method string, commandError string, passwordPrompts int) (escalationError string) {
+	if passwordPrompts > 1 {
+		escalationError = "password was not accepted"
+		return
+	}
+
+	escalationFailures := map[string][]string{
+		"sudo":   {"sudo: a password is required", "incorrect password attempt", "Sorry, try again", "is not in the sudoers file", "is not allowed to execute", "sudo: a terminal is required"},
+		"doas":   {"doas: Authentication failed", "doas: Operation not permitted", "doas: a password is required"},
+		"su":     {"su: Authentication failure", "su: incorrect password", "su: must be run from a terminal", "su: user "},
+		"run0":   {"Interactive authentication required", "Access denied", "Failed to start transient service unit"},
+		"pkexec": {"Not authorized", "Error executing command as another user", "Request dismissed"},
+	}
+	for _, failure := range escalationFailures[method] {
+		if strings.Contains(commandError, failure) {
+			escalationError = strings.TrimSpace(commandError)
 			return
 		}
 	}
+	return
+}
+
+// Builds a remote shell command with every argument passed as exactly one word
+// Callers put '--' before path arguments so names starting with '-' are not read as options
+func buildCommand(arguments ...string) (command string) {
+	quotedArguments := make([]string, len(arguments))
+	for index, argument := range arguments {
+		quotedArguments[index] = shellQuote(argument)
+	}
+	command = strings.Join(quotedArguments, " ")
+	return
+}
 
+// Quotes a string as a single shell word (words of only safe characters are left as is for readable commands)
+func shellQuote(word string) (quoted string) {
+	if shellSafeWordRegEx.MatchString(word) {
+		quoted = word
+		return
+	}
+	quoted = "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+	return
+}
+
+// Privilege escalation for remote commands of a host (disabled by --disable-privilege-escalation)
+func hostPrivilegeEscalation(hostInfo EndpointInfo) (escalation PrivilegeEscalation) {
+	escalation.Method = hostInfo.PrivilegeEscalation
+	if config.DisableSudo || escalation.Method == "" {
+		escalation.Method = "none"
+	}
+	escalation.Password = hostInfo.SudoPassword
 	return
 }
 
-func executeScript(sshClient *ssh.Client, SudoPassword string, remoteTransferBuffer string, scriptInterpreter string, remoteFilePath string, scriptFileBytes []byte, scriptHash string) (out string, err error) {
+func executeScript(sshClient *ssh.Client, escalation PrivilegeEscalation, capabilities RemoteCapabilities, remoteTransferBuffer string, scriptInterpreter string, remoteFilePath string, scriptFileBytes []byte, scriptHash string) (out string, err error) {
 	// Upload script contents
 	err = SCPUpload(sshClient, scriptFileBytes, remoteTransferBuffer)
 	if err != nil {
@@ -616,20 +1311,17 @@ func executeScript(sshClient *ssh.Client, SudoPassword string, remoteTransferBuf
 	}
 
 	// Move script into execution location
-	command := "mv " + remoteTransferBuffer + " " + remoteFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	command := buildCommand("mv", "--", remoteTransferBuffer, remoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		return
 	}
 
 	// Hash remote script file
-	command = "sha256sum " + remoteFilePath
-	remoteScriptHash, err := RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 90)
+	remoteScriptHash, err := remoteFileHash(sshClient, escalation, capabilities, remoteFilePath)
 	if err != nil {
 		return
 	}
-	// Parse hash command output to get just the hex
-	remoteScriptHash = SHA256RegEx.FindString(remoteScriptHash)
 
 	printMessage(VerbosityFullData, "Remote Script Hash '%s'\n", remoteScriptHash)
 
@@ -640,22 +1332,22 @@ func executeScript(sshClient *ssh.Client, SudoPassword string, remoteTransferBuf
 	}
 
 	// Change permissions on remote file
-	command = "chmod 700 " + remoteFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	command = buildCommand("chmod", "700", "--", remoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		return
 	}
 
 	// Execute script
-	command = scriptInterpreter + " " + remoteFilePath
-	out, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 900)
+	command = buildCommand(append(strings.Fields(scriptInterpreter), remoteFilePath)...)
+	out, err = RunSSHCommand(sshClient, command, "root", escalation, 900)
 	if err != nil {
 		return
 	}
 
 	// Cleanup: Remove script
-	command = "rm " + remoteFilePath
-	_, err = RunSSHCommand(sshClient, command, "root", config.DisableSudo, SudoPassword, 10)
+	command = buildCommand("rm", "--", remoteFilePath)
+	_, err = RunSSHCommand(sshClient, command, "root", escalation, 10)
 	if err != nil {
 		return
 	}
@@ -1,7 +1,21 @@
 // controller
 package main
 
-import "testing"
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
 
 func TestParseEndpointAddress(t *testing.T) {
 	tests := []struct {
@@ -52,6 +66,27 @@ func TestParseEndpointAddress(t *testing.T) {
 			expectedAddr: "",
 			expectError:  true,
 		},
+		// Valid host name (normalized to lower case)
+		{
+			endpointIP:   "NS1.Domain.com.",
+			port:         "22",
+			expectedAddr: "ns1.domain.com:22",
+			expectError:  false,
+		},
+		// Invalid host name characters
+		{
+			endpointIP:   "web_01.domain.com",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
+		// Invalid host name label
+		{
+			endpointIP:   "-web01.domain.com",
+			port:         "22",
+			expectedAddr: "",
+			expectError:  true,
+		},
 	}
 
 	for _, test := range tests {
@@ -73,3 +108,481 @@ func TestParseEndpointAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadSSHCertificate(t *testing.T) {
+	tempDir := t.TempDir()
+
+	newSigner := func() ssh.Signer {
+		_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+		signer, _ := ssh.NewSignerFromKey(privateKey)
+		return signer
+	}
+	caSigner := newSigner()
+	userSigner := newSigner()
+	otherSigner := newSigner()
+
+	writeCertificate := func(name string, key ssh.PublicKey, certType uint32, validBefore time.Time) (certificatePath string) {
+		certificate := &ssh.Certificate{
+			Key:             key,
+			CertType:        certType,
+			KeyId:           "deployer",
+			ValidPrincipals: []string{"deployer"},
+			ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(validBefore.Unix()),
+		}
+		err := certificate.SignCert(rand.Reader, caSigner)
+		if err != nil {
+			t.Fatalf("failed to sign certificate: %v", err)
+		}
+		certificatePath = filepath.Join(tempDir, name)
+		err = os.WriteFile(certificatePath, ssh.MarshalAuthorizedKey(certificate), 0644)
+		if err != nil {
+			t.Fatalf("failed to write certificate: %v", err)
+		}
+		return
+	}
+
+	identityPath := filepath.Join(tempDir, "id_ed25519")
+	writeCertificate("id_ed25519-cert.pub", userSigner.PublicKey(), ssh.UserCert, time.Now().Add(time.Hour))
+	otherCertificate := writeCertificate("other-cert.pub", otherSigner.PublicKey(), ssh.UserCert, time.Now().Add(time.Hour))
+	expiredCertificate := writeCertificate("expired-cert.pub", userSigner.PublicKey(), ssh.UserCert, time.Now().Add(-time.Minute))
+	hostCertificate := writeCertificate("host-cert.pub", userSigner.PublicKey(), ssh.HostCert, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name              string
+		identityFile      string
+		certificateFile   string
+		expectCertificate bool
+		expectError       bool
+	}{
+		{"Default certificate path", identityPath, "", true, false},
+		{"Default certificate path from public key", identityPath + ".pub", "", true, false},
+		{"No certificate", filepath.Join(tempDir, "nocert"), "", false, false},
+		{"Missing configured certificate", identityPath, filepath.Join(tempDir, "missing-cert.pub"), false, true},
+		{"Certificate for other key", identityPath, otherCertificate, false, true},
+		{"Expired certificate", identityPath, expiredCertificate, false, true},
+		{"Host certificate", identityPath, hostCertificate, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := loadSSHCertificate(userSigner, test.identityFile, test.certificateFile)
+			if (err != nil) != test.expectError {
+				t.Fatalf("loadSSHCertificate() error = %v, expected error: %v", err, test.expectError)
+			}
+			if test.expectError {
+				return
+			}
+
+			_, isCertificate := signer.PublicKey().(*ssh.Certificate)
+			if isCertificate != test.expectCertificate {
+				t.Errorf("loadSSHCertificate() returned certificate: %v, expected: %v", isCertificate, test.expectCertificate)
+			}
+		})
+	}
+}
+
+func TestPreferredHostKeyAlgorithms(t *testing.T) {
+	tests := []struct {
+		keyAlgorithm        string
+		knownKeyTypes       []string
+		trustsCertAuthority bool
+		expected            []string
+	}{
+		{ssh.KeyAlgoED25519, nil, false, []string{ssh.KeyAlgoED25519}},
+		{ssh.KeyAlgoED25519, nil, true, []string{ssh.CertAlgoED25519v01, ssh.KeyAlgoED25519}},
+		{ssh.KeyAlgoED25519, []string{ssh.KeyAlgoECDSA256}, false, []string{ssh.KeyAlgoECDSA256}},
+		{ssh.KeyAlgoED25519, []string{ssh.KeyAlgoRSA}, false, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}},
+		{ssh.KeyAlgoRSA, nil, true, []string{ssh.CertAlgoRSASHA512v01, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}},
+		{"unknown-algorithm", nil, true, []string{"unknown-algorithm"}},
+	}
+
+	for _, test := range tests {
+		result := preferredHostKeyAlgorithms(test.keyAlgorithm, test.knownKeyTypes, test.trustsCertAuthority)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("preferredHostKeyAlgorithms(%s, %v, %v) = %v, expected %v", test.keyAlgorithm, test.knownKeyTypes, test.trustsCertAuthority, result, test.expected)
+		}
+	}
+}
+
+func TestParseProxyJump(t *testing.T) {
+	tests := []struct {
+		proxyJump   string
+		expected    []string
+		expectError bool
+	}{
+		{"", nil, false},
+		{"none", nil, false},
+		{"bastion", []string{"bastion"}, false},
+		{"bastion, admin@10.0.0.1:2222", []string{"bastion", "admin@10.0.0.1:2222"}, false},
+		{"ssh://bastion", []string{"bastion"}, false},
+		{"bastion,,web01", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.proxyJump, func(t *testing.T) {
+			result, err := parseProxyJump(test.proxyJump)
+			if (err != nil) != test.expectError {
+				t.Fatalf("parseProxyJump(%s) error = %v, expected error: %v", test.proxyJump, err, test.expectError)
+			}
+			if !test.expectError && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("parseProxyJump(%s) = %v, expected %v", test.proxyJump, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseJumpHostAddress(t *testing.T) {
+	tests := []struct {
+		jumpHost     string
+		expectedUser string
+		expectedHost string
+		expectedPort string
+		expectError  bool
+	}{
+		{"10.0.0.1", "", "10.0.0.1", "22", false},
+		{"admin@10.0.0.1", "admin", "10.0.0.1", "22", false},
+		{"admin@10.0.0.1:2222", "admin", "10.0.0.1", "2222", false},
+		{"fd00::1", "", "fd00::1", "22", false},
+		{"admin@[fd00::1]:2222", "admin", "fd00::1", "2222", false},
+		{"@10.0.0.1", "", "", "", true},
+		{"admin@", "", "", "", true},
+		{"[fd00::1", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.jumpHost, func(t *testing.T) {
+			user, host, port, err := parseJumpHostAddress(test.jumpHost)
+			if (err != nil) != test.expectError {
+				t.Fatalf("parseJumpHostAddress(%s) error = %v, expected error: %v", test.jumpHost, err, test.expectError)
+			}
+			if test.expectError {
+				return
+			}
+			if user != test.expectedUser || host != test.expectedHost || port != test.expectedPort {
+				t.Errorf("parseJumpHostAddress(%s) = %s, %s, %s, expected %s, %s, %s", test.jumpHost, user, host, port, test.expectedUser, test.expectedHost, test.expectedPort)
+			}
+		})
+	}
+}
+
+func TestApplyAlgorithmList(t *testing.T) {
+	defaults := []string{"a-1", "b-1", "b-2", "c-1"}
+
+	tests := []struct {
+		algorithmList string
+		expected      []string
+		expectError   bool
+	}{
+		{"", defaults, false},
+		{"c-1,a-1", []string{"c-1", "a-1"}, false},
+		{"+d-1,a-1", []string{"a-1", "b-1", "b-2", "c-1", "d-1"}, false},
+		{"^d-1,c-1", []string{"d-1", "c-1", "a-1", "b-1", "b-2"}, false},
+		{"-b-*", []string{"a-1", "c-1"}, false},
+		{"-*", nil, true},
+		{"a-1,,b-1", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.algorithmList, func(t *testing.T) {
+			result, err := applyAlgorithmList(defaults, test.algorithmList)
+			if (err != nil) != test.expectError {
+				t.Fatalf("applyAlgorithmList(%s) error = %v, expected error: %v", test.algorithmList, err, test.expectError)
+			}
+			if !test.expectError && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("applyAlgorithmList(%s) = %v, expected %v", test.algorithmList, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestIsPasswordPrompt(t *testing.T) {
+	tests := []struct {
+		question string
+		expected bool
+	}{
+		{"Password: ", true},
+		{"deployer@10.0.0.1's password: ", true},
+		{"Password for deployer@example.com: ", true},
+		{"One-time password (OATH) for `deployer': ", false},
+		{"Verification code: ", false},
+		{"New password: ", false},
+		{"Enter PIN for password token: ", false},
+		{"Username: ", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.question, func(t *testing.T) {
+			result := isPasswordPrompt(test.question)
+			if result != test.expected {
+				t.Errorf("isPasswordPrompt(%q) = %v, expected %v", test.question, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestAnswerKeyboardInteractive(t *testing.T) {
+	password := []byte("vaultpassword")
+	var passwordSent bool
+
+	answers, err := answerKeyboardInteractive("web01", password, &passwordSent, "", "", []string{"Password: "}, []bool{false})
+	if err != nil {
+		t.Fatalf("unexpected error answering password prompt: %v", err)
+	}
+	if !reflect.DeepEqual(answers, []string{"vaultpassword"}) || !passwordSent {
+		t.Errorf("expected vault password answer, got %v (sent: %v)", answers, passwordSent)
+	}
+
+	// Info messages without questions need no answers
+	answers, err = answerKeyboardInteractive("web01", password, &passwordSent, "", "Welcome", nil, nil)
+	if err != nil || len(answers) != 0 {
+		t.Errorf("expected no answers for info message, got %v, %v", answers, err)
+	}
+
+	// A repeated password prompt (wrong password) and other challenges go to the terminal, which tests do not have
+	for _, question := range []string{"Password: ", "Verification code: "} {
+		_, err = answerKeyboardInteractive("web01", password, &passwordSent, "", "", []string{question}, []bool{false})
+		if err == nil {
+			t.Errorf("expected prompt %q to require a terminal", question)
+		}
+	}
+}
+
+func TestBuildEscalatedCommand(t *testing.T) {
+	password := []byte("hunter2")
+
+	tests := []struct {
+		method                     string
+		password                   []byte
+		runAs                      string
+		expectedCommand            string
+		expectedPasswordOnTerminal bool
+	}{
+		{"none", password, "root", "ls /etc", false},
+		{"sudo", nil, "root", "sudo -n sh -c 'ls /etc'", false},
+		{"sudo", password, "nginx", "if sudo -n true 2>/dev/null; then sudo -n -u nginx sh -c 'ls /etc' </dev/null; else sudo -S -p '' -u nginx sh -c 'ls /etc'; fi", false},
+		{"doas", nil, "", "doas -n sh -c 'ls /etc'", false},
+		{"doas", password, "nginx", "doas -u nginx sh -c 'printf '\\''%s\\n'\\'' SENTINEL\nls /etc'", true},
+		{"su", password, "root", "su root -c 'printf '\\''%s\\n'\\'' SENTINEL\nls /etc'", true},
+		{"su", nil, "nginx", "su nginx -c 'ls /etc'", false},
+		{"run0", nil, "root", "run0 --no-ask-password sh -c 'ls /etc'", false},
+		{"run0", password, "nginx", "run0 --user=nginx sh -c 'printf '\\''%s\\n'\\'' SENTINEL\nls /etc'", true},
+		{"pkexec", password, "root", "pkexec sh -c 'printf '\\''%s\\n'\\'' SENTINEL\nls /etc'", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+"_"+test.runAs, func(t *testing.T) {
+			escalation := PrivilegeEscalation{Method: test.method, Password: test.password}
+			command, passwordOnTerminal := buildEscalatedCommand(escalation, test.runAs, "ls /etc", "SENTINEL")
+			if command != test.expectedCommand || passwordOnTerminal != test.expectedPasswordOnTerminal {
+				t.Errorf("got (%q, %v), expected (%q, %v)", command, passwordOnTerminal, test.expectedCommand, test.expectedPasswordOnTerminal)
+			}
+		})
+	}
+}
+
+func TestBuildEscalatedCommandCompound(t *testing.T) {
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available to run built commands")
+	}
+
+	// Stub escalation tools print their arguments, the last one must be the whole command as one shell word
+	stubDirectory := t.TempDir()
+	for _, method := range []string{"sudo", "doas", "su", "run0", "pkexec"} {
+		err = os.WriteFile(filepath.Join(stubDirectory, method), []byte("#!/bin/sh\nprintf '%s\\0' \"$@\"\n"), 0755)
+		if err != nil {
+			t.Fatalf("failed to write stub %s: %v", method, err)
+		}
+	}
+	stubEnvironment := append(os.Environ(), "PATH="+stubDirectory+":"+os.Getenv("PATH"))
+
+	compoundCommand := "echo one && echo 'two three' # comment; echo four"
+	for _, method := range []string{"sudo", "doas", "su", "run0", "pkexec"} {
+		for _, password := range [][]byte{nil, []byte("hunter2")} {
+			t.Run(method+"_"+strconv.FormatBool(password != nil), func(t *testing.T) {
+				escalation := PrivilegeEscalation{Method: method, Password: password}
+				command, passwordOnTerminal := buildEscalatedCommand(escalation, "nginx", compoundCommand, "SENTINEL")
+
+				shell := exec.Command(shellPath, "-c", command)
+				shell.Env = stubEnvironment
+				output, err := shell.Output()
+				if err != nil {
+					t.Fatalf("command %s failed: %v", command, err)
+				}
+				arguments := strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00")
+				if len(arguments) < 2 || arguments[len(arguments)-2] != "-c" {
+					t.Fatalf("command %s passed arguments %q, expected -c and one shell word", command, arguments)
+				}
+
+				output, err = exec.Command(shellPath, "-c", arguments[len(arguments)-1]).Output()
+				if err != nil {
+					t.Fatalf("shell word %s failed: %v", arguments[len(arguments)-1], err)
+				}
+				expectedOutput := "one\ntwo three\n"
+				if passwordOnTerminal {
+					expectedOutput = "SENTINEL\n" + expectedOutput
+				}
+				if string(output) != expectedOutput {
+					t.Errorf("command %s printed %q, expected %q", command, output, expectedOutput)
+				}
+			})
+		}
+	}
+}
+
+func TestAnswerPasswordPrompts(t *testing.T) {
+	tests := []struct {
+		name              string
+		terminalOutput    []string // Chunks as read from the terminal
+		expectedInput     string
+		expectedPrompts   int
+		expectedRemaining string
+	}{
+		{"Single prompt", []string{"doas (deployer@web01) password: ", "\r\nSENTINEL\r\nfile1\r\n"}, "hunter2\n", 1, "file1\r\n"},
+		{"Refused password", []string{"Password: ", "\r\nsu: Authentication failure\r\nPassword: "}, "hunter2\n", 2, "\r\nsu: Authentication failure\r\nPassword: "},
+		{"No prompt", []string{"SENTINEL\n", "file1\n"}, "", 0, "file1\n"},
+		{"Password in output", []string{"SENTINEL\nChanging password: done\n", "file1\n"}, "", 0, "Changing password: done\nfile1\n"},
+		{"Prompt in output", []string{"Password: ", "\r\nSENTINEL\r\n", "file1\r\nEnter Password: "}, "hunter2\n", 1, "file1\r\nEnter Password: "},
+		{"Prompt in output in one chunk", []string{"SENTINEL\r\nfile1\r\nPassword: "}, "", 0, "file1\r\nPassword: "},
+		{"Marker split across chunks", []string{"Password: ", "\r\nSENTI", "NEL\r", "\nPassword: file1\r\n"}, "hunter2\n", 1, "Password: file1\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputReader, inputWriter := io.Pipe()
+			inputDone := make(chan []byte)
+			go func() {
+				input, _ := io.ReadAll(inputReader)
+				inputDone <- input
+			}()
+
+			var chunkReaders []io.Reader
+			for _, chunk := range test.terminalOutput {
+				chunkReaders = append(chunkReaders, strings.NewReader(chunk))
+			}
+
+			output, promptEnd, prompts := answerPasswordPrompts(io.MultiReader(chunkReaders...), inputWriter, []byte("hunter2"), "SENTINEL")
+			inputWriter.Close()
+			input := <-inputDone
+
+			if string(output) != strings.Join(test.terminalOutput, "") {
+				t.Errorf("output = %q, expected %q", output, strings.Join(test.terminalOutput, ""))
+			}
+			if prompts != test.expectedPrompts || string(input) != test.expectedInput {
+				t.Errorf("prompts = %d, input = %q, expected %d and %q", prompts, input, test.expectedPrompts, test.expectedInput)
+			}
+			if string(output[promptEnd:]) != test.expectedRemaining {
+				t.Errorf("output after prompt = %q, expected %q", output[promptEnd:], test.expectedRemaining)
+			}
+		})
+	}
+}
+
+func TestPrivilegeEscalationError(t *testing.T) {
+	tests := []struct {
+		method          string
+		commandError    string
+		passwordPrompts int
+		expectEscalated bool
+	}{
+		{"sudo", "sudo: 1 incorrect password attempt", 0, true},
+		{"sudo", "ls: cannot access '/nope': No such file or directory", 0, false},
+		{"doas", "doas: Authentication failed", 1, true},
+		{"su", "anything", 2, true},
+		{"pkexec", "Error executing command as another user: Not authorized", 1, true},
+		{"run0", "mv: cannot move", 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+"_"+test.commandError, func(t *testing.T) {
+			result := privilegeEscalationError(test.method, test.commandError, test.passwordPrompts)
+			if (result != "") != test.expectEscalated {
+				t.Errorf("privilegeEscalationError(%s, %q, %d) = %q, expected escalation error: %v", test.method, test.commandError, test.passwordPrompts, result, test.expectEscalated)
+			}
+		})
+	}
+}
+
+// Filenames that break or inject into naively concatenated commands
+var hostileFileNames = []string{
+	"/etc/plain.conf",
+	"/etc/with space.conf",
+	"/etc/it's.conf",
+	"/etc/$(touch pwned).conf",
+	"/etc/`id`.conf",
+	"/etc/a;rm -rf b.conf",
+	"/etc/a && reboot",
+	"/etc/new\nline.conf",
+	"/etc/glob*.conf",
+	"/etc/~user/$HOME/x|y>z<w&.conf",
+	"-rf",
+	"--help",
+	"",
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"/etc/nginx/nginx.conf", "/etc/nginx/nginx.conf"},
+		{"root:root", "root:root"},
+		{"with space", "'with space'"},
+		{"it's", `'it'\''s'`},
+		{"$(id)", "'$(id)'"},
+		{"~", "'~'"},
+		{"=cmd", "'=cmd'"},
+		{"", "''"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.word, func(t *testing.T) {
+			result := shellQuote(test.word)
+			if result != test.expected {
+				t.Errorf("shellQuote(%q) = %s, expected %s", test.word, result, test.expected)
+			}
+		})
+	}
+}
+
+func TestBuildCommandHostileFileNames(t *testing.T) {
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available to run built commands")
+	}
+
+	// Run in an empty directory so globs and injected commands would be visible
+	workingDirectory := t.TempDir()
+
+	for _, fileName := range hostileFileNames {
+		t.Run(fileName, func(t *testing.T) {
+			command := buildCommand("printf", "%s\\0", fileName)
+			shell := exec.Command(shellPath, "-c", command)
+			shell.Dir = workingDirectory
+			output, err := shell.Output()
+			if err != nil {
+				t.Fatalf("command %s failed: %v", command, err)
+			}
+
+			expectedOutput := fileName + "\x00"
+			if string(output) != expectedOutput {
+				t.Errorf("command %s passed %q, expected %q", command, output, expectedOutput)
+			}
+		})
+	}
+
+	// Escalated commands are quoted a second time for su
+	for _, fileName := range hostileFileNames {
+		command, _ := buildEscalatedCommand(PrivilegeEscalation{Method: "su"}, "", buildCommand("rm", "--", fileName), "SENTINEL")
+		expectedCommand := "su root -c " + shellQuote(buildCommand("rm", "--", fileName))
+		if command != expectedCommand {
+			t.Errorf("escalated command = %s, expected %s", command, expectedCommand)
+		}
+	}
+
+	workingDirectoryEntries, _ := os.ReadDir(workingDirectory)
+	if len(workingDirectoryEntries) > 0 {
+		t.Errorf("hostile file names created files through injected commands: %v", workingDirectoryEntries)
+	}
+}
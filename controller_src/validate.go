@@ -0,0 +1,312 @@
+// controller
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Validates the staged tree (pre-commit) or pushed commits (pre-push) when called by git hooks
+// Problems exit with an error so git rejects the commit or push (nothing is rolled back)
+func validateGitHook(hookName string) {
+	var err error
+
+	// Check working dir for git repo
+	err = retrieveGitRepoPath()
+	logError("Repository Error", err, false)
+
+	repo, err := git.PlainOpen(config.RepositoryPath)
+	logError("Unable to open repository", err, false)
+
+	// Files for hosts marked offline still have to be valid
+	config.IgnoreDeploymentState = true
+
+	if hookName == "pre-commit" {
+		var tree *object.Tree
+		tree, err = buildIndexTree(repo)
+		logError("Failed to read staged files", err, false)
+
+		err = validateRepositoryTree(tree)
+		logError("Commit rejected", err, false)
+
+		printMessage(VerbosityProgress, "Staged files are valid\n")
+	} else if hookName == "pre-push" {
+		var commits []*object.Commit
+		commits, err = readPushedCommits(repo)
+		logError("Failed to read pushed commits", err, false)
+
+		for _, commit := range commits {
+			printMessage(VerbosityProgress, "Validating commit %s\n", commit.Hash.String())
+
+			var tree *object.Tree
+			tree, err = commit.Tree()
+			logError("Failed to retrieve commit tree", err, false)
+
+			err = validateRepositoryTree(tree)
+			logError(fmt.Sprintf("Push rejected, commit %s", commit.Hash.String()), err, false)
+		}
+
+		printMessage(VerbosityProgress, "Pushed commits are valid\n")
+	} else {
+		logError("Invalid validation hook", fmt.Errorf("hook must be pre-commit or pre-push"), false)
+	}
+}
+
+// Runs lint checks and the deployment parsing pipeline (without connecting to hosts) against a tree
+func validateRepositoryTree(tree *object.Tree) (err error) {
+	findings, err := lintRepositoryTree(tree)
+	if err != nil {
+		return
+	}
+
+	var errorCount int
+	for _, finding := range findings {
+		if finding.Severity == lintSeverityError {
+			errorCount++
+			printMessage(VerbosityStandard, "  %s: %s: %s\n", finding.File, finding.Check, finding.Message)
+		} else {
+			printMessage(VerbosityProgress, "  Warning: %s: %s: %s\n", finding.File, finding.Check, finding.Message)
+		}
+	}
+	if errorCount > 0 {
+		err = fmt.Errorf("found %d problem(s)", errorCount)
+		return
+	}
+
+	// Every deployable file as deploy-all would load it (symbolic links are checked by lint)
+	commitFiles := make(map[string]string)
+	err = tree.Files().ForEach(func(repoFile *object.File) (err error) {
+		if repoFileIsValid(repoFile.Name) || determineFileType(fmt.Sprintf("%v", repoFile.Mode)) != "regular" {
+			return
+		}
+		if strings.HasSuffix(repoFile.Name, directoryMetadataFileName) {
+			commitFiles[repoFile.Name] = "dirCreate"
+		} else {
+			commitFiles[repoFile.Name] = "create"
+		}
+		return
+	})
+	if err != nil {
+		err = fmt.Errorf("failed retrieving repository files: %v", err)
+		return
+	}
+	if len(commitFiles) == 0 {
+		return
+	}
+
+	allHostsFiles, universalFiles, err := parseAllRepoFiles(tree)
+	if err != nil {
+		return
+	}
+	deniedUniversalFiles := mapDeniedUniversalFiles(allHostsFiles, universalFiles)
+	patchFiles, err := mapPatchFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if err != nil {
+		return
+	}
+	fragmentFiles, err := mapFragmentFiles(allHostsFiles, universalFiles, deniedUniversalFiles)
+	if err != nil {
+		return
+	}
+
+	_, allDeploymentFiles := filterHostsAndFiles(deniedUniversalFiles, universalFiles, fragmentFiles, patchFiles, commitFiles, "")
+	if len(allDeploymentFiles) == 0 {
+		return
+	}
+
+	_, err = loadFiles(allDeploymentFiles, fragmentFiles, patchFiles, tree)
+	return
+}
+
+// Builds tree objects from the git index (like 'git write-tree') so staged files can be validated before the commit exists
+// Uses the temporary index git provides to hooks for 'commit -a' or 'commit <paths>'
+func buildIndexTree(repo *git.Repository) (tree *object.Tree, err error) {
+	var stagedIndex *index.Index
+	indexFilePath := os.Getenv("GIT_INDEX_FILE")
+	if indexFilePath != "" {
+		var indexFile *os.File
+		indexFile, err = os.Open(indexFilePath)
+		if err != nil {
+			err = fmt.Errorf("failed opening index file: %v", err)
+			return
+		}
+		defer indexFile.Close()
+
+		stagedIndex = &index.Index{}
+		err = index.NewDecoder(bufio.NewReader(indexFile)).Decode(stagedIndex)
+	} else {
+		stagedIndex, err = repo.Storer.Index()
+	}
+	if err != nil {
+		err = fmt.Errorf("failed reading index: %v", err)
+		return
+	}
+
+	// Trees by directory path (root is empty)
+	indexTrees := map[string]*object.Tree{"": {}}
+	for _, entry := range stagedIndex.Entries {
+		// Only fully merged entries are stage 0
+		if entry.Stage != 0 {
+			err = fmt.Errorf("file '%s' has unresolved merge conflicts", entry.Name)
+			return
+		}
+
+		pathNames := strings.Split(entry.Name, "/")
+		for pathDepth := 1; pathDepth < len(pathNames); pathDepth++ {
+			directory := strings.Join(pathNames[:pathDepth], "/")
+			_, treeExists := indexTrees[directory]
+			if treeExists {
+				continue
+			}
+			indexTrees[directory] = &object.Tree{}
+			parentDirectory := strings.Join(pathNames[:pathDepth-1], "/")
+			indexTrees[parentDirectory].Entries = append(indexTrees[parentDirectory].Entries, object.TreeEntry{Name: pathNames[pathDepth-1], Mode: filemode.Dir})
+		}
+
+		parentDirectory := strings.Join(pathNames[:len(pathNames)-1], "/")
+		indexTrees[parentDirectory].Entries = append(indexTrees[parentDirectory].Entries, object.TreeEntry{Name: pathNames[len(pathNames)-1], Mode: entry.Mode, Hash: entry.Hash})
+	}
+
+	treeHash, err := storeIndexTree("", indexTrees, repo.Storer)
+	if err != nil {
+		return
+	}
+	tree, err = object.GetTree(repo.Storer, treeHash)
+	return
+}
+
+// Writes a directory tree (and the trees beneath it) to the object store
+func storeIndexTree(directory string, indexTrees map[string]*object.Tree, objectStorer storer.EncodedObjectStorer) (treeHash plumbing.Hash, err error) {
+	indexTree := indexTrees[directory]
+	for entryIndex, entry := range indexTree.Entries {
+		if entry.Mode != filemode.Dir {
+			continue
+		}
+		indexTree.Entries[entryIndex].Hash, err = storeIndexTree(path.Join(directory, entry.Name), indexTrees, objectStorer)
+		if err != nil {
+			return
+		}
+	}
+
+	// Git orders entries by name, with directories compared as 'name/'
+	sort.Slice(indexTree.Entries, func(i, j int) bool {
+		return treeEntrySortName(indexTree.Entries[i]) < treeEntrySortName(indexTree.Entries[j])
+	})
+
+	treeObject := objectStorer.NewEncodedObject()
+	err = indexTree.Encode(treeObject)
+	if err != nil {
+		err = fmt.Errorf("failed encoding tree for '%s': %v", directory, err)
+		return
+	}
+	treeHash, err = objectStorer.SetEncodedObject(treeObject)
+	if err != nil {
+		err = fmt.Errorf("failed storing tree for '%s': %v", directory, err)
+		return
+	}
+	return
+}
+
+func treeEntrySortName(entry object.TreeEntry) (sortName string) {
+	sortName = entry.Name
+	if entry.Mode == filemode.Dir {
+		sortName += "/"
+	}
+	return
+}
+
+// Reads pushed refs from stdin ('<local ref> <local sha> <remote ref> <remote sha>' per line, as git passes them to pre-push)
+// Returns the pushed commits that the remote does not have yet
+func readPushedCommits(repo *git.Repository) (commits []*object.Commit, err error) {
+	seenCommits := make(map[plumbing.Hash]bool)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		pushFields := strings.Fields(scanner.Text())
+		if len(pushFields) != 4 {
+			err = fmt.Errorf("invalid pre-push line '%s'", scanner.Text())
+			return
+		}
+		localHash := plumbing.NewHash(pushFields[1])
+		remoteHash := plumbing.NewHash(pushFields[3])
+
+		// Deleted remote refs have nothing to validate
+		if localHash.IsZero() {
+			continue
+		}
+
+		var refCommits []*object.Commit
+		refCommits, err = newCommitsInRange(repo, localHash, remoteHash, seenCommits)
+		if err != nil {
+			err = fmt.Errorf("failed retrieving commits of '%s': %v", pushFields[0], err)
+			return
+		}
+		commits = append(commits, refCommits...)
+	}
+	err = scanner.Err()
+	return
+}
+
+// Lists commits reachable from the local commit but not from the remote commit or any remote-tracking branch
+// Remote-tracking branches bound the walk when the remote commit is unknown (new branch or not fetched)
+func newCommitsInRange(repo *git.Repository, localHash plumbing.Hash, remoteHash plumbing.Hash, seenCommits map[plumbing.Hash]bool) (commits []*object.Commit, err error) {
+	localCommit, err := repo.CommitObject(localHash)
+	if err != nil {
+		return
+	}
+
+	var remoteTips []plumbing.Hash
+	if !remoteHash.IsZero() {
+		remoteTips = append(remoteTips, remoteHash)
+	}
+	refs, err := repo.References()
+	if err != nil {
+		return
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) (err error) {
+		if ref.Name().IsRemote() && ref.Type() == plumbing.HashReference {
+			remoteTips = append(remoteTips, ref.Hash())
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// Commits already on the remote are not walked again
+	remoteCommits := make(map[plumbing.Hash]bool)
+	for _, remoteTip := range remoteTips {
+		remoteCommit, commitErr := repo.CommitObject(remoteTip)
+		if commitErr != nil || remoteCommits[remoteTip] {
+			// Remote commit was not fetched or was already walked
+			continue
+		}
+		err = object.NewCommitPreorderIter(remoteCommit, remoteCommits, nil).ForEach(func(commit *object.Commit) (err error) {
+			remoteCommits[commit.Hash] = true
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	err = object.NewCommitPreorderIter(localCommit, remoteCommits, nil).ForEach(func(commit *object.Commit) (err error) {
+		if seenCommits[commit.Hash] || remoteCommits[commit.Hash] {
+			return
+		}
+		seenCommits[commit.Hash] = true
+		commits = append(commits, commit)
+		return
+	})
+	return
+}
@@ -0,0 +1,121 @@
+// controller
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestBuildIndexTree(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed retrieving worktree: %v", err)
+	}
+
+	// Names that sort differently as files and directories
+	repoFiles := []string{"host1/etc/a.conf", "host1/etc/a/b.conf", "host1/etc.d/c", "host1/etc-d", "U/etc/hosts", "README"}
+	for _, repoFile := range repoFiles {
+		filePath := filepath.Join(repoPath, repoFile)
+		err = os.MkdirAll(filepath.Dir(filePath), 0750)
+		if err != nil {
+			t.Fatalf("failed creating directory: %v", err)
+		}
+		err = os.WriteFile(filePath, []byte(repoFile+"\n"), 0640)
+		if err != nil {
+			t.Fatalf("failed writing file: %v", err)
+		}
+		_, err = worktree.Add(repoFile)
+		if err != nil {
+			t.Fatalf("failed staging file: %v", err)
+		}
+	}
+
+	stagedTree, err := buildIndexTree(repo)
+	if err != nil {
+		t.Fatalf("buildIndexTree() error = %v", err)
+	}
+
+	commitHash, err := worktree.Commit("test", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com"}})
+	if err != nil {
+		t.Fatalf("failed committing: %v", err)
+	}
+	commit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		t.Fatalf("failed retrieving commit: %v", err)
+	}
+
+	if stagedTree.Hash != commit.TreeHash {
+		t.Errorf("buildIndexTree() tree %s, expected committed tree %s", stagedTree.Hash, commit.TreeHash)
+	}
+}
+
+func TestNewCommitsInRange(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("failed creating repository: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed retrieving worktree: %v", err)
+	}
+
+	var commitHashes []plumbing.Hash
+	for commitIndex := 0; commitIndex < 3; commitIndex++ {
+		var commitHash plumbing.Hash
+		commitHash, err = worktree.Commit("test", &git.CommitOptions{AllowEmptyCommits: true, Author: &object.Signature{Name: "test", Email: "test@example.com"}})
+		if err != nil {
+			t.Fatalf("failed committing: %v", err)
+		}
+		commitHashes = append(commitHashes, commitHash)
+	}
+
+	tests := []struct {
+		name           string
+		remoteTracking plumbing.Hash
+		remoteHash     plumbing.Hash
+		expectedNew    []plumbing.Hash
+	}{
+		{"New branch without remote-tracking branches", plumbing.ZeroHash, plumbing.ZeroHash, []plumbing.Hash{commitHashes[2], commitHashes[1], commitHashes[0]}},
+		{"New branch stops at remote-tracking branch", commitHashes[0], plumbing.ZeroHash, []plumbing.Hash{commitHashes[2], commitHashes[1]}},
+		{"Unknown remote commit", commitHashes[0], plumbing.NewHash("1111111111111111111111111111111111111111"), []plumbing.Hash{commitHashes[2], commitHashes[1]}},
+		{"Known remote commit", plumbing.ZeroHash, commitHashes[1], []plumbing.Hash{commitHashes[2]}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			remoteRef := plumbing.NewRemoteReferenceName("origin", "main")
+			if test.remoteTracking.IsZero() {
+				repo.Storer.RemoveReference(remoteRef)
+			} else {
+				err = repo.Storer.SetReference(plumbing.NewHashReference(remoteRef, test.remoteTracking))
+				if err != nil {
+					t.Fatalf("failed setting remote-tracking branch: %v", err)
+				}
+			}
+
+			commits, err := newCommitsInRange(repo, commitHashes[2], test.remoteHash, make(map[plumbing.Hash]bool))
+			if err != nil {
+				t.Fatalf("newCommitsInRange() error = %v", err)
+			}
+			var newHashes []plumbing.Hash
+			for _, commit := range commits {
+				newHashes = append(newHashes, commit.Hash)
+			}
+			if !reflect.DeepEqual(newHashes, test.expectedNew) {
+				t.Errorf("newCommitsInRange() = %v, expected %v", newHashes, test.expectedNew)
+			}
+		})
+	}
+}
@@ -0,0 +1,932 @@
+// controller
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ###################################
+//      VAULT HANDLING
+// ###################################
+
+// Splits a vault entry name into its type and name parts
+// Entry names are formatted as '<type>/<name>' (like 'login/Web01' or 'passphrase/~/.ssh/id_ed25519')
+func parseVaultEntryName(entryName string) (entryType string, name string, err error) {
+	entryParts := strings.SplitN(entryName, "/", 2)
+	if len(entryParts) != 2 || entryParts[1] == "" {
+		err = fmt.Errorf("vault entry '%s' must be formatted as '<type>/<name>'", entryName)
+		return
+	}
+	entryType = entryParts[0]
+	name = entryParts[1]
+
+	// Only allow known entry types
+	for _, vaultType := range vaultEntryTypes {
+		if entryType == vaultType {
+			return
+		}
+	}
+	err = fmt.Errorf("unknown vault entry type '%s' (valid types: %s)", entryType, strings.Join(vaultEntryTypes, ", "))
+	return
+}
+
+// Converts any entries from the pre-typed vault format (keyed by host name with a login password) into login entries
+func migrateVaultEntries(vault map[string]Credential) (migrated bool) {
+	for entryName, credential := range vault {
+		// Typed entries are already in the current format
+		if strings.Contains(entryName, "/") || len(credential.LoginUserPassword) == 0 {
+			continue
+		}
+
+		printMessage(VerbosityProgress, "Migrating legacy vault entry for host '%s'\n", entryName)
+
+		vault[vaultTypeLogin+"/"+entryName] = Credential{Value: credential.LoginUserPassword}
+		delete(vault, entryName)
+		migrated = true
+	}
+	return
+}
+
+// Encodes vault entries as JSON without converting secret values to strings
+// Format is '{"<type>/<name>":{"value":"<secret>"}}' (entries sorted by name)
+func encodeVaultEntries(vault map[string]Credential) (unlockedVault []byte, err error) {
+	entryNames := make([]string, 0, len(vault))
+	for entryName := range vault {
+		entryNames = append(entryNames, entryName)
+	}
+	sort.Strings(entryNames)
+
+	// Sized for fully escaped values so appending never leaves copies of secrets behind in reallocated buffers
+	vaultSize := 2
+	for _, entryName := range entryNames {
+		vaultSize += 6*len(entryName) + 6*len(vault[entryName].Value) + 18
+	}
+	unlockedVault = make([]byte, 0, vaultSize)
+
+	unlockedVault = append(unlockedVault, '{')
+	for entryIndex, entryName := range entryNames {
+		if entryIndex > 0 {
+			unlockedVault = append(unlockedVault, ',')
+		}
+		var quotedName []byte
+		quotedName, err = json.Marshal(entryName)
+		if err != nil {
+			wipeBytes(unlockedVault)
+			return
+		}
+		unlockedVault = append(unlockedVault, quotedName...)
+		unlockedVault = append(unlockedVault, `:{"value":`...)
+		unlockedVault = appendJSONString(unlockedVault, vault[entryName].Value)
+		unlockedVault = append(unlockedVault, '}')
+	}
+	unlockedVault = append(unlockedVault, '}')
+	return
+}
+
+// Decodes vault JSON into entries without converting secret values to strings
+func decodeVaultEntries(unlockedVault []byte) (vault map[string]Credential, err error) {
+	var rawVault map[string]map[string]json.RawMessage
+	err = json.Unmarshal(unlockedVault, &rawVault)
+	if err != nil {
+		return
+	}
+
+	vault = make(map[string]Credential)
+	for entryName, rawFields := range rawVault {
+		var credential Credential
+		credential.Value, err = unquoteJSONString(rawFields["value"])
+		if err == nil {
+			credential.LoginUserPassword, err = unquoteJSONString(rawFields["loginUserPassword"])
+		}
+		for _, rawField := range rawFields {
+			wipeBytes(rawField)
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid vault entry '%s': %v", entryName, err)
+			for _, decodedCredential := range vault {
+				wipeBytes(decodedCredential.Value)
+				wipeBytes(decodedCredential.LoginUserPassword)
+			}
+			vault = nil
+			return
+		}
+		vault[entryName] = credential
+	}
+	return
+}
+
+// Appends a value as a quoted JSON string (buffer must have room for six bytes per value byte)
+func appendJSONString(buffer []byte, value []byte) (quoted []byte) {
+	const hexDigits = "0123456789abcdef"
+
+	quoted = append(buffer, '"')
+	for _, valueByte := range value {
+		if valueByte == '"' || valueByte == '\\' {
+			quoted = append(quoted, '\\', valueByte)
+		} else if valueByte < 0x20 {
+			quoted = append(quoted, '\\', 'u', '0', '0', hexDigits[valueByte>>4], hexDigits[valueByte&0xf])
+		} else {
+			quoted = append(quoted, valueByte)
+		}
+	}
+	quoted = append(quoted, '"')
+	return
+}
+
+// Reads a quoted JSON string into bytes (empty for absent or null values)
+func unquoteJSONString(rawValue []byte) (value []byte, err error) {
+	if len(rawValue) == 0 || string(rawValue) == "null" {
+		return
+	}
+	if len(rawValue) < 2 || rawValue[0] != '"' || rawValue[len(rawValue)-1] != '"' {
+		err = fmt.Errorf("value is not a string")
+		return
+	}
+	rawValue = rawValue[1 : len(rawValue)-1]
+
+	// Unescaped values are never longer than the escaped value
+	value = make([]byte, 0, len(rawValue))
+	for index := 0; index < len(rawValue); index++ {
+		if rawValue[index] != '\\' {
+			value = append(value, rawValue[index])
+			continue
+		}
+
+		index++
+		if index == len(rawValue) {
+			err = fmt.Errorf("incomplete escape sequence")
+			return
+		}
+		switch rawValue[index] {
+		case '"', '\\', '/':
+			value = append(value, rawValue[index])
+		case 'b':
+			value = append(value, '\b')
+		case 'f':
+			value = append(value, '\f')
+		case 'n':
+			value = append(value, '\n')
+		case 'r':
+			value = append(value, '\r')
+		case 't':
+			value = append(value, '\t')
+		case 'u':
+			char, validChar := parseJSONHexRune(rawValue, index+1)
+			if !validChar {
+				err = fmt.Errorf("invalid unicode escape sequence")
+				return
+			}
+			index += 4
+
+			// Characters outside the basic plane are escaped as UTF-16 surrogate pairs
+			if utf16.IsSurrogate(char) && index+2 < len(rawValue) && rawValue[index+1] == '\\' && rawValue[index+2] == 'u' {
+				lowChar, validLowChar := parseJSONHexRune(rawValue, index+3)
+				pairedChar := utf16.DecodeRune(char, lowChar)
+				if validLowChar && pairedChar != utf8.RuneError {
+					char = pairedChar
+					index += 6
+				}
+			}
+			value = utf8.AppendRune(value, char)
+		default:
+			err = fmt.Errorf("invalid escape sequence")
+			return
+		}
+	}
+	return
+}
+
+// Parses the four hex digits of a JSON unicode escape
+func parseJSONHexRune(rawValue []byte, start int) (char rune, valid bool) {
+	if start+4 > len(rawValue) {
+		return
+	}
+	for _, hexDigit := range rawValue[start : start+4] {
+		char <<= 4
+		switch {
+		case hexDigit >= '0' && hexDigit <= '9':
+			char |= rune(hexDigit - '0')
+		case hexDigit >= 'a' && hexDigit <= 'f':
+			char |= rune(hexDigit - 'a' + 10)
+		case hexDigit >= 'A' && hexDigit <= 'F':
+			char |= rune(hexDigit - 'A' + 10)
+		default:
+			return
+		}
+	}
+	valid = true
+	return
+}
+
+// Wipes all vault values and empties the global vault map
+func wipeVault() {
+	for _, credential := range config.Vault {
+		wipeBytes(credential.Value)
+		wipeBytes(credential.LoginUserPassword)
+	}
+	config.Vault = make(map[string]Credential)
+}
+
+// Decrypts vault file contents into the global vault map
+// Unlocks with the configured identity when it is a vault recipient, otherwise prompts for the vault password
+// upgradeRequired indicates the vault file (format or entries) is outdated and should be written again
+func readVault() (vaultKey VaultKey, upgradeRequired bool, err error) {
+	// Read in encrypted vault file
+	lockedVaultFile, err := os.ReadFile(config.VaultFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve vault file: %v", err)
+		return
+	}
+
+	vaultFile, err := parseVaultFile(lockedVaultFile)
+	if err != nil {
+		return
+	}
+
+	// Try identity first, falling back to the password
+	if config.VaultIdentityFile != "" && len(vaultFile.Recipients) > 0 && !vaultPasswordOverridden() {
+		var identity VaultIdentity
+		identity, err = loadVaultIdentity(config.VaultIdentityFile)
+		if err != nil {
+			err = fmt.Errorf("failed to load vault identity: %v", err)
+			return
+		}
+
+		vaultKey.DataKey, err = unwrapKeyWithIdentity(vaultFile, identity)
+		if err != nil {
+			if vaultFile.Password == nil {
+				return
+			}
+			printMessage(VerbosityProgress, "Unable to unlock vault with identity (%v), falling back to password\n", err)
+			err = nil
+		} else {
+			auditVaultUnlock("identity '" + config.VaultIdentityFile + "' (VaultIdentityFile)")
+		}
+	}
+
+	if vaultKey.DataKey == nil {
+		vaultKey.Password, err = retrieveVaultPassword()
+		if err != nil {
+			return
+		}
+
+		vaultKey.DataKey, err = unwrapKeyWithPassword(vaultFile, vaultKey.Password)
+		if err != nil {
+			return
+		}
+	}
+
+	printMessage(VerbosityFullData, "      Decrypting vault\n")
+
+	// Decrypt Vault
+	unlockedVault, err := decrypt(vaultFile, vaultKey.DataKey)
+	if err != nil {
+		return
+	}
+
+	// Unmarshal vault JSON into global struct
+	unlockedEntries, err := decodeVaultEntries(unlockedVault)
+	wipeBytes(unlockedVault)
+	if err != nil {
+		return
+	}
+	config.Vault = unlockedEntries
+
+	registerSecret([]byte(vaultKey.Password))
+	vaultKey.PasswordSlot = vaultFile.Password
+	vaultKey.Recipients = vaultFile.Recipients
+	upgradeRequired = vaultFileOutdated(vaultFile)
+
+	// Older formats encrypted contents directly with the password key, switch to a separate data key
+	if vaultFile.Version < 3 {
+		vaultKey.DataKey, err = newDataKey()
+		if err != nil {
+			return
+		}
+	}
+
+	// Bring older vault entries up to date
+	if migrateVaultEntries(config.Vault) {
+		upgradeRequired = true
+	}
+
+	registerVaultSecrets()
+	return
+}
+
+// Registers all secret vault values (and the vault password) for redaction - notes are not secret
+func registerVaultSecrets() {
+	for entryName, credential := range config.Vault {
+		if strings.HasPrefix(entryName, vaultTypeNote+"/") {
+			continue
+		}
+		registerSecret(credential.Value)
+	}
+}
+
+// Decrypts vault into the global vault map and migrates the vault file to the current format if required
+func unlockVaultFile() (vaultKey VaultKey, err error) {
+	vaultKey, upgradeRequired, err := readVault()
+	if err != nil {
+		return
+	}
+
+	if !upgradeRequired {
+		return
+	}
+
+	// Password slot can only be upgraded when the password is known
+	if vaultKey.Password == "" && vaultKey.PasswordSlot != nil && kdfParamsOutdated(vaultKey.PasswordSlot.KDF) {
+		printMessage(VerbosityProgress, "Vault password key derivation is outdated, unlock with password to upgrade it\n")
+		return
+	}
+
+	printMessage(VerbosityStandard, "Upgrading vault file to format version %d\n", vaultFormatVersion)
+
+	// Keep a copy of the old vault in case the upgrade is not wanted
+	backupFilePath, err := backupVaultFile("upgrade")
+	if err != nil {
+		err = fmt.Errorf("failed to backup vault before upgrade: %v", err)
+		return
+	}
+	printMessage(VerbosityStandard, "Previous vault kept as %s\n", backupFilePath)
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		err = fmt.Errorf("failed to write upgraded vault: %v", err)
+		return
+	}
+	return
+}
+
+// Copies the current vault file to a backup file next to it
+// Backups are named by reason (like 'upgrade' or 'rekey') and time so earlier backups are kept
+func backupVaultFile(backupReason string) (backupFilePath string, err error) {
+	vaultContents, err := os.ReadFile(config.VaultFilePath)
+	if err != nil {
+		return
+	}
+
+	backupFilePath = config.VaultFilePath + "." + backupReason + "-" + time.Now().Format("20060102T150405.000000000") + ".bak"
+	err = writeFileAtomic(backupFilePath, vaultContents, 0600)
+	return
+}
+
+// Writes file contents to a temporary file and renames it into place
+// Ensures readers never see a partially written file (and concurrent writers do not share a temporary file)
+func writeFileAtomic(filePath string, fileContents []byte, permissions os.FileMode) (err error) {
+	parentDirectory := filepath.Dir(filePath)
+
+	tmpFile, err := os.CreateTemp(parentDirectory, "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return
+	}
+	tmpFilePath := tmpFile.Name()
+
+	err = tmpFile.Chmod(permissions)
+	if err == nil {
+		_, err = tmpFile.Write(fileContents)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFilePath)
+		return
+	}
+
+	err = os.Rename(tmpFilePath, filePath)
+	if err != nil {
+		os.Remove(tmpFilePath)
+		return
+	}
+
+	// Persist the rename itself
+	directory, err := os.Open(parentDirectory)
+	if err != nil {
+		return
+	}
+	err = directory.Sync()
+	closeErr = directory.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// Opens vault for modification - will create the vault file if it doesn't exist
+// Returns the vault key so the vault can be locked again after changes
+func openVault() (vaultKey VaultKey, err error) {
+	if config.VaultFilePath == "" {
+		err = fmt.Errorf("no vault file path configured (PasswordVault)")
+		return
+	}
+
+	// Ensure vault file exists, if not create it
+	vaultFileMeta, err := os.Stat(config.VaultFilePath)
+	if os.IsNotExist(err) {
+		var vaultFile *os.File
+		vaultFile, err = os.OpenFile(config.VaultFilePath, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return
+		}
+		vaultFileMeta, _ = vaultFile.Stat()
+		vaultFile.Close()
+	} else if err != nil {
+		return
+	}
+
+	// Only decrypt if vault file already has data
+	if vaultFileMeta.Size() > 0 {
+		vaultKey, err = unlockVaultFile()
+		return
+	}
+
+	// New vault is protected by a password
+	vaultKey.Password, err = retrieveVaultPassword()
+	if err != nil {
+		return
+	}
+	vaultKey.DataKey, err = newDataKey()
+	return
+}
+
+// Encrypts and writes current vault data back to vault file
+func lockVault(vaultKey VaultKey) (err error) {
+	// New or changed entries must also be masked in any later output
+	registerVaultSecrets()
+	registerSecret([]byte(vaultKey.Password))
+
+	// Marshal vault into json
+	unlockedVault, err := encodeVaultEntries(config.Vault)
+	if err != nil {
+		return
+	}
+
+	// Encrypt Vault
+	lockedVault, err := encrypt(unlockedVault, vaultKey)
+	wipeBytes(unlockedVault)
+	if err != nil {
+		return
+	}
+
+	// Write encrypted vault back to disk - return with or without error
+	err = writeFileAtomic(config.VaultFilePath, lockedVault, 0600)
+	return
+}
+
+// Ensures the vault password is known so the password slot can be rewrapped after the data key changes
+// Verifies a prompted password against the existing password slot
+func requireVaultPassword(vaultKey *VaultKey) (err error) {
+	if vaultKey.Password != "" || vaultKey.PasswordSlot == nil {
+		return
+	}
+
+	password, err := retrieveVaultPassword()
+	if err != nil {
+		return
+	}
+
+	_, err = unwrapKeyWithPassword(VaultFile{Version: vaultFormatVersion, Password: vaultKey.PasswordSlot}, password)
+	if err != nil {
+		return
+	}
+	vaultKey.Password = password
+	return
+}
+
+// Changes the vault master password
+// Old vault is kept as a backup file next to the vault
+func rekeyVault() (err error) {
+	if config.VaultFilePath == "" {
+		err = fmt.Errorf("no vault file path configured (PasswordVault)")
+		return
+	}
+
+	// Decrypt with current password or identity - format upgrades happen as part of the re-encryption
+	vaultKey, _, err := readVault()
+	if err != nil {
+		return
+	}
+
+	newVaultPassword, err := promptUserForSecret("Enter new password for vault: ")
+	if err != nil {
+		return
+	}
+	if newVaultPassword == "" {
+		err = fmt.Errorf("vault password cannot be empty")
+		return
+	}
+	newVaultPasswordConfirm, err := promptUserForSecret("Enter new password for vault again: ")
+	if err != nil {
+		return
+	}
+	if newVaultPassword != newVaultPasswordConfirm {
+		err = fmt.Errorf("passwords do not match")
+		return
+	}
+
+	// Anyone who knew the old password may have the data key, replace it
+	vaultKey.Password = newVaultPassword
+	vaultKey.DataKey, err = newDataKey()
+	if err != nil {
+		return
+	}
+
+	backupFilePath, err := backupVaultFile("rekey")
+	if err != nil {
+		err = fmt.Errorf("failed to backup vault: %v", err)
+		return
+	}
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Vault password changed (backup of old vault: %s)\n", backupFilePath)
+	return
+}
+
+// Opens vault (read-only) if not already open - should only happen once since vault is global
+func loadVault() (err error) {
+	if len(config.Vault) > 0 {
+		return
+	}
+
+	if config.VaultFilePath == "" {
+		err = fmt.Errorf("no vault file path configured (PasswordVault)")
+		return
+	}
+
+	// Use vault from a running agent when available
+	if loadVaultFromAgent() {
+		return
+	}
+
+	// Nothing to decrypt in a new vault
+	vaultFileMeta, err := os.Stat(config.VaultFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve vault file: %v", err)
+		return
+	}
+	if vaultFileMeta.Size() == 0 {
+		return
+	}
+
+	printMessage(VerbosityFullData, "      Reading vault file\n")
+
+	_, err = unlockVaultFile()
+	return
+}
+
+// Opens vault and retrieves login and sudo passwords for remote host
+// Sudo password falls back to the login password when the host has no sudo entry
+func unlockVault(endpointName string) (loginPassword []byte, sudoPassword []byte, err error) {
+	printMessage(VerbosityFullData, "      Host requires password, unlocking vault\n")
+
+	err = loadVault()
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityFullData, "      Retrieving passwords from vault\n")
+
+	loginEntry, hostHasLoginEntry := config.Vault[vaultTypeLogin+"/"+endpointName]
+	sudoEntry, hostHasSudoEntry := config.Vault[vaultTypeSudo+"/"+endpointName]
+
+	// Double check host is in vault
+	if !hostHasLoginEntry && !hostHasSudoEntry {
+		err = fmt.Errorf("host does not have an entry in the vault")
+		return
+	}
+
+	// Copies, host passwords are wiped separately from the vault
+	loginPassword = append([]byte{}, loginEntry.Value...)
+	if hostHasSudoEntry {
+		sudoPassword = append([]byte{}, sudoEntry.Value...)
+	} else {
+		sudoPassword = append([]byte{}, loginEntry.Value...)
+	}
+	return
+}
+
+// Retrieves the passphrase for an encrypted SSH key from the vault
+// Only consults the vault if one is configured, has content, and opens without a prompt, otherwise returns empty passphrase
+func lookupKeyPassphrase(SSHIdentityFile string) (passphrase []byte, err error) {
+	if config.VaultFilePath == "" {
+		return
+	}
+	vaultFileMeta, err := os.Stat(config.VaultFilePath)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	if vaultFileMeta.Size() == 0 {
+		return
+	}
+
+	// A vault prompt would only be an extra prompt before the passphrase prompt for keys without an entry
+	if !vaultOpensWithoutPrompt() {
+		printMessage(VerbosityFullData, "      Vault is locked, not looking up key passphrase\n")
+		return
+	}
+
+	err = loadVault()
+	if err != nil {
+		return
+	}
+
+	passphrase = append([]byte{}, config.Vault[vaultTypePassphrase+"/"+SSHIdentityFile].Value...)
+	return
+}
+
+// Create/Change/Delete a hosts login password in the vault
+// Empty password will delete the host entry
+func modifyVault(endpointName string) (err error) {
+	vaultKey, err := openVault()
+	if err != nil {
+		return
+	}
+
+	// Get password from user for host
+	loginUserName := config.HostInfo[endpointName].EndpointUser
+	hostPassword, err := promptUserForSecret("Enter '%s' password for host '%s' (leave empty to delete entry): ", loginUserName, endpointName)
+	if err != nil {
+		return
+	}
+
+	entryName := vaultTypeLogin + "/" + endpointName
+
+	// Remove password if user supplied empty password
+	if hostPassword == "" {
+		err = removeVaultEntry(entryName, vaultKey)
+		return
+	}
+
+	// Ask again to confirm
+	hostPasswordConfirm, err := promptUserForSecret("Enter '%s' password for host '%s' again: ", loginUserName, endpointName)
+	if err != nil {
+		return
+	}
+
+	// Error if entered passwords are not identical
+	if hostPassword != hostPasswordConfirm {
+		err = fmt.Errorf("passwords do not match")
+		return
+	}
+
+	// Modify/Add host password
+	config.Vault[entryName] = Credential{Value: []byte(hostPassword)}
+
+	// Encrypt and write changes to vault file - return with or without error
+	err = lockVault(vaultKey)
+	return
+}
+
+// Creates or changes a single vault entry
+func setVaultEntry(entryName string) (err error) {
+	entryType, _, err := parseVaultEntryName(entryName)
+	if err != nil {
+		return
+	}
+
+	vaultKey, err := openVault()
+	if err != nil {
+		return
+	}
+
+	var entryValue string
+	if entryType == vaultTypeNote {
+		// Notes are not secret values, read them with echo
+		fmt.Printf("Enter note for '%s': ", entryName)
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		entryValue = scanner.Text()
+		err = scanner.Err()
+		if err != nil {
+			return
+		}
+	} else {
+		entryValue, err = promptUserForSecret("Enter value for '%s': ", entryName)
+		if err != nil {
+			return
+		}
+
+		// Ask again to confirm
+		var entryValueConfirm string
+		entryValueConfirm, err = promptUserForSecret("Enter value for '%s' again: ", entryName)
+		if err != nil {
+			return
+		}
+		if entryValue != entryValueConfirm {
+			err = fmt.Errorf("values do not match")
+			return
+		}
+	}
+
+	if entryValue == "" {
+		err = fmt.Errorf("refusing to store empty value, use delete to remove an entry")
+		return
+	}
+
+	config.Vault[entryName] = Credential{Value: []byte(entryValue)}
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Vault entry '%s' saved\n", entryName)
+	return
+}
+
+// Shows a single vault entry with its value masked
+func getVaultEntry(entryName string, revealValue bool) (err error) {
+	_, _, err = parseVaultEntryName(entryName)
+	if err != nil {
+		return
+	}
+
+	err = loadVault()
+	if err != nil {
+		return
+	}
+
+	credential, entryExists := config.Vault[entryName]
+	if !entryExists {
+		err = fmt.Errorf("vault entry '%s' does not exist", entryName)
+		return
+	}
+
+	if revealValue {
+		fmt.Printf("%s: %s\n", entryName, credential.Value)
+		return
+	}
+	fmt.Printf("%s: %s\n", entryName, maskSecret(credential.Value))
+	return
+}
+
+// Lists all entry names in the vault grouped by type
+func listVaultEntries() (err error) {
+	err = loadVault()
+	if err != nil {
+		return
+	}
+
+	// Sort for stable output
+	var entryNames []string
+	for entryName := range config.Vault {
+		entryNames = append(entryNames, entryName)
+	}
+	sort.Strings(entryNames)
+
+	for _, vaultType := range vaultEntryTypes {
+		var typeHeaderPrinted bool
+		for _, entryName := range entryNames {
+			entryType, name, errLocal := parseVaultEntryName(entryName)
+			if errLocal != nil || entryType != vaultType {
+				continue
+			}
+
+			if !typeHeaderPrinted {
+				fmt.Printf("%s:\n", vaultType)
+				typeHeaderPrinted = true
+			}
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	return
+}
+
+// Renames a vault entry
+// Takes the old and new names separated by a comma ('<type>/<old>,<type>/<new>')
+func renameVaultEntry(renameNames string) (err error) {
+	names := strings.Split(renameNames, ",")
+	if len(names) != 2 {
+		err = fmt.Errorf("rename requires the old and new entry names separated by a comma")
+		return
+	}
+	oldEntryName := strings.TrimSpace(names[0])
+	newEntryName := strings.TrimSpace(names[1])
+
+	_, _, err = parseVaultEntryName(oldEntryName)
+	if err != nil {
+		return
+	}
+	_, _, err = parseVaultEntryName(newEntryName)
+	if err != nil {
+		return
+	}
+
+	vaultKey, err := openVault()
+	if err != nil {
+		return
+	}
+
+	credential, entryExists := config.Vault[oldEntryName]
+	if !entryExists {
+		err = fmt.Errorf("vault entry '%s' does not exist", oldEntryName)
+		return
+	}
+	_, newEntryExists := config.Vault[newEntryName]
+	if newEntryExists {
+		err = fmt.Errorf("vault entry '%s' already exists", newEntryName)
+		return
+	}
+
+	config.Vault[newEntryName] = credential
+	delete(config.Vault, oldEntryName)
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Vault entry '%s' renamed to '%s'\n", oldEntryName, newEntryName)
+	return
+}
+
+// Deletes a vault entry
+func deleteVaultEntry(entryName string) (err error) {
+	_, _, err = parseVaultEntryName(entryName)
+	if err != nil {
+		return
+	}
+
+	vaultKey, err := openVault()
+	if err != nil {
+		return
+	}
+
+	_, entryExists := config.Vault[entryName]
+	if !entryExists {
+		err = fmt.Errorf("vault entry '%s' does not exist", entryName)
+		return
+	}
+
+	err = removeVaultEntry(entryName, vaultKey)
+	return
+}
+
+// Removes entry from opened vault after user confirmation and writes vault back to disk
+func removeVaultEntry(entryName string, vaultKey VaultKey) (err error) {
+	// Just return if entry is not in vault
+	_, entryExists := config.Vault[entryName]
+	if !entryExists {
+		return
+	}
+
+	// Confirm with user before deleting vault entry
+	var userResponse string
+	if config.AllowDeletions {
+		userResponse = "y"
+	} else {
+		userResponse, err = promptUser("Please type 'y' to delete vault entry '%s': ", entryName)
+		if err != nil {
+			return
+		}
+	}
+
+	// Check if the user typed 'y' (always lower-case)
+	if userResponse != "y" {
+		fmt.Printf("Did not receive confirmation, exiting.\n")
+		return
+	}
+
+	delete(config.Vault, entryName)
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Vault entry '%s' deleted\n", entryName)
+	return
+}
+
+// Masks a secret value for display
+// Fixed width so neither content nor length of the secret is shown
+func maskSecret(secret []byte) (masked string) {
+	if len(secret) == 0 {
+		masked = "(empty)"
+		return
+	}
+	masked = "********"
+	return
+}
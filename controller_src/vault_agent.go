@@ -0,0 +1,137 @@
+// controller
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// ###################################
+//      VAULT AGENT CLIENT
+// ###################################
+
+// Sends a single request to the vault agent and returns its response
+func sendVaultAgentRequest(action string) (response VaultAgentResponse, err error) {
+	socketPath, err := vaultAgentSocketPath(false)
+	if err != nil {
+		return
+	}
+
+	agentConn, err := net.DialTimeout("unix", socketPath, 2*time.Second)
+	if err != nil {
+		return
+	}
+	defer agentConn.Close()
+
+	err = agentConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		return
+	}
+
+	err = json.NewEncoder(agentConn).Encode(VaultAgentRequest{Action: action})
+	if err != nil {
+		return
+	}
+
+	err = json.NewDecoder(agentConn).Decode(&response)
+	if err != nil {
+		err = fmt.Errorf("invalid response from vault agent: %v", err)
+		return
+	}
+
+	if response.Error != "" {
+		err = fmt.Errorf("vault agent: %s", response.Error)
+		return
+	}
+	return
+}
+
+// Builds the agent response for a request
+// Vault contents are only included for get requests
+func buildVaultAgentResponse(request VaultAgentRequest, vaultFilePath string, vaultHash string, unlockedVault []byte, remaining time.Duration) (response VaultAgentResponse) {
+	response.VaultFilePath = vaultFilePath
+	response.Remaining = int(remaining.Seconds())
+
+	switch request.Action {
+	case vaultAgentGet:
+		response.VaultHash = vaultHash
+		response.Vault = json.RawMessage(unlockedVault)
+	case vaultAgentStatus, vaultAgentLock:
+	default:
+		response = VaultAgentResponse{Error: fmt.Sprintf("unknown action '%s'", request.Action)}
+	}
+	return
+}
+
+// Retrieves hash of the vault file to detect changes made after the agent unlocked it
+func vaultFileHash() (vaultHash string, err error) {
+	lockedVaultFile, err := os.ReadFile(config.VaultFilePath)
+	if err != nil {
+		return
+	}
+	vaultHash = SHA256Sum(string(lockedVaultFile))
+	return
+}
+
+// Loads the global vault from a running agent
+// Agent is only used when it holds the same vault file and the file has not changed since
+func loadVaultFromAgent() (loaded bool) {
+	if config.VaultFilePath == "" {
+		return
+	}
+
+	response, err := sendVaultAgentRequest(vaultAgentGet)
+	if err != nil {
+		printMessage(VerbosityFullData, "      Vault agent not available: %v\n", err)
+		return
+	}
+
+	if response.VaultFilePath != config.VaultFilePath {
+		printMessage(VerbosityProgress, "Vault agent holds a different vault (%s), not using agent\n", response.VaultFilePath)
+		return
+	}
+
+	currentVaultHash, err := vaultFileHash()
+	if err != nil || currentVaultHash != response.VaultHash {
+		printMessage(VerbosityStandard, "Vault file changed since the vault agent unlocked it, not using agent\n")
+		return
+	}
+
+	agentVault, err := decodeVaultEntries(response.Vault)
+	wipeBytes(response.Vault)
+	if err != nil {
+		printMessage(VerbosityStandard, "Invalid vault from vault agent: %v\n", err)
+		return
+	}
+	config.Vault = agentVault
+	registerVaultSecrets()
+
+	auditVaultUnlock(fmt.Sprintf("vault agent (locks in %s)", time.Duration(response.Remaining)*time.Second))
+	loaded = true
+	return
+}
+
+// Prints which vault the agent holds and the time until it locks
+func showVaultAgentStatus() (err error) {
+	response, err := sendVaultAgentRequest(vaultAgentStatus)
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("Vault agent holds %s, locks in %s if idle\n", response.VaultFilePath, time.Duration(response.Remaining)*time.Second)
+	return
+}
+
+// Tells the vault agent to wipe the vault and exit
+func lockVaultAgent() (err error) {
+	_, err = sendVaultAgentRequest(vaultAgentLock)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Vault agent locked\n")
+	return
+}
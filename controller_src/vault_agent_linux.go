@@ -0,0 +1,319 @@
+//go:build linux
+
+// controller
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ###################################
+//      VAULT AGENT
+// ###################################
+
+// Returns the vault agent socket path inside a directory only accessible by the current user
+// Uses XDG_RUNTIME_DIR when available, otherwise a per-user directory in the temp directory
+func vaultAgentSocketPath(createDirectory bool) (socketPath string, err error) {
+	socketDirectory := os.Getenv("XDG_RUNTIME_DIR")
+	if socketDirectory == "" {
+		socketDirectory = filepath.Join(os.TempDir(), fmt.Sprintf("scmpc-%d", os.Getuid()))
+		if createDirectory {
+			err = os.Mkdir(socketDirectory, 0700)
+			if err != nil && !os.IsExist(err) {
+				return
+			}
+		}
+	}
+
+	// Ensure no other user can control the socket
+	directoryMeta, err := os.Lstat(socketDirectory)
+	if err != nil {
+		return
+	}
+	directoryStat, statOk := directoryMeta.Sys().(*syscall.Stat_t)
+	if !directoryMeta.IsDir() || !statOk || int(directoryStat.Uid) != os.Getuid() {
+		err = fmt.Errorf("vault agent directory '%s' is not a directory owned by the current user", socketDirectory)
+		return
+	}
+	if directoryMeta.Mode().Perm()&0077 != 0 {
+		err = fmt.Errorf("vault agent directory '%s' permissions %#o are too open", socketDirectory, directoryMeta.Mode().Perm())
+		return
+	}
+
+	socketPath = filepath.Join(socketDirectory, vaultAgentSocketName)
+	return
+}
+
+// Unlocks the vault and hands it to a new background agent process
+func startVaultAgent(idleTimeout string) (err error) {
+	timeout, err := time.ParseDuration(idleTimeout)
+	if err != nil {
+		err = fmt.Errorf("invalid idle timeout: %v", err)
+		return
+	}
+	if timeout <= 0 {
+		err = fmt.Errorf("idle timeout must be greater than zero")
+		return
+	}
+
+	if config.VaultFilePath == "" {
+		err = fmt.Errorf("no vault file path configured (PasswordVault)")
+		return
+	}
+
+	socketPath, err := vaultAgentSocketPath(true)
+	if err != nil {
+		return
+	}
+
+	// Only one agent per user
+	_, statusErr := sendVaultAgentRequest(vaultAgentStatus)
+	if statusErr == nil {
+		err = fmt.Errorf("vault agent is already running (socket %s)", socketPath)
+		return
+	}
+
+	_, err = unlockVaultFile()
+	if err != nil {
+		return
+	}
+
+	// Hash after unlocking, a format upgrade rewrites the vault file
+	vaultHash, err := vaultFileHash()
+	if err != nil {
+		return
+	}
+
+	unlockedVault, err := encodeVaultEntries(config.Vault)
+	if err != nil {
+		return
+	}
+	defer wipeBytes(unlockedVault)
+
+	executablePath, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	// Vault is passed over a pipe so it never appears in arguments or environment
+	vaultReader, vaultWriter, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return
+	}
+
+	agentCommand := exec.Command(executablePath, "--config", config.FilePath, "--vault-agent-daemon", timeout.String())
+	agentCommand.ExtraFiles = []*os.File{vaultReader, readyWriter} // fd 3 and 4 in the agent
+	agentCommand.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = agentCommand.Start()
+	vaultReader.Close()
+	readyWriter.Close()
+	if err != nil {
+		vaultWriter.Close()
+		readyReader.Close()
+		return
+	}
+
+	_, err = vaultWriter.Write(append([]byte(vaultHash+"\n"), unlockedVault...))
+	vaultWriter.Close()
+	if err != nil {
+		readyReader.Close()
+		return
+	}
+
+	// Wait for the agent to report it is listening
+	agentStatus, err := io.ReadAll(readyReader)
+	readyReader.Close()
+	if err != nil {
+		return
+	}
+	if string(agentStatus) != "ready" {
+		agentCommand.Wait()
+		err = fmt.Errorf("vault agent failed to start: %s", agentStatus)
+		return
+	}
+
+	printMessage(VerbosityStandard, "Vault agent started (pid %d, socket %s, idle timeout %s)\n", agentCommand.Process.Pid, socketPath, timeout)
+	agentCommand.Process.Release()
+	return
+}
+
+// Background vault agent - holds the unlocked vault in locked memory and answers requests on the agent socket
+// Exits (wiping the vault) when locked, idle for the timeout, or terminated
+func runVaultAgent(idleTimeout string) (err error) {
+	readyPipe := os.NewFile(4, "vault-agent-ready")
+	if readyPipe == nil {
+		err = fmt.Errorf("vault agent must be started with --vault-agent-start")
+		return
+	}
+	defer func() {
+		if err != nil {
+			readyPipe.Write([]byte(err.Error()))
+		}
+		readyPipe.Close()
+	}()
+
+	timeout, err := time.ParseDuration(idleTimeout)
+	if err != nil {
+		return
+	}
+
+	// Keep the vault out of core dumps and away from ptrace by other processes of this user
+	err = unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+	if err != nil {
+		err = fmt.Errorf("failed to disable core dumps: %v", err)
+		return
+	}
+
+	// Receive vault from the starting process
+	vaultPipe := os.NewFile(3, "vault-agent-vault")
+	if vaultPipe == nil {
+		err = fmt.Errorf("vault agent must be started with --vault-agent-start")
+		return
+	}
+	handoff, err := io.ReadAll(vaultPipe)
+	vaultPipe.Close()
+	if err != nil {
+		return
+	}
+	defer wipeBytes(handoff)
+
+	vaultHashLine, vaultContents, validHandoff := bytes.Cut(handoff, []byte("\n"))
+	if !validHandoff || len(vaultContents) == 0 {
+		err = fmt.Errorf("invalid vault received from starting process")
+		return
+	}
+	vaultHash := string(vaultHashLine)
+
+	// Hold vault in memory that is never swapped out
+	lockedVault, err := unix.Mmap(-1, 0, len(vaultContents), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		err = fmt.Errorf("failed to allocate vault memory: %v", err)
+		return
+	}
+	defer unix.Munmap(lockedVault)
+	err = unix.Mlock(lockedVault)
+	if err != nil {
+		err = fmt.Errorf("failed to lock vault memory: %v", err)
+		return
+	}
+	defer wipeBytes(lockedVault)
+	copy(lockedVault, vaultContents)
+	wipeBytes(handoff)
+
+	socketPath, err := vaultAgentSocketPath(false)
+	if err != nil {
+		return
+	}
+
+	// Remove stale socket from an agent that did not exit cleanly
+	os.Remove(socketPath)
+
+	previousUmask := unix.Umask(0177)
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	unix.Umask(previousUmask)
+	if err != nil {
+		return
+	}
+	defer listener.Close()
+
+	// Lock on termination signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	// Lock after inactivity
+	lockDeadline := time.Now().Add(timeout)
+	idleTimer := time.AfterFunc(timeout, func() {
+		listener.Close()
+	})
+	defer idleTimer.Stop()
+
+	// Tell starting process the agent is ready
+	readyPipe.Write([]byte("ready"))
+	readyPipe.Close()
+
+	for {
+		agentConn, acceptErr := listener.AcceptUnix()
+		if acceptErr != nil {
+			// Listener closed by lock, idle timeout, or signal
+			break
+		}
+
+		request, requestErr := readVaultAgentRequest(agentConn)
+		if requestErr != nil {
+			CreateJournaldLog(fmt.Sprintf("Vault agent refused request: %v", requestErr), "err")
+			agentConn.Close()
+			continue
+		}
+
+		// Only retrieving the vault counts as activity
+		if request.Action == vaultAgentGet {
+			idleTimer.Reset(timeout)
+			lockDeadline = time.Now().Add(timeout)
+		}
+
+		response := buildVaultAgentResponse(request, config.VaultFilePath, vaultHash, lockedVault, time.Until(lockDeadline))
+		json.NewEncoder(agentConn).Encode(response)
+		agentConn.Close()
+
+		if request.Action == vaultAgentLock {
+			break
+		}
+	}
+
+	CreateJournaldLog(fmt.Sprintf("Vault agent for %s locked", config.VaultFilePath), "info")
+	return
+}
+
+// Reads a request from an agent connection after checking the peer is the same user
+func readVaultAgentRequest(agentConn *net.UnixConn) (request VaultAgentRequest, err error) {
+	rawConn, err := agentConn.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	var peerCredentials *unix.Ucred
+	var credentialErr error
+	err = rawConn.Control(func(fileDescriptor uintptr) {
+		peerCredentials, credentialErr = unix.GetsockoptUcred(int(fileDescriptor), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return
+	}
+	if credentialErr != nil {
+		err = fmt.Errorf("failed to retrieve peer credentials: %v", credentialErr)
+		return
+	}
+	if int(peerCredentials.Uid) != os.Getuid() {
+		err = fmt.Errorf("connection from uid %d (pid %d) does not match agent uid %d", peerCredentials.Uid, peerCredentials.Pid, os.Getuid())
+		return
+	}
+
+	err = agentConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		return
+	}
+
+	err = json.NewDecoder(agentConn).Decode(&request)
+	return
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+// controller
+package main
+
+import (
+	"fmt"
+)
+
+// Vault agent requires Linux peer credential checks and locked memory
+
+func vaultAgentSocketPath(createDirectory bool) (socketPath string, err error) {
+	err = fmt.Errorf("vault agent is only supported on Linux")
+	return
+}
+
+func startVaultAgent(idleTimeout string) (err error) {
+	err = fmt.Errorf("vault agent is only supported on Linux")
+	return
+}
+
+func runVaultAgent(idleTimeout string) (err error) {
+	err = fmt.Errorf("vault agent is only supported on Linux")
+	return
+}
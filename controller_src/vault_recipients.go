@@ -0,0 +1,350 @@
+// controller
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// ###################################
+//      VAULT RECIPIENTS
+// ###################################
+
+// Parses a recipient public key (or file containing one)
+// Accepts 'ssh-ed25519 <base64> [comment]' or 'scmp-x25519 <base64> [comment]'
+func parseVaultRecipient(publicKeyInput string) (recipient VaultRecipient, err error) {
+	publicKeyInput = strings.TrimSpace(publicKeyInput)
+
+	// Read from file when input is not a key itself
+	if !strings.HasPrefix(publicKeyInput, vaultRecipientSSHEd25519+" ") && !strings.HasPrefix(publicKeyInput, vaultX25519PublicPrefix+" ") {
+		var publicKeyFile []byte
+		publicKeyFile, err = os.ReadFile(expandHomeDirectory(publicKeyInput))
+		if err != nil {
+			err = fmt.Errorf("input is not a supported public key and could not be read as a file: %v", err)
+			return
+		}
+		publicKeyInput = strings.TrimSpace(string(publicKeyFile))
+	}
+
+	if strings.HasPrefix(publicKeyInput, vaultX25519PublicPrefix+" ") {
+		keyFields := strings.Fields(publicKeyInput)
+		recipient.Type = vaultRecipientX25519
+		recipient.PublicKey = keyFields[0] + " " + keyFields[1]
+		recipient.Comment = strings.Join(keyFields[2:], " ")
+
+		_, err = recipientX25519PublicKey(recipient)
+		return
+	}
+
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKeyInput))
+	if err != nil {
+		err = fmt.Errorf("invalid public key: %v", err)
+		return
+	}
+	if publicKey.Type() != ssh.KeyAlgoED25519 {
+		err = fmt.Errorf("unsupported recipient key type '%s' (only ssh-ed25519 and scmp-x25519 keys can unlock the vault)", publicKey.Type())
+		return
+	}
+
+	recipient.Type = vaultRecipientSSHEd25519
+	recipient.PublicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	recipient.Comment = comment
+	return
+}
+
+// Retrieves the X25519 public key for a recipient
+func recipientX25519PublicKey(recipient VaultRecipient) (x25519Key []byte, err error) {
+	switch recipient.Type {
+	case vaultRecipientX25519:
+		keyFields := strings.Fields(recipient.PublicKey)
+		if len(keyFields) != 2 || keyFields[0] != vaultX25519PublicPrefix {
+			err = fmt.Errorf("invalid x25519 recipient '%s'", recipient.PublicKey)
+			return
+		}
+		x25519Key, err = base64.StdEncoding.DecodeString(keyFields[1])
+		if err != nil {
+			err = fmt.Errorf("invalid x25519 recipient: %v", err)
+			return
+		}
+		if len(x25519Key) != curve25519.PointSize {
+			err = fmt.Errorf("invalid x25519 recipient key length %d", len(x25519Key))
+			return
+		}
+	case vaultRecipientSSHEd25519:
+		var publicKey ssh.PublicKey
+		publicKey, _, _, _, err = ssh.ParseAuthorizedKey([]byte(recipient.PublicKey))
+		if err != nil {
+			err = fmt.Errorf("invalid ssh recipient: %v", err)
+			return
+		}
+		cryptoPublicKey, isCryptoKey := publicKey.(ssh.CryptoPublicKey)
+		if !isCryptoKey {
+			err = fmt.Errorf("unsupported ssh recipient key")
+			return
+		}
+		ed25519PublicKey, isEd25519 := cryptoPublicKey.CryptoPublicKey().(ed25519.PublicKey)
+		if !isEd25519 {
+			err = fmt.Errorf("ssh recipient is not an ed25519 key")
+			return
+		}
+		x25519Key, err = ed25519PublicKeyToX25519(ed25519PublicKey)
+	default:
+		err = fmt.Errorf("unknown vault recipient type '%s'", recipient.Type)
+	}
+	return
+}
+
+// Loads a private key that can unlock the vault as a recipient
+// Accepts native X25519 identity files (see --vault-keygen) or OpenSSH ed25519 private keys
+// SSH agents cannot perform the key agreement needed to unwrap the vault key, so a private key file is required
+func loadVaultIdentity(identityFilePath string) (identity VaultIdentity, err error) {
+	identityFile, err := os.ReadFile(expandHomeDirectory(identityFilePath))
+	if err != nil {
+		return
+	}
+
+	identityText := strings.TrimSpace(string(identityFile))
+	if strings.HasPrefix(identityText, vaultX25519SecretPrefix+" ") {
+		keyFields := strings.Fields(identityText)
+		identity.PrivateKey, err = base64.StdEncoding.DecodeString(keyFields[1])
+		if err != nil {
+			err = fmt.Errorf("invalid x25519 identity: %v", err)
+			return
+		}
+		if len(identity.PrivateKey) != curve25519.ScalarSize {
+			err = fmt.Errorf("invalid x25519 identity key length %d", len(identity.PrivateKey))
+			return
+		}
+
+		var publicKey []byte
+		publicKey, err = curve25519.X25519(identity.PrivateKey, curve25519.Basepoint)
+		if err != nil {
+			return
+		}
+		identity.Recipient = VaultRecipient{
+			Type:      vaultRecipientX25519,
+			PublicKey: vaultX25519PublicPrefix + " " + base64.StdEncoding.EncodeToString(publicKey),
+		}
+		return
+	}
+
+	if _, _, _, _, pubErr := ssh.ParseAuthorizedKey(identityFile); pubErr == nil {
+		err = fmt.Errorf("identity file is a public key, ssh agents cannot unlock the vault (use the private key)")
+		return
+	}
+
+	rawPrivateKey, err := ssh.ParseRawPrivateKey(identityFile)
+	if _, encryptedKey := err.(*ssh.PassphraseMissingError); encryptedKey {
+		var passphrase string
+		passphrase, err = promptUserForSecret("Enter passphrase for vault identity '%s': ", identityFilePath)
+		if err != nil {
+			return
+		}
+		registerSecret([]byte(passphrase))
+		rawPrivateKey, err = ssh.ParseRawPrivateKeyWithPassphrase(identityFile, []byte(passphrase))
+	}
+	if err != nil {
+		return
+	}
+
+	var ed25519PrivateKey ed25519.PrivateKey
+	switch privateKey := rawPrivateKey.(type) {
+	case ed25519.PrivateKey:
+		ed25519PrivateKey = privateKey
+	case *ed25519.PrivateKey:
+		ed25519PrivateKey = *privateKey
+	default:
+		err = fmt.Errorf("unsupported identity key type %T (only ed25519 keys can unlock the vault)", rawPrivateKey)
+		return
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(ed25519PrivateKey.Public())
+	if err != nil {
+		return
+	}
+	identity.Recipient = VaultRecipient{
+		Type:      vaultRecipientSSHEd25519,
+		PublicKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))),
+	}
+	identity.PrivateKey = ed25519PrivateKeyToX25519(ed25519PrivateKey)
+	return
+}
+
+// Creates a new X25519 identity file and matching '.pub' recipient file
+func generateVaultIdentity(identityFilePath string) (err error) {
+	identityFilePath = expandHomeDirectory(identityFilePath)
+
+	_, err = os.Stat(identityFilePath)
+	if err == nil {
+		err = fmt.Errorf("identity file '%s' already exists", identityFilePath)
+		return
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err = io.ReadFull(rand.Reader, privateKey); err != nil {
+		return
+	}
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return
+	}
+
+	identityText := vaultX25519SecretPrefix + " " + base64.StdEncoding.EncodeToString(privateKey) + "\n"
+	recipientText := vaultX25519PublicPrefix + " " + base64.StdEncoding.EncodeToString(publicKey) + " " + filepath.Base(identityFilePath) + "\n"
+
+	err = os.WriteFile(identityFilePath, []byte(identityText), 0600)
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(identityFilePath+".pub", []byte(recipientText), 0644)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Created vault identity %s\n", identityFilePath)
+	printMessage(VerbosityStandard, "Recipient (add with --vault-add-recipient): %s", recipientText)
+	return
+}
+
+// Prints the password slot and all public key recipients of the vault
+// Recipients are stored unencrypted, so the vault does not need to be unlocked
+func listVaultRecipients() (err error) {
+	if config.VaultFilePath == "" {
+		err = fmt.Errorf("no vault file path configured (PasswordVault)")
+		return
+	}
+
+	lockedVaultFile, err := os.ReadFile(config.VaultFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve vault file: %v", err)
+		return
+	}
+	vaultFile, err := parseVaultFile(lockedVaultFile)
+	if err != nil {
+		return
+	}
+
+	if vaultFile.Version < 3 || vaultFile.Password != nil {
+		fmt.Printf("password\n")
+	}
+	for _, recipient := range vaultFile.Recipients {
+		if recipient.Comment != "" {
+			fmt.Printf("%s %s\n", recipient.PublicKey, recipient.Comment)
+		} else {
+			fmt.Printf("%s\n", recipient.PublicKey)
+		}
+	}
+	return
+}
+
+// Allows a public key to unlock the vault
+func addVaultRecipient(publicKeyInput string) (err error) {
+	recipient, err := parseVaultRecipient(publicKeyInput)
+	if err != nil {
+		return
+	}
+
+	vaultKey, err := openVault()
+	if err != nil {
+		return
+	}
+
+	for _, existingRecipient := range vaultKey.Recipients {
+		if existingRecipient.PublicKey == recipient.PublicKey {
+			err = fmt.Errorf("recipient '%s' can already unlock the vault", recipient.PublicKey)
+			return
+		}
+	}
+	vaultKey.Recipients = append(vaultKey.Recipients, recipient)
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Added vault recipient %s\n", recipient.PublicKey)
+	return
+}
+
+// Finds the recipient matching a public key or comment
+func findVaultRecipient(recipients []VaultRecipient, recipientName string) (recipientIndex int, err error) {
+	recipientName = strings.TrimSpace(recipientName)
+	recipientIndex = -1
+	for index, recipient := range recipients {
+		if recipient.PublicKey == recipientName || (recipient.Comment != "" && recipient.Comment == recipientName) || recipient.PublicKey+" "+recipient.Comment == recipientName {
+			if recipientIndex != -1 {
+				err = fmt.Errorf("'%s' matches more than one recipient, use the public key instead", recipientName)
+				return
+			}
+			recipientIndex = index
+		}
+	}
+	if recipientIndex == -1 {
+		err = fmt.Errorf("no vault recipient matches '%s'", recipientName)
+		return
+	}
+	return
+}
+
+// Removes a public key (or the password) from the vault
+// Data key is replaced so the removed key cannot decrypt future versions of the vault
+func removeVaultRecipient(recipientName string) (err error) {
+	vaultKey, err := openVault()
+	if err != nil {
+		return
+	}
+
+	if recipientName == "password" {
+		if vaultKey.Password == "" && vaultKey.PasswordSlot == nil {
+			err = fmt.Errorf("vault does not have a password")
+			return
+		}
+		if len(vaultKey.Recipients) == 0 {
+			err = fmt.Errorf("cannot remove the vault password without any recipients")
+			return
+		}
+		vaultKey.Password = ""
+		vaultKey.PasswordSlot = nil
+	} else {
+		var recipientIndex int
+		recipientIndex, err = findVaultRecipient(vaultKey.Recipients, recipientName)
+		if err != nil {
+			return
+		}
+		if len(vaultKey.Recipients) == 1 && vaultKey.Password == "" && vaultKey.PasswordSlot == nil {
+			err = fmt.Errorf("cannot remove the last recipient of a vault without a password")
+			return
+		}
+		vaultKey.Recipients = append(vaultKey.Recipients[:recipientIndex], vaultKey.Recipients[recipientIndex+1:]...)
+
+		// Password slot must be rewrapped for the new data key
+		err = requireVaultPassword(&vaultKey)
+		if err != nil {
+			return
+		}
+	}
+
+	vaultKey.DataKey, err = newDataKey()
+	if err != nil {
+		return
+	}
+
+	err = lockVault(vaultKey)
+	if err != nil {
+		return
+	}
+
+	printMessage(VerbosityStandard, "Removed vault recipient %s\n", recipientName)
+	return
+}
@@ -0,0 +1,179 @@
+// controller
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ###################################
+//      VAULT UNLOCK SOURCES
+// ###################################
+
+// Retrieves the vault password from the first available unlock source
+// Precedence: --vault-password-fd, --vault-password-file, environment variable, VaultPasswordCommand, VaultPasswordFile, then prompt
+// The resolved password is cached so later unlocks in the same run use the same password
+func retrieveVaultPassword() (vaultPassword string, err error) {
+	if cachedVaultPasswordSource != "" {
+		vaultPassword = cachedVaultPassword
+		return
+	}
+
+	overridden := vaultPasswordOverridden()
+
+	var source string
+	if config.VaultPasswordFD >= 0 {
+		source = fmt.Sprintf("file descriptor %d (--vault-password-fd)", config.VaultPasswordFD)
+		vaultPassword, err = readVaultPasswordFD(config.VaultPasswordFD)
+	} else if config.VaultPasswordFileOverride != "" {
+		source = fmt.Sprintf("file '%s' (--vault-password-file)", config.VaultPasswordFileOverride)
+		vaultPassword, err = readVaultPasswordFile(config.VaultPasswordFileOverride)
+	} else if envPassword, envPasswordSet := os.LookupEnv(environmentVaultPassword); envPasswordSet {
+		source = fmt.Sprintf("environment variable '%s'", environmentVaultPassword)
+		vaultPassword = envPassword
+
+		// Don't pass the password on to any child processes
+		os.Unsetenv(environmentVaultPassword)
+	} else if config.VaultPasswordCommand != "" {
+		source = fmt.Sprintf("command '%s' (VaultPasswordCommand)", config.VaultPasswordCommand)
+		vaultPassword, err = runVaultPasswordCommand(config.VaultPasswordCommand)
+	} else if config.VaultPasswordFile != "" {
+		source = fmt.Sprintf("file '%s' (VaultPasswordFile)", config.VaultPasswordFile)
+		vaultPassword, err = readVaultPasswordFile(config.VaultPasswordFile)
+	} else {
+		source = "interactive prompt"
+		vaultPassword, err = promptUserForSecret("Enter password for vault: ")
+	}
+	if err != nil {
+		err = fmt.Errorf("vault password from %s: %v", source, err)
+		return
+	}
+
+	if vaultPassword == "" {
+		err = fmt.Errorf("vault password from %s is empty", source)
+		return
+	}
+
+	cachedVaultPassword = vaultPassword
+	cachedVaultPasswordSource = source
+	cachedVaultPasswordOverridden = overridden
+
+	auditVaultUnlock("password from " + source)
+	return
+}
+
+// Checks if a password source was explicitly given for this run (takes precedence over the vault identity)
+func vaultPasswordOverridden() (overridden bool) {
+	if cachedVaultPasswordSource != "" {
+		overridden = cachedVaultPasswordOverridden
+		return
+	}
+
+	_, envPasswordSet := os.LookupEnv(environmentVaultPassword)
+	if config.VaultPasswordFD >= 0 || config.VaultPasswordFileOverride != "" || envPasswordSet {
+		overridden = true
+	}
+	return
+}
+
+// Checks if the vault is open or can be opened without prompting the user
+func vaultOpensWithoutPrompt() (noPrompt bool) {
+	if len(config.Vault) > 0 || cachedVaultPasswordSource != "" || vaultPasswordOverridden() {
+		noPrompt = true
+		return
+	}
+	if config.VaultPasswordCommand != "" || config.VaultPasswordFile != "" || config.VaultIdentityFile != "" {
+		noPrompt = true
+		return
+	}
+	noPrompt = loadVaultFromAgent()
+	return
+}
+
+// Records which source was used to unlock the vault
+func auditVaultUnlock(source string) {
+	auditMessage := fmt.Sprintf("Vault %s unlocked using %s", config.VaultFilePath, source)
+
+	printMessage(VerbosityStandard, "%s\n", auditMessage)
+
+	err := CreateJournaldLog(auditMessage, "info")
+	if err != nil {
+		printMessage(VerbosityStandard, "Failed to create journald entry: %v\n", err)
+	}
+}
+
+// Removes a single trailing line ending from password source output
+func trimPasswordLineEnding(rawPassword []byte) (password string) {
+	rawPassword = bytes.TrimSuffix(rawPassword, []byte("\n"))
+	rawPassword = bytes.TrimSuffix(rawPassword, []byte("\r"))
+	password = string(rawPassword)
+	return
+}
+
+// Reads the vault password from an already open file descriptor (like a pipe from the caller)
+func readVaultPasswordFD(fileDescriptor int) (vaultPassword string, err error) {
+	passwordFile := os.NewFile(uintptr(fileDescriptor), "vault-password-fd")
+	if passwordFile == nil {
+		err = fmt.Errorf("invalid file descriptor")
+		return
+	}
+	defer passwordFile.Close()
+
+	rawPassword, err := io.ReadAll(passwordFile)
+	if err != nil {
+		return
+	}
+
+	vaultPassword = trimPasswordLineEnding(rawPassword)
+	return
+}
+
+// Reads the vault password from a file
+// Refuses files that are readable by other users
+func readVaultPasswordFile(passwordFilePath string) (vaultPassword string, err error) {
+	passwordFilePath = expandHomeDirectory(passwordFilePath)
+
+	passwordFileMeta, err := os.Stat(passwordFilePath)
+	if err != nil {
+		return
+	}
+	if passwordFileMeta.Mode().Perm()&0077 != 0 {
+		err = fmt.Errorf("permissions %#o are too open (must not be accessible by group or others)", passwordFileMeta.Mode().Perm())
+		return
+	}
+
+	rawPassword, err := os.ReadFile(passwordFilePath)
+	if err != nil {
+		return
+	}
+
+	vaultPassword = trimPasswordLineEnding(rawPassword)
+	return
+}
+
+// Runs an external command and uses its stdout as the vault password
+// Stdin and stderr are left attached so helpers can interact with the user
+func runVaultPasswordCommand(passwordCommand string) (vaultPassword string, err error) {
+	var stdout bytes.Buffer
+
+	command := exec.Command("sh", "-c", passwordCommand)
+	command.Stdin = os.Stdin
+	command.Stdout = &stdout
+	command.Stderr = os.Stderr
+
+	err = command.Run()
+	if err != nil {
+		return
+	}
+
+	vaultPassword = trimPasswordLineEnding(stdout.Bytes())
+	if strings.Contains(vaultPassword, "\n") {
+		err = fmt.Errorf("command output must be a single line")
+		return
+	}
+	return
+}
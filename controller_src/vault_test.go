@@ -0,0 +1,421 @@
+// controller
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseVaultEntryName(t *testing.T) {
+	tests := []struct {
+		entryName    string
+		expectedType string
+		expectedName string
+		expectError  bool
+	}{
+		{"login/Web01", "login", "Web01", false},
+		{"sudo/Web01", "sudo", "Web01", false},
+		{"passphrase/~/.ssh/id_ed25519", "passphrase", "~/.ssh/id_ed25519", false},
+		{"secret/db-password", "secret", "db-password", false},
+		{"note/on-call", "note", "on-call", false},
+		{"Web01", "", "", true},
+		{"login/", "", "", true},
+		{"unknown/Web01", "unknown", "Web01", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.entryName, func(t *testing.T) {
+			entryType, name, err := parseVaultEntryName(test.entryName)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if entryType != test.expectedType {
+				t.Errorf("expected type '%s' but got '%s'", test.expectedType, entryType)
+			}
+			if name != test.expectedName {
+				t.Errorf("expected name '%s' but got '%s'", test.expectedName, name)
+			}
+		})
+	}
+}
+
+func TestMigrateVaultEntries(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	vault := map[string]Credential{
+		"Web01":        {LoginUserPassword: []byte("legacypass")},
+		"sudo/Web01":   {Value: []byte("sudopass")},
+		"secret/token": {Value: []byte("abc")},
+	}
+
+	migrateVaultEntries(vault)
+
+	if _, legacyPresent := vault["Web01"]; legacyPresent {
+		t.Errorf("expected legacy entry to be removed")
+	}
+	if string(vault["login/Web01"].Value) != "legacypass" {
+		t.Errorf("expected migrated login entry value 'legacypass' but got '%s'", vault["login/Web01"].Value)
+	}
+	if string(vault["sudo/Web01"].Value) != "sudopass" || string(vault["secret/token"].Value) != "abc" {
+		t.Errorf("expected typed entries to be unchanged")
+	}
+	if len(vault) != 3 {
+		t.Errorf("expected 3 vault entries but got %d", len(vault))
+	}
+}
+
+func TestEncodeVaultEntries(t *testing.T) {
+	vault := map[string]Credential{
+		"login/Web01":    {Value: []byte("pa\"ss\\word")},
+		"secret/ctrl":    {Value: []byte("tab\tnew\nline\x01")},
+		"secret/utf8":    {Value: []byte("pässwörd 🔑")},
+		"note/<on&call>": {Value: []byte("call </script>")},
+	}
+
+	unlockedVault, err := encodeVaultEntries(vault)
+	if err != nil {
+		t.Fatalf("encodeVaultEntries() error = %v", err)
+	}
+
+	// Same JSON as the string based format
+	var stringVault map[string]map[string]string
+	err = json.Unmarshal(unlockedVault, &stringVault)
+	if err != nil {
+		t.Fatalf("encoded vault is not valid JSON: %v", err)
+	}
+	for entryName, credential := range vault {
+		if stringVault[entryName]["value"] != string(credential.Value) {
+			t.Errorf("entry %s encoded as %q, expected %q", entryName, stringVault[entryName]["value"], credential.Value)
+		}
+	}
+
+	// Vaults written by encoding/json (escaped HTML and unicode) decode to the same values
+	stringVault["secret/escaped"] = map[string]string{"value": "<\u2028>"}
+	stringVault["Web02"] = map[string]string{"loginUserPassword": "legacy"}
+	marshaledVault, err := json.Marshal(stringVault)
+	if err != nil {
+		t.Fatalf("failed marshaling vault: %v", err)
+	}
+	marshaledVault = bytes.ReplaceAll(marshaledVault, []byte("🔑"), []byte(`\ud83d\udd11`))
+
+	decodedVault, err := decodeVaultEntries(marshaledVault)
+	if err != nil {
+		t.Fatalf("decodeVaultEntries() error = %v", err)
+	}
+	for entryName, credential := range vault {
+		if !bytes.Equal(decodedVault[entryName].Value, credential.Value) {
+			t.Errorf("entry %s decoded as %q, expected %q", entryName, decodedVault[entryName].Value, credential.Value)
+		}
+	}
+	if string(decodedVault["secret/escaped"].Value) != "<\u2028>" || string(decodedVault["Web02"].LoginUserPassword) != "legacy" {
+		t.Errorf("unexpected decoded entries %q and %q", decodedVault["secret/escaped"].Value, decodedVault["Web02"].LoginUserPassword)
+	}
+
+	_, err = decodeVaultEntries([]byte(`{"login/Web01":{"value":5}}`))
+	if err == nil {
+		t.Errorf("decodeVaultEntries() expected error for non-string value")
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		secret   string
+		expected string
+	}{
+		{"", "(empty)"},
+		{"short", "********"},
+		{"averylongpassword", "********"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.secret, func(t *testing.T) {
+			masked := maskSecret([]byte(test.secret))
+			if masked != test.expected {
+				t.Errorf("maskSecret(%s) = %s, want %s", test.secret, masked, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseVaultRecipient(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedType    string
+		expectedKey     string
+		expectedComment string
+		expectError     bool
+	}{
+		{"ssh ed25519", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnfQBsAFi2FDX0i+BADHB3AbcjbJIapT3A1cw9tLyzc alice@laptop", vaultRecipientSSHEd25519, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnfQBsAFi2FDX0i+BADHB3AbcjbJIapT3A1cw9tLyzc", "alice@laptop", false},
+		{"x25519", "scmp-x25519 CQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQk= bob", vaultRecipientX25519, "scmp-x25519 CQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQk=", "bob", false},
+		{"x25519 short key", "scmp-x25519 CQkJCQ==", "", "", "", true},
+		{"ssh rsa", "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQC7", "", "", "", true},
+		{"missing file", "/nonexistent/recipient.pub", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recipient, err := parseVaultRecipient(test.input)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if recipient.Type != test.expectedType {
+				t.Errorf("expected type '%s' but got '%s'", test.expectedType, recipient.Type)
+			}
+			if recipient.PublicKey != test.expectedKey {
+				t.Errorf("expected public key '%s' but got '%s'", test.expectedKey, recipient.PublicKey)
+			}
+			if recipient.Comment != test.expectedComment {
+				t.Errorf("expected comment '%s' but got '%s'", test.expectedComment, recipient.Comment)
+			}
+		})
+	}
+}
+
+func TestFindVaultRecipient(t *testing.T) {
+	recipients := []VaultRecipient{
+		{Type: vaultRecipientX25519, PublicKey: "scmp-x25519 AAAA", Comment: "alice"},
+		{Type: vaultRecipientX25519, PublicKey: "scmp-x25519 BBBB", Comment: "bob"},
+		{Type: vaultRecipientX25519, PublicKey: "scmp-x25519 CCCC", Comment: "bob"},
+	}
+
+	tests := []struct {
+		name          string
+		expectedIndex int
+		expectError   bool
+	}{
+		{"alice", 0, false},
+		{"scmp-x25519 BBBB", 1, false},
+		{"scmp-x25519 CCCC bob", 2, false},
+		{"bob", 0, true},
+		{"carol", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index, err := findVaultRecipient(recipients, test.name)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if index != test.expectedIndex {
+				t.Errorf("expected index %d but got %d", test.expectedIndex, index)
+			}
+		})
+	}
+}
+
+func TestRetrieveVaultPassword(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	tempDir := t.TempDir()
+	privateFile := filepath.Join(tempDir, "vault.pass")
+	err := os.WriteFile(privateFile, []byte("filepass\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+	openFile := filepath.Join(tempDir, "vault-open.pass")
+	err = os.WriteFile(openFile, []byte("openpass\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		fileOverride     string
+		envPassword      string
+		passwordCommand  string
+		passwordFile     string
+		expectedPassword string
+		expectError      bool
+	}{
+		{"argument file over everything", privateFile, "envpass", "echo cmdpass", openFile, "filepass", false},
+		{"environment over config", "", "envpass", "echo cmdpass", privateFile, "envpass", false},
+		{"command over config file", "", "", "echo cmdpass", openFile, "cmdpass", false},
+		{"config file", "", "", "", privateFile, "filepass", false},
+		{"open file permissions", "", "", "", openFile, "", true},
+		{"failing command", "", "", "exit 1", "", "", true},
+		{"empty command output", "", "", "true", "", "", true},
+		{"multi-line command output", "", "", "printf 'a\\nb\\n'", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cachedVaultPasswordSource = ""
+			config.VaultPasswordFD = -1
+			config.VaultPasswordFileOverride = test.fileOverride
+			config.VaultPasswordCommand = test.passwordCommand
+			config.VaultPasswordFile = test.passwordFile
+			if test.envPassword != "" {
+				t.Setenv(environmentVaultPassword, test.envPassword)
+			} else {
+				os.Unsetenv(environmentVaultPassword)
+			}
+
+			password, err := retrieveVaultPassword()
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if password != test.expectedPassword {
+				t.Errorf("expected password '%s' but got '%s'", test.expectedPassword, password)
+			}
+		})
+	}
+}
+
+func TestRetrieveVaultPasswordCached(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	cachedVaultPasswordSource = ""
+	defer func() { cachedVaultPasswordSource = "" }()
+	config.VaultPasswordFD = -1
+	config.VaultPasswordFileOverride = ""
+	config.VaultPasswordCommand = ""
+	config.VaultPasswordFile = ""
+	t.Setenv(environmentVaultPassword, "envpass")
+
+	// Environment source is unset after the first read
+	for call := 1; call <= 2; call++ {
+		password, err := retrieveVaultPassword()
+		if err != nil {
+			t.Fatalf("call %d: expected no error but got: %v", call, err)
+		}
+		if password != "envpass" {
+			t.Errorf("call %d: expected password 'envpass' but got '%s'", call, password)
+		}
+		if !vaultPasswordOverridden() {
+			t.Errorf("call %d: expected password to remain overridden", call)
+		}
+	}
+}
+
+func TestLookupKeyPassphraseLockedVault(t *testing.T) {
+	globalVerbosityLevel = 0
+
+	tempDir := t.TempDir()
+	config.VaultFilePath = filepath.Join(tempDir, "vault")
+	defer func() { config.VaultFilePath = "" }()
+	err := os.WriteFile(config.VaultFilePath, []byte(`{"version":3}`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write vault file: %v", err)
+	}
+
+	// No agent and no password source - the vault would need a prompt
+	t.Setenv("XDG_RUNTIME_DIR", tempDir)
+	os.Unsetenv(environmentVaultPassword)
+	cachedVaultPasswordSource = ""
+	config.Vault = nil
+	config.VaultPasswordFD = -1
+	config.VaultPasswordFileOverride = ""
+	config.VaultPasswordCommand = ""
+	config.VaultPasswordFile = ""
+	config.VaultIdentityFile = ""
+
+	passphrase, err := lookupKeyPassphrase("~/.ssh/id_ed25519")
+	if err != nil || len(passphrase) != 0 {
+		t.Errorf("lookupKeyPassphrase() = %q (%v), expected no passphrase without unlocking", passphrase, err)
+	}
+}
+
+func TestBuildVaultAgentResponse(t *testing.T) {
+	unlockedVault := []byte(`{"login/Web01":{"value":"pass"}}`)
+
+	tests := []struct {
+		action            string
+		expectVault       bool
+		expectError       bool
+		expectedRemaining int
+	}{
+		{vaultAgentGet, true, false, 90},
+		{vaultAgentStatus, false, false, 90},
+		{vaultAgentLock, false, false, 90},
+		{"dump", false, true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			response := buildVaultAgentResponse(VaultAgentRequest{Action: test.action}, "/vault", "abc", unlockedVault, 90*time.Second)
+			if test.expectError {
+				if response.Error == "" {
+					t.Errorf("expected error but got none")
+				}
+				if len(response.Vault) != 0 || response.VaultFilePath != "" {
+					t.Errorf("expected no vault information in error response")
+				}
+				return
+			}
+			if response.Error != "" {
+				t.Errorf("expected no error but got: %s", response.Error)
+			}
+			if (len(response.Vault) > 0) != test.expectVault {
+				t.Errorf("expected vault included = %t but got %t", test.expectVault, len(response.Vault) > 0)
+			}
+			if test.expectVault && response.VaultHash != "abc" {
+				t.Errorf("expected vault hash 'abc' but got '%s'", response.VaultHash)
+			}
+			if response.Remaining != test.expectedRemaining {
+				t.Errorf("expected remaining %d but got %d", test.expectedRemaining, response.Remaining)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	directory := t.TempDir()
+	filePath := filepath.Join(directory, "vault")
+
+	// Concurrent writers never share a temporary file
+	done := make(chan error)
+	for writer := 0; writer < 8; writer++ {
+		go func() {
+			done <- writeFileAtomic(filePath, []byte("contents"), 0600)
+		}()
+	}
+	for writer := 0; writer < 8; writer++ {
+		err := <-done
+		if err != nil {
+			t.Fatalf("writeFileAtomic() error = %v", err)
+		}
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil || string(contents) != "contents" {
+		t.Fatalf("file contents = %q (%v), expected %q", contents, err, "contents")
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil || fileInfo.Mode().Perm() != 0600 {
+		t.Errorf("file permissions = %v (%v), expected 0600", fileInfo.Mode().Perm(), err)
+	}
+
+	directoryEntries, err := os.ReadDir(directory)
+	if err != nil || len(directoryEntries) != 1 {
+		t.Errorf("expected only the written file to remain, found %d entries (%v)", len(directoryEntries), err)
+	}
+}